@@ -0,0 +1,490 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// --- ALTER TABLE ---
+//
+// ALTER TABLE <table> ADD [COLUMN] <col>[:type] [type] [DEFAULT <значение>] [FIRST | AFTER <col>]
+// ALTER TABLE <table> DROP [COLUMN] <col>
+// ALTER TABLE <table> RENAME [COLUMN] <col> TO <новое имя>
+// ALTER TABLE <table> MOVE [COLUMN] <col> FIRST | AFTER <col>
+// ALTER TABLE <table> ALTER [COLUMN] <col> TYPE <type> [FORCE]
+// ALTER TABLE <table> ADD|ALTER [COLUMN] <col> AS <выражение> — вычисляемая колонка
+//
+// FIRST — сразу после id. FORCE очищает значения, которые не удалось
+// преобразовать к новому типу; без него тип не меняется.
+
+type alterStmt struct {
+	table   string
+	action  string // add, drop, rename, move, type, compute, recompute
+	column  string
+	pos     int    // позиция имени колонки в запросе
+	newName string // RENAME ... TO
+	typ     string
+	def     expr   // ADD ... DEFAULT
+	after   string // ADD/MOVE ... AFTER
+	first   bool   // ADD/MOVE ... FIRST
+	force   bool
+	calc    expr   // ADD/ALTER ... AS
+	calcSrc string // текст выражения для метаданных
+}
+
+func (*alterStmt) statementNode() {}
+
+func (p *parser) parseAlter() (*alterStmt, error) {
+	if err := p.expectKeyword("table"); err != nil {
+		return nil, err
+	}
+	table, err := p.name("имя таблицы")
+	if err != nil {
+		return nil, err
+	}
+	st := &alterStmt{table: table}
+	actTok := p.tok
+	switch {
+	case p.acceptKeyword("add"):
+		st.action = "add"
+	case p.acceptKeyword("drop"):
+		st.action = "drop"
+	case p.acceptKeyword("rename"):
+		st.action = "rename"
+	case p.acceptKeyword("move"):
+		st.action = "move"
+	case p.acceptKeyword("alter"):
+		st.action = "type"
+	default:
+		return nil, p.errorf(actTok, "ожидалось ADD, DROP, RENAME, MOVE или ALTER, найдено %s", actTok)
+	}
+	p.acceptKeyword("column")
+	st.pos = p.tok.pos
+	if st.column, err = p.name("имя колонки"); err != nil {
+		return nil, err
+	}
+
+	if (st.action == "add" || st.action == "type") && p.isKeyword("as") {
+		p.advance()
+		start := p.tok
+		if st.calc, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+		st.calcSrc = p.sourceText(start.pos, p.prevEnd)
+		st.action = map[string]string{"add": "compute", "type": "recompute"}[st.action]
+		return st, nil
+	}
+
+	switch st.action {
+	case "add":
+		// тип через двоеточие, как в CREATE: phone:text
+		if name, typ, ok := strings.Cut(st.column, ":"); ok {
+			st.column, st.typ = name, strings.ToLower(typ)
+		} else if p.acceptOp(":") {
+			if st.typ, err = p.name("тип колонки"); err != nil {
+				return nil, err
+			}
+		} else if p.tok.kind == tokWord && isColumnType(strings.ToLower(p.tok.text)) {
+			st.typ = p.tok.text
+			p.advance()
+		}
+		if p.acceptKeyword("default") {
+			if st.def, err = p.parseExpr(); err != nil {
+				return nil, err
+			}
+		}
+		if err := p.parsePlacement(st, false); err != nil {
+			return nil, err
+		}
+	case "rename":
+		if err := p.expectKeyword("to"); err != nil {
+			return nil, err
+		}
+		if st.newName, err = p.name("новое имя колонки"); err != nil {
+			return nil, err
+		}
+	case "move":
+		if err := p.parsePlacement(st, true); err != nil {
+			return nil, err
+		}
+	case "type":
+		if err := p.expectKeyword("type"); err != nil {
+			return nil, err
+		}
+		if st.typ, err = p.name("тип колонки"); err != nil {
+			return nil, err
+		}
+		st.force = p.acceptKeyword("force")
+	}
+	st.typ = strings.ToLower(st.typ)
+	if st.typ != "" && !isColumnType(st.typ) {
+		return nil, p.errorf(p.tok, "неизвестный тип '%s' (доступны: %s)", st.typ, strings.Join(columnTypes, ", "))
+	}
+	return st, nil
+}
+
+// FIRST | AFTER <col>
+func (p *parser) parsePlacement(st *alterStmt, required bool) (err error) {
+	switch {
+	case p.acceptKeyword("first"):
+		st.first = true
+	case p.acceptKeyword("after"):
+		st.after, err = p.name("имя колонки")
+	case required:
+		err = p.errorf(p.tok, "ожидалось FIRST или AFTER, найдено %s", p.tok)
+	}
+	return err
+}
+
+// индекс колонки без учёта регистра, -1 — не найдена
+func columnIndex(header []string, name string) int {
+	for i, h := range header {
+		if strings.EqualFold(h, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// индекс колонки данных (не id) или ошибка
+func dataColumn(header []string, name string) (int, error) {
+	switch i := columnIndex(header, name); {
+	case i < 0:
+		return -1, fmt.Errorf("колонка '%s' не найдена", name)
+	case i == 0:
+		return -1, errors.New("колонку id изменять нельзя")
+	default:
+		return i, nil
+	}
+}
+
+func checkNewColumnName(header []string, name string, except int) error {
+	if strings.TrimSpace(name) == "" {
+		return errors.New("пустое имя колонки")
+	}
+	if i := columnIndex(header, name); i >= 0 && i != except {
+		return fmt.Errorf("колонка '%s' уже существует", header[i])
+	}
+	return nil
+}
+
+// позиция вставки/перемещения: 1 — сразу после id, по умолчанию — в конец
+func placement(header []string, first bool, after string, def int) (int, error) {
+	switch {
+	case first:
+		return 1, nil
+	case after != "":
+		i := columnIndex(header, after)
+		if i < 0 {
+			return -1, fmt.Errorf("колонка '%s' не найдена", after)
+		}
+		return i + 1, nil
+	}
+	return def, nil
+}
+
+func insertAt(row []string, at int, v string) []string {
+	row = append(row, "")
+	copy(row[at+1:], row[at:])
+	row[at] = v
+	return row
+}
+
+func removeAt(row []string, at int) []string {
+	return append(row[:at], row[at+1:]...)
+}
+
+// --- Операции над файлом таблицы ---
+
+func addColumn(fileName, name, typ, def string, first bool, after string) error {
+	data, err := readTableData(fileName)
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return errors.New("таблица без заголовка")
+	}
+	name = strings.TrimSpace(name)
+	if err := checkNewColumnName(data[0], name, -1); err != nil {
+		return err
+	}
+	tm, err := getTableMeta(fileName)
+	if err != nil {
+		return err
+	}
+	if computedIndex(tm.Computed, name) >= 0 {
+		return fmt.Errorf("вычисляемая колонка '%s' уже существует", name)
+	}
+	if typ != "" {
+		if err := checkValueType(typ, def); err != nil {
+			return fmt.Errorf("значение по умолчанию: %w", err)
+		}
+	}
+	at, err := placement(data[0], first, after, len(data[0]))
+	if err != nil {
+		return err
+	}
+	data[0] = insertAt(data[0], at, name)
+	for r := 1; r < len(data); r++ {
+		data[r] = insertAt(data[r], at, def)
+	}
+	if err := saveTableData(fileName, data); err != nil {
+		return err
+	}
+	return setColumnTypes(fileName, map[string]string{name: typ})
+}
+
+func dropColumn(fileName, name string) error {
+	data, err := readTableData(fileName)
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return errors.New("таблица без заголовка")
+	}
+	idx, err := dataColumn(data[0], name)
+	if err != nil {
+		return err
+	}
+	col := data[0][idx]
+	if err := checkNoDependents(fileName, col); err != nil {
+		return err
+	}
+	for r := range data {
+		data[r] = removeAt(data[r], idx)
+	}
+	if err := saveTableData(fileName, data); err != nil {
+		return err
+	}
+	return updateTableMeta(fileName, func(tm *tableMeta) bool {
+		delete(tm.Types, col)
+		return true
+	})
+}
+
+func renameColumn(fileName, oldName, newName string) error {
+	data, err := readTableData(fileName)
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return errors.New("таблица без заголовка")
+	}
+	idx, err := dataColumn(data[0], oldName)
+	if err != nil {
+		return err
+	}
+	newName = strings.TrimSpace(newName)
+	if err := checkNewColumnName(data[0], newName, idx); err != nil {
+		return err
+	}
+	old := data[0][idx]
+	if old == newName {
+		return nil
+	}
+	tm, err := getTableMeta(fileName)
+	if err != nil {
+		return err
+	}
+	if computedIndex(tm.Computed, newName) >= 0 {
+		return fmt.Errorf("вычисляемая колонка '%s' уже существует", newName)
+	}
+	if !strings.EqualFold(old, newName) {
+		if err := checkNoDependents(fileName, old); err != nil {
+			return err
+		}
+	}
+	data[0][idx] = newName
+	if err := saveTableData(fileName, data); err != nil {
+		return err
+	}
+	return updateTableMeta(fileName, func(tm *tableMeta) bool {
+		if typ, ok := tm.Types[old]; ok {
+			delete(tm.Types, old)
+			tm.Types[newName] = typ
+		}
+		return true
+	})
+}
+
+func moveColumn(fileName, name string, first bool, after string) error {
+	data, err := readTableData(fileName)
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return errors.New("таблица без заголовка")
+	}
+	from, err := dataColumn(data[0], name)
+	if err != nil {
+		return err
+	}
+	to, err := placement(data[0], first, after, from)
+	if err != nil {
+		return err
+	}
+	if to > from {
+		to-- // после удаления колонки индексы правее сдвигаются
+	}
+	if to == from {
+		return nil
+	}
+	for r := range data {
+		v := data[r][from]
+		data[r] = insertAt(removeAt(data[r], from), to, v)
+	}
+	return saveTableData(fileName, data)
+}
+
+// значение в представлении нового типа; допустимые значения не меняются
+func convertValue(typ, v string) (string, error) {
+	err := checkValueType(typ, v)
+	if err == nil {
+		return v, nil
+	}
+	if typ == typeInt {
+		if n, perr := parseNumber(v); perr == nil && n == math.Trunc(n) && math.Abs(n) < 1e15 {
+			return strconv.FormatInt(int64(n), 10), nil
+		}
+	}
+	return v, err
+}
+
+// Смена типа колонки. Возвращает число преобразованных значений и
+// отчёт о непреобразуемых; без force при ошибках файл не меняется.
+func retypeColumn(fileName, name, typ string, force bool) (converted int, report []verifyIssue, err error) {
+	data, err := readTableData(fileName)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(data) == 0 {
+		return 0, nil, errors.New("таблица без заголовка")
+	}
+	idx, err := dataColumn(data[0], name)
+	if err != nil {
+		return 0, nil, err
+	}
+	table := filepath.Base(fileName)
+	for r := 1; r < len(data); r++ {
+		v, cerr := convertValue(typ, data[r][idx])
+		switch {
+		case cerr != nil:
+			msg := cerr.Error()
+			if force {
+				msg += " — значение очищено"
+				v = ""
+			}
+			report = append(report, verifyIssue{Table: table, Row: r, Col: idx, Msg: msg})
+		case v != data[r][idx]:
+			converted++
+		}
+		data[r][idx] = v
+	}
+	if len(report) > 0 && !force {
+		return 0, report, nil
+	}
+	if converted > 0 || len(report) > 0 {
+		if err := saveTableData(fileName, data); err != nil {
+			return 0, report, err
+		}
+	}
+	return converted, report, setColumnTypes(fileName, map[string]string{data[0][idx]: typ})
+}
+
+func execAlter(st *alterStmt) (*queryResult, error) {
+	fileName := tableFile(st.table)
+	if !tableExists(fileName) {
+		return nil, fmt.Errorf("таблица '%s' не найдена", st.table)
+	}
+	var msg string
+	var report []verifyIssue
+	tm, err := getTableMeta(fileName)
+	if err != nil {
+		return nil, err
+	}
+	computed := computedIndex(tm.Computed, st.column) >= 0
+	if computed {
+		switch st.action {
+		case "drop", "rename", "recompute":
+		case "move":
+			return nil, fmt.Errorf("вычисляемую колонку '%s' нельзя перемещать: она всегда после колонок файла", st.column)
+		case "type":
+			return nil, fmt.Errorf("у вычисляемой колонки '%s' нет типа; измените выражение через ALTER ... AS", st.column)
+		default:
+			return nil, fmt.Errorf("колонка '%s' уже существует", st.column)
+		}
+	}
+	switch st.action {
+	case "compute", "recompute":
+		if st.calc == nil {
+			e, err := parseComputedExpr(st.calcSrc)
+			if err != nil {
+				return nil, err
+			}
+			st.calc = e
+		}
+		if err := defineComputed(fileName, st.column, st.calc, st.calcSrc, st.action == "recompute"); err != nil {
+			return nil, err
+		}
+		msg = fmt.Sprintf("Вычисляемая колонка %s = %s", st.column, st.calcSrc)
+	case "add":
+		def := ""
+		if st.def != nil {
+			v, err := exprString(st.def, &rowEnv{scope: &columnScope{}})
+			if err != nil {
+				return nil, err
+			}
+			def = v
+		}
+		if err := addColumn(fileName, st.column, st.typ, def, st.first, st.after); err != nil {
+			return nil, err
+		}
+		msg = "Добавлена колонка " + st.column
+	case "drop":
+		drop := dropColumn
+		if computed {
+			drop = dropComputed
+		}
+		if err := drop(fileName, st.column); err != nil {
+			return nil, err
+		}
+		msg = "Удалена колонка " + st.column
+	case "rename":
+		rename := renameColumn
+		if computed {
+			rename = renameComputed
+		}
+		if err := rename(fileName, st.column, st.newName); err != nil {
+			return nil, err
+		}
+		msg = fmt.Sprintf("Колонка %s переименована в %s", st.column, st.newName)
+	case "move":
+		if err := moveColumn(fileName, st.column, st.first, st.after); err != nil {
+			return nil, err
+		}
+		msg = "Перемещена колонка " + st.column
+	case "type":
+		converted, rep, err := retypeColumn(fileName, st.column, st.typ, st.force)
+		if err != nil {
+			return nil, err
+		}
+		report = rep
+		switch {
+		case len(rep) > 0 && !st.force:
+			msg = fmt.Sprintf("Тип колонки %s не изменён: не удалось преобразовать значений %d (FORCE очистит их)", st.column, len(rep))
+		case len(rep) > 0:
+			msg = fmt.Sprintf("Колонка %s: тип %s, преобразовано значений %d, очищено %d", st.column, st.typ, converted, len(rep))
+		default:
+			msg = fmt.Sprintf("Колонка %s: тип %s, преобразовано значений %d", st.column, st.typ, converted)
+		}
+	}
+	data, err := readTableData(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return &queryResult{Table: fileName, Data: data, Message: msg, Issues: report}, nil
+}
@@ -0,0 +1,431 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// --- Арифметика, функции и CASE ---
+//
+// + - * / % — над числами; || — склейка строк. Дата ± число — сдвиг на
+// дни, дата - дата — разница в днях. Дефис перед буквой остаётся частью
+// имени: a-b — колонка, её не вычесть без пробелов (a - b), а age-1 —
+// вычитание. NULL в любом операнде даёт NULL, деление на ноль — тоже NULL.
+//
+// CASE WHEN <условие> THEN <x> ... [ELSE <y>] END
+// CASE <x> WHEN <значение> THEN <y> ... [ELSE <z>] END
+
+type arithExpr struct {
+	op   string // + - * / % ||
+	l, r expr
+	pos  int
+}
+
+type funcExpr struct {
+	name string
+	args []expr
+	pos  int
+}
+
+type caseExpr struct {
+	subject expr // CASE x WHEN ...; nil — CASE WHEN <условие>
+	whens   []caseWhen
+	orElse  expr
+}
+
+type caseWhen struct {
+	cond, then expr
+}
+
+func (p *parser) parseAdditive() (expr, error) {
+	l, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == tokOp && (p.tok.text == "+" || p.tok.text == "-" || p.tok.text == "||") {
+		op := p.tok
+		p.advance()
+		r, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		l = &arithExpr{op: op.text, l: l, r: r, pos: op.pos}
+	}
+	return l, nil
+}
+
+func (p *parser) parseMultiplicative() (expr, error) {
+	l, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == tokOp && (p.tok.text == "*" || p.tok.text == "/" || p.tok.text == "%") {
+		op := p.tok
+		p.advance()
+		r, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		l = &arithExpr{op: op.text, l: l, r: r, pos: op.pos}
+	}
+	return l, nil
+}
+
+func (e *arithExpr) eval(env *rowEnv) (value, error) {
+	l, err := e.l.eval(env)
+	if err != nil {
+		return nullValue, err
+	}
+	r, err := e.r.eval(env)
+	if err != nil {
+		return nullValue, err
+	}
+	if l.isNull() || r.isNull() {
+		return nullValue, nil
+	}
+	if e.op == "||" {
+		return textValue(l.String() + r.String()), nil
+	}
+	x, okL := l.number()
+	y, okR := r.number()
+	if okL && okR {
+		switch e.op {
+		case "+":
+			return numberValue(x + y), nil
+		case "-":
+			return numberValue(x - y), nil
+		case "*":
+			return numberValue(x * y), nil
+		case "/":
+			if y == 0 {
+				return nullValue, nil
+			}
+			return numberValue(x / y), nil
+		case "%":
+			if y == 0 {
+				return nullValue, nil
+			}
+			return numberValue(math.Mod(x, y)), nil
+		}
+	}
+	// арифметика дат
+	ld, lerr := dateOf(l)
+	rd, rerr := dateOf(r)
+	switch {
+	case e.op == "+" && lerr == nil && okR:
+		return dateValue(ld.AddDate(0, 0, int(y))), nil
+	case e.op == "+" && okL && rerr == nil:
+		return dateValue(rd.AddDate(0, 0, int(x))), nil
+	case e.op == "-" && lerr == nil && okR:
+		return dateValue(ld.AddDate(0, 0, -int(y))), nil
+	case e.op == "-" && lerr == nil && rerr == nil:
+		return numberValue(math.Round(ld.Sub(rd).Hours() / 24)), nil
+	}
+	bad := l
+	if okL {
+		bad = r
+	}
+	hint := ""
+	if e.op == "+" {
+		hint = "; строки склеиваются через ||"
+	}
+	return nullValue, &queryError{pos: e.pos, msg: fmt.Sprintf("операция %s: '%s' не является числом или датой%s", e.op, bad, hint)}
+}
+
+func dateOf(v value) (time.Time, error) {
+	if v.kind != valText {
+		return time.Time{}, fmt.Errorf("'%s' не является датой", v)
+	}
+	return parseDate(v.s)
+}
+
+func dateValue(t time.Time) value {
+	return textValue(t.Format(dateLayouts[0]))
+}
+
+// --- Функции ---
+
+type scalarFunc struct {
+	min, max int // число аргументов; max < 0 — без ограничения
+	fn       func(args []value) (value, error)
+}
+
+var scalarFuncs map[string]scalarFunc
+
+func init() {
+	scalarFuncs = map[string]scalarFunc{
+		"upper":  {1, 1, textFunc(strings.ToUpper)},
+		"lower":  {1, 1, textFunc(strings.ToLower)},
+		"trim":   {1, 1, textFunc(func(s string) string { return strings.TrimFunc(s, unicode.IsSpace) })},
+		"length": {1, 1, fnLength},
+		"substr": {2, 3, fnSubstr},
+		"replace": {3, 3, func(a []value) (value, error) {
+			if a[0].isNull() {
+				return nullValue, nil
+			}
+			return textValue(strings.ReplaceAll(a[0].String(), a[1].String(), a[2].String())), nil
+		}},
+		"concat": {1, -1, func(a []value) (value, error) {
+			var b strings.Builder
+			for _, v := range a {
+				b.WriteString(v.String())
+			}
+			return textValue(b.String()), nil
+		}},
+		"round":      {1, 2, fnRound},
+		"abs":        {1, 1, numFunc(math.Abs)},
+		"floor":      {1, 1, numFunc(math.Floor)},
+		"ceil":       {1, 1, numFunc(math.Ceil)},
+		"coalesce":   {1, -1, fnCoalesce},
+		"if":         {3, 3, nil}, // ветки вычисляются в funcExpr.eval
+		"today":      {0, 0, func([]value) (value, error) { return dateValue(time.Now()), nil }},
+		"year":       {1, 1, datePart(func(t time.Time) int { return t.Year() })},
+		"month":      {1, 1, datePart(func(t time.Time) int { return int(t.Month()) })},
+		"day":        {1, 1, datePart(func(t time.Time) int { return t.Day() })},
+		"add_months": {2, 2, fnAddMonths},
+	}
+}
+
+// name( аргументы ) — имя уже прочитано
+func (p *parser) parseFunc(name token) (expr, error) {
+	e := &funcExpr{name: strings.ToLower(name.text), pos: name.pos}
+	f := scalarFuncs[e.name]
+	if err := p.expectOp("("); err != nil {
+		return nil, err
+	}
+	if !p.acceptOp(")") {
+		for {
+			arg, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			e.args = append(e.args, arg)
+			if !p.acceptOp(",") {
+				break
+			}
+		}
+		if err := p.expectOp(")"); err != nil {
+			return nil, err
+		}
+	}
+	if len(e.args) < f.min || f.max >= 0 && len(e.args) > f.max {
+		want := fmt.Sprintf("%d", f.min)
+		switch {
+		case f.max < 0:
+			want = fmt.Sprintf("не меньше %d", f.min)
+		case f.max != f.min:
+			want = fmt.Sprintf("от %d до %d", f.min, f.max)
+		}
+		return nil, p.errorf(name, "%s: ожидалось аргументов %s, получено %d", strings.ToUpper(e.name), want, len(e.args))
+	}
+	return e, nil
+}
+
+func (e *funcExpr) eval(env *rowEnv) (value, error) {
+	// IF, как CASE, вычисляет только выбранную ветку:
+	// IF(b = 0, 0, a / b) не делит на ноль
+	if e.name == "if" {
+		c, err := e.args[0].eval(env)
+		if err != nil {
+			return nullValue, err
+		}
+		if c.truthy() {
+			return e.args[1].eval(env)
+		}
+		return e.args[2].eval(env)
+	}
+	args := make([]value, len(e.args))
+	for i, a := range e.args {
+		v, err := a.eval(env)
+		if err != nil {
+			return nullValue, err
+		}
+		args[i] = v
+	}
+	v, err := scalarFuncs[e.name].fn(args)
+	if err != nil {
+		return nullValue, &queryError{pos: e.pos, msg: fmt.Sprintf("%s: %v", strings.ToUpper(e.name), err)}
+	}
+	return v, nil
+}
+
+func textFunc(f func(string) string) func([]value) (value, error) {
+	return func(a []value) (value, error) {
+		if a[0].isNull() {
+			return nullValue, nil
+		}
+		return textValue(f(a[0].String())), nil
+	}
+}
+
+func numFunc(f func(float64) float64) func([]value) (value, error) {
+	return func(a []value) (value, error) {
+		if a[0].isNull() {
+			return nullValue, nil
+		}
+		n, ok := a[0].number()
+		if !ok {
+			return nullValue, fmt.Errorf("'%s' не является числом", a[0])
+		}
+		return numberValue(f(n)), nil
+	}
+}
+
+func datePart(f func(time.Time) int) func([]value) (value, error) {
+	return func(a []value) (value, error) {
+		if a[0].isNull() {
+			return nullValue, nil
+		}
+		t, err := dateOf(a[0])
+		if err != nil {
+			return nullValue, err
+		}
+		return numberValue(float64(f(t))), nil
+	}
+}
+
+func fnLength(a []value) (value, error) {
+	if a[0].isNull() {
+		return numberValue(0), nil
+	}
+	return numberValue(float64(len([]rune(a[0].String())))), nil
+}
+
+// SUBSTR(s, начало[, длина]); начало — с 1
+func fnSubstr(a []value) (value, error) {
+	if a[0].isNull() {
+		return nullValue, nil
+	}
+	rs := []rune(a[0].String())
+	start, ok := a[1].number()
+	if !ok {
+		return nullValue, fmt.Errorf("начало '%s' не является числом", a[1])
+	}
+	from := max(int(start)-1, 0)
+	to := len(rs)
+	if len(a) == 3 {
+		n, ok := a[2].number()
+		if !ok || n < 0 {
+			return nullValue, fmt.Errorf("длина '%s' должна быть неотрицательным числом", a[2])
+		}
+		to = min(from+int(n), len(rs))
+	}
+	if from >= len(rs) || from >= to {
+		return textValue(""), nil
+	}
+	return textValue(string(rs[from:to])), nil
+}
+
+func fnRound(a []value) (value, error) {
+	if a[0].isNull() {
+		return nullValue, nil
+	}
+	n, ok := a[0].number()
+	if !ok {
+		return nullValue, fmt.Errorf("'%s' не является числом", a[0])
+	}
+	digits := 0.0
+	if len(a) == 2 {
+		if digits, ok = a[1].number(); !ok {
+			return nullValue, fmt.Errorf("число знаков '%s' не является числом", a[1])
+		}
+	}
+	k := math.Pow(10, math.Trunc(digits))
+	return numberValue(math.Round(n*k) / k), nil
+}
+
+func fnCoalesce(a []value) (value, error) {
+	for _, v := range a {
+		if !v.isNull() {
+			return v, nil
+		}
+	}
+	return nullValue, nil
+}
+
+func fnAddMonths(a []value) (value, error) {
+	if a[0].isNull() || a[1].isNull() {
+		return nullValue, nil
+	}
+	t, err := dateOf(a[0])
+	if err != nil {
+		return nullValue, err
+	}
+	n, ok := a[1].number()
+	if !ok {
+		return nullValue, fmt.Errorf("'%s' не является числом", a[1])
+	}
+	// 31 января + 1 месяц — последний день февраля, а не 2 марта
+	first := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location()).AddDate(0, int(n), 0)
+	last := first.AddDate(0, 1, -1).Day()
+	return dateValue(first.AddDate(0, 0, min(t.Day(), last)-1)), nil
+}
+
+// --- CASE ---
+
+// CASE уже прочитан
+func (p *parser) parseCase() (expr, error) {
+	e := &caseExpr{}
+	if !p.isKeyword("when") {
+		subject, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		e.subject = subject
+	}
+	for p.acceptKeyword("when") {
+		var w caseWhen
+		var err error
+		if w.cond, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("then"); err != nil {
+			return nil, err
+		}
+		if w.then, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+		e.whens = append(e.whens, w)
+	}
+	if len(e.whens) == 0 {
+		return nil, p.errorf(p.tok, "CASE: ожидалось WHEN, найдено %s", p.tok)
+	}
+	if p.acceptKeyword("else") {
+		var err error
+		if e.orElse, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	return e, p.expectKeyword("end")
+}
+
+func (e *caseExpr) eval(env *rowEnv) (value, error) {
+	var subject value
+	if e.subject != nil {
+		v, err := e.subject.eval(env)
+		if err != nil {
+			return nullValue, err
+		}
+		subject = v
+	}
+	for _, w := range e.whens {
+		c, err := w.cond.eval(env)
+		if err != nil {
+			return nullValue, err
+		}
+		hit := c.truthy()
+		if e.subject != nil {
+			hit = !subject.isNull() && !c.isNull() && compareValues(subject, c) == 0
+		}
+		if hit {
+			return w.then.eval(env)
+		}
+	}
+	if e.orElse == nil {
+		return nullValue, nil
+	}
+	return e.orElse.eval(env)
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// --- Командная строка без окна ---
+//
+// csvdb query  [флаги] "<команда>" ...       любые команды, как в поле ввода
+// csvdb create [флаги] <table> <col[:type]> ...
+// csvdb insert [флаги] <table> col=значение ... | значение ...
+// csvdb verify [флаги] [-fix] [table]
+// csvdb run    [флаги] [-continue] <скрипт.csvql>
+// csvdb repl   [флаги]                        интерактивный режим (repl.go)
+// cat f.csv | csvdb select [-cols ...] "<условие>"   фильтр stdin (filter.go)
+// csvdb serve  [флаги] [-addr адрес] [-token токен]   HTTP API (server.go)
+//
+// Флаги: -dir <папка с таблицами>, -format table|csv|tsv|json. Данные
+// пишутся в stdout, ошибки — в stderr; сообщения команд в форматах csv,
+// tsv и json тоже идут в stderr, чтобы не портить вывод. Пароль зашифрованных
+// таблиц берётся из CSVDB_PASSWORD, новый пароль для PASSWD — из
+// CSVDB_NEW_PASSWORD. Коды выхода: 0 — успех, 1 — ошибка выполнения,
+// 2 — неверные аргументы или синтаксис, 3 — VERIFY нашёл проблемы.
+
+const (
+	exitOK = iota
+	exitFailed
+	exitUsage
+	exitIssues
+)
+
+const (
+	passwordEnv    = "CSVDB_PASSWORD"
+	newPasswordEnv = "CSVDB_NEW_PASSWORD"
+)
+
+const cliUsage = `Использование: csvdb <команда> [флаги] [аргументы]
+Без команды открывается окно приложения.
+
+  query  "<команда>" ...            выполнить команды (SELECT, FIND, INSERT, ALTER ...)
+  create <table> <col[:type]> ...   создать таблицу
+  insert <table> col=значение ...   добавить строку (или значения по порядку колонок)
+  verify [-fix] [table]             проверить целостность
+  run    [-continue] <файл.csvql>   выполнить скрипт
+  repl                              интерактивный режим с историей и дополнением
+  select [-cols ...] "<условие>"    фильтр: CSV из stdin через WHERE/ORDER BY/LIMIT в stdout
+                                    (-cols "name, age", -in csv|tsv; вывод по умолчанию csv)
+  serve  [-addr адрес] [-token т]   HTTP API к таблицам (по умолчанию 127.0.0.1:8484;
+                                    токен из -token, CSVDB_TOKEN или создаётся при запуске)
+
+Флаги:
+  -dir <папка>                 папка с таблицами (по умолчанию текущая)
+  -format table|csv|tsv|json   формат вывода (по умолчанию table)
+
+Пароль зашифрованных таблиц: переменная CSVDB_PASSWORD.
+Коды выхода: 0 — успех, 1 — ошибка выполнения, 2 — неверные аргументы
+или синтаксис, 3 — VERIFY нашёл проблемы.
+`
+
+var cliCommands = map[string]bool{"query": true, "create": true, "insert": true, "verify": true, "run": true, "repl": true, "select": true, "serve": true, "help": true}
+
+// запуск без окна: первый аргумент — команда командной строки
+func isCLI(args []string) bool {
+	return len(args) > 0 && (cliCommands[args[0]] || args[0] == "-h" || args[0] == "--help")
+}
+
+type cliOptions struct {
+	dir    string
+	format string
+	fix    bool   // verify -fix
+	cont   bool   // run -continue
+	cols   string // select -cols
+	in     string // select -in
+	addr   string // serve -addr
+	token  string // serve -token
+}
+
+func runCLI(args []string, stdout, stderr io.Writer) int {
+	defer waitHooks() // команды хуков выполняются в фоне
+	cmd := args[0]
+	if cmd == "help" || cmd == "-h" || cmd == "--help" {
+		fmt.Fprint(stdout, cliUsage)
+		return exitOK
+	}
+	fs := flag.NewFlagSet("csvdb "+cmd, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	opt := cliOptions{}
+	fs.StringVar(&opt.dir, "dir", ".", "папка с таблицами")
+	format := "table"
+	if cmd == "select" {
+		format = "csv"
+	}
+	fs.StringVar(&opt.format, "format", format, "формат вывода: table, csv, tsv или json")
+	switch cmd {
+	case "verify":
+		fs.BoolVar(&opt.fix, "fix", false, "исправить найденные проблемы")
+	case "run":
+		fs.BoolVar(&opt.cont, "continue", false, "не останавливаться на ошибках")
+	case "select":
+		fs.StringVar(&opt.cols, "cols", "*", "колонки и выражения результата")
+		fs.StringVar(&opt.in, "in", "csv", "формат ввода: csv или tsv")
+	case "serve":
+		fs.StringVar(&opt.addr, "addr", apiAddr, "адрес HTTP API")
+		fs.StringVar(&opt.token, "token", "", "токен доступа (по умолчанию CSVDB_TOKEN или случайный)")
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	switch opt.format {
+	case "table", "csv", "tsv", "json":
+	default:
+		fmt.Fprintf(stderr, "csvdb: неизвестный формат '%s' (доступны: table, csv, tsv, json)\n", opt.format)
+		return exitUsage
+	}
+	if cmd == "select" {
+		return runSelectCLI(fs.Args(), stderr, opt)
+	}
+	var stmts []statement
+	if cmd != "repl" && cmd != "serve" {
+		var err error
+		if stmts, err = cliStatements(cmd, fs.Args(), opt); err != nil {
+			fmt.Fprintln(stderr, "csvdb:", err)
+			return exitUsage
+		}
+	} else if fs.NArg() > 0 {
+		fmt.Fprintf(stderr, "csvdb: %s не принимает аргументов\n", cmd)
+		return exitUsage
+	}
+	if err := os.Chdir(opt.dir); err != nil {
+		fmt.Fprintln(stderr, "csvdb:", err)
+		return exitFailed
+	}
+	unlockWithEnv()
+	switch cmd {
+	case "repl":
+		return runREPL(stdout, stderr, opt)
+	case "serve":
+		return runServeCLI(stdout, stderr, opt)
+	}
+
+	code := exitOK
+	for i, st := range stmts {
+		res, err := execCLI(st)
+		var se *scriptError
+		if errors.As(err, &se) {
+			res = se.res // журнал до ошибки
+		}
+		if res != nil {
+			if i > 0 && opt.format == "table" {
+				fmt.Fprintln(stdout)
+			}
+			if perr := printResult(stdout, stderr, res, opt.format); perr != nil {
+				fmt.Fprintln(stderr, "csvdb:", perr)
+				return exitFailed
+			}
+			if len(res.Issues) > 0 {
+				code = exitIssues
+			}
+		}
+		if err != nil {
+			fmt.Fprintln(stderr, "csvdb:", err)
+			return exitFailed
+		}
+	}
+	return code
+}
+
+// операторы для команды командной строки
+func cliStatements(cmd string, args []string, opt cliOptions) ([]statement, error) {
+	switch cmd {
+	case "query":
+		if len(args) == 0 {
+			return nil, errors.New(`укажите команду: csvdb query "select * from people"`)
+		}
+		var out []statement
+		for _, q := range args {
+			st, err := parseQuery(q)
+			if err != nil {
+				var qe *queryError
+				if errors.As(err, &qe) {
+					return nil, fmt.Errorf("%v\n%s", err, qe.caret(q))
+				}
+				return nil, err
+			}
+			out = append(out, st)
+		}
+		return out, nil
+	case "create":
+		if len(args) < 2 {
+			return nil, errors.New("укажите таблицу и колонки: csvdb create people name age:int")
+		}
+		return []statement{&createStmt{table: args[0], columns: args[1:]}}, nil
+	case "insert":
+		if len(args) < 2 {
+			return nil, errors.New("укажите таблицу и значения: csvdb insert people name=Анна age=30")
+		}
+		st := &insertStmt{table: args[0]}
+		var row []expr
+		for _, a := range args[1:] {
+			col, val, named := strings.Cut(a, "=")
+			if len(row) > 0 && named != (len(st.columns) > 0) {
+				return nil, errors.New("значения задаются либо все как колонка=значение, либо все по порядку колонок")
+			}
+			if named {
+				st.columns = append(st.columns, strings.TrimSpace(col))
+				st.colPos = append(st.colPos, -1)
+			} else {
+				val = a
+			}
+			row = append(row, &literalExpr{v: textValue(val)})
+		}
+		st.rows = [][]expr{row}
+		return []statement{st}, nil
+	case "verify":
+		if len(args) > 1 {
+			return nil, errors.New("укажите не больше одной таблицы")
+		}
+		st := &verifyStmt{fix: opt.fix}
+		if len(args) == 1 {
+			st.table = args[0]
+		}
+		return []statement{st}, nil
+	case "run":
+		if len(args) != 1 {
+			return nil, errors.New("укажите файл скрипта: csvdb run setup.csvql")
+		}
+		return []statement{&sourceStmt{file: args[0], cont: opt.cont}}, nil
+	}
+	return nil, fmt.Errorf("неизвестная команда %s", cmd)
+}
+
+// разблокировать зашифрованные таблицы паролем из окружения
+func unlockWithEnv() {
+	pass := os.Getenv(passwordEnv)
+	if pass == "" {
+		return
+	}
+	for _, f := range listTables(".") {
+		if isEncryptedFile(f) {
+			_ = unlockTable(f, pass) // другой пароль — таблица останется заблокированной
+		}
+	}
+}
+
+// команды с паролем берут его из окружения вместо диалога
+func execCLI(st statement) (*queryResult, error) {
+	ks, ok := st.(*keyStmt)
+	if !ok || ks.cmd == "lock" {
+		return execStatement(st)
+	}
+	pass := os.Getenv(passwordEnv)
+	if pass == "" {
+		return nil, fmt.Errorf("команда %s: задайте пароль в %s", strings.ToUpper(ks.cmd), passwordEnv)
+	}
+	fileName := tableFile(ks.table)
+	var err error
+	var msg string
+	switch ks.cmd {
+	case "encrypt":
+		err, msg = encryptTable(ks.table, pass), "зашифрована"
+	case "decrypt":
+		err, msg = decryptTable(ks.table, pass), "расшифрована"
+	case "passwd":
+		newPass := os.Getenv(newPasswordEnv)
+		if newPass == "" {
+			return nil, fmt.Errorf("команда PASSWD: задайте новый пароль в %s", newPasswordEnv)
+		}
+		err, msg = changeTablePassphrase(ks.table, pass, newPass), "получила новый пароль"
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &queryResult{Table: fileName, Message: "Таблица " + fileName + " " + msg}, nil
+}
+
+// --- Вывод результата ---
+
+func printResult(stdout, stderr io.Writer, res *queryResult, format string) error {
+	data := res.Data
+	if len(res.Issues) > 0 {
+		data = issuesData(res.Issues)
+	}
+	msgOut := stderr
+	if format == "table" {
+		msgOut = stdout
+	}
+	var err error
+	switch {
+	case data == nil && format == "json":
+		err = json.NewEncoder(stdout).Encode(map[string]any{"message": res.Message, "affected": res.Affected})
+		return err
+	case data == nil:
+	case format == "table":
+		err = writeAligned(stdout, data)
+	default:
+		err = writeRows(stdout, data, format)
+	}
+	if err != nil {
+		return err
+	}
+	if res.Message != "" {
+		_, err = fmt.Fprintln(msgOut, res.Message)
+	}
+	return err
+}
+
+func issuesData(issues []verifyIssue) [][]string {
+	data := [][]string{{"таблица", "строка", "колонка", "проблема"}}
+	pos := func(n int) string {
+		if n < 0 {
+			return ""
+		}
+		return strconv.Itoa(n)
+	}
+	for _, is := range issues {
+		data = append(data, []string{is.Table, pos(is.Row), pos(is.Col), is.Msg})
+	}
+	return data
+}
+
+// таблица с выровненными колонками и чертой под заголовком
+func writeAligned(w io.Writer, data [][]string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	clean := strings.NewReplacer("\t", " ", "\n", " ", "\r", " ")
+	line := func(row []string) {
+		for i, c := range row {
+			if i > 0 {
+				fmt.Fprint(tw, "\t")
+			}
+			fmt.Fprint(tw, clean.Replace(c))
+		}
+		fmt.Fprint(tw, "\n")
+	}
+	if len(data) > 0 {
+		line(data[0])
+		dashes := make([]string, len(data[0]))
+		for i, h := range data[0] {
+			dashes[i] = strings.Repeat("-", max(len([]rune(h)), 1))
+		}
+		line(dashes)
+	}
+	for _, row := range data[1:] {
+		line(row)
+	}
+	return tw.Flush()
+}
+
+// данные целиком через построчный вывод фильтра
+func writeRows(w io.Writer, data [][]string, format string) error {
+	rw := newRowWriter(w, format)
+	if err := rw.header(data[0]); err != nil {
+		return err
+	}
+	for _, row := range data[1:] {
+		if err := rw.row(row); err != nil {
+			return err
+		}
+	}
+	return rw.close()
+}
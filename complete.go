@@ -0,0 +1,244 @@
+package main
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// --- Автодополнение команды ---
+//
+// По тексту до курсора определяется дописываемое слово и что уместно
+// на его месте: команда в начале строки, имя таблицы после FROM, JOIN,
+// INTO, UPDATE, TABLE, FIND и т. п., имя представления после OPEN/DROP
+// VIEW, иначе — колонки упомянутых в команде таблиц, ключевые слова и
+// функции. После "псевдоним." предлагаются колонки этой таблицы.
+
+const completionLimit = 30
+
+var statementKeywords = []string{
+	"select", "insert", "update", "delete", "find", "create", "alter", "drop",
+	"truncate", "rename", "copy", "open", "dry", "set", "verify",
+	"encrypt", "decrypt", "passwd", "lock", "hooks", "script", "source",
+}
+
+// ключевые слова внутри команд (кроме reservedWords)
+var clauseKeywords = []string{
+	"into", "table", "view", "add", "column", "type", "to", "first", "after",
+	"default", "force", "if", "exists", "fix", "nocase", "run", "replace",
+	"move", "fuzzy", "translit", "hook", "log", "trust",
+}
+
+// после этих слов ожидается имя таблицы
+var tableContext = map[string]bool{
+	"from": true, "join": true, "into": true, "update": true, "table": true,
+	"truncate": true, "find": true, "verify": true, "encrypt": true,
+	"decrypt": true, "passwd": true, "lock": true,
+}
+
+type completion struct {
+	start int      // позиция (в рунах) начала заменяемой части
+	items []string // варианты по порядку предпочтения
+}
+
+// варианты для позиции cursor (в рунах) в тексте команды
+func complete(text string, cursor int) completion {
+	rs := []rune(text)
+	cursor = min(max(cursor, 0), len(rs))
+	start := cursor
+	for start > 0 && wordRuneAt(rs, start-1) {
+		start--
+	}
+	word := string(rs[start:cursor])
+
+	toks, ok := lexUntil(string(rs[:start]))
+	if !ok {
+		return completion{start: cursor} // курсор внутри строки или комментария
+	}
+	// таблицы ищутся во всей команде: FROM обычно идёт после колонок
+	aliases := tableAliases(toks)
+	if all, ok := lexUntil(text); ok {
+		aliases = tableAliases(all)
+	}
+
+	// после "псевдоним." — колонки таблицы
+	if i := strings.LastIndex(word, "."); i >= 0 && !strings.HasSuffix(strings.ToLower(word), ".csv") {
+		qual, prefix := word[:i], word[i+1:]
+		if table, found := aliases[strings.ToLower(qual)]; found {
+			cols, _ := tableColumns(tableFile(table))
+			return completion{start: start + len([]rune(qual)) + 1, items: matchPrefix(prefix, quoteNames(cols))}
+		}
+	}
+
+	var items []string
+	var prev, first string
+	if len(toks) > 0 {
+		first = strings.ToLower(toks[0].text)
+		if t := toks[len(toks)-1]; t.kind == tokWord {
+			prev = strings.ToLower(t.text)
+		}
+	}
+	switch {
+	case len(toks) == 0:
+		items = matchPrefix(word, keywordCase(word, statementKeywords))
+	case prev == "hook" && first == "drop":
+		items = matchPrefix(word, quoteNames(hookNames()))
+	case prev == "view" && (first == "open" || first == "drop"):
+		var views []string
+		for _, v := range listViews(".") {
+			views = append(views, strings.TrimSuffix(v, viewExt))
+		}
+		items = matchPrefix(word, quoteNames(views))
+	case tableContext[prev] || len(toks) == 1 && (first == "drop" || first == "rename" || first == "copy"):
+		items = matchPrefix(word, quoteNames(tableNames()))
+		if len(toks) == 1 {
+			items = append(items, matchPrefix(word, keywordCase(word, []string{"table", "view", "hook"}))...)
+		}
+	case first == "alter" && len(toks) == 1:
+		items = matchPrefix(word, keywordCase(word, []string{"table"}))
+	case first == "create" && len(toks) == 1:
+		items = matchPrefix(word, keywordCase(word, []string{"view", "hook", "or", "if"}))
+	default:
+		var tables, cols []string
+		for _, table := range aliases {
+			if !slices.Contains(tables, table) {
+				tables = append(tables, table)
+			}
+		}
+		sort.Strings(tables)
+		for _, table := range tables {
+			c, _ := tableColumns(tableFile(table))
+			cols = append(cols, c...)
+		}
+		items = matchPrefix(word, quoteNames(cols))
+		var kw []string
+		for w := range reservedWords {
+			kw = append(kw, w)
+		}
+		kw = append(kw, clauseKeywords...)
+		sort.Strings(kw)
+		items = append(items, matchPrefix(word, keywordCase(word, kw))...)
+		if word != "" {
+			var fns []string
+			for name := range scalarFuncs {
+				fns = append(fns, name)
+			}
+			for name := range aggregateFuncs {
+				fns = append(fns, name)
+			}
+			sort.Strings(fns)
+			items = append(items, matchPrefix(word, keywordCase(word, fns))...)
+		}
+	}
+	items = dedupFold(items)
+	if len(items) > completionLimit {
+		items = items[:completionLimit]
+	}
+	return completion{start: start, items: items}
+}
+
+// токены текста; false — текст обрывается внутри строки или комментария
+func lexUntil(text string) ([]token, bool) {
+	lx := newLexer(text)
+	var out []token
+	for {
+		t, err := lx.next()
+		if err != nil {
+			return nil, false
+		}
+		if t.kind == tokEOF {
+			return out, true
+		}
+		out = append(out, t)
+	}
+}
+
+// таблицы команды по псевдонимам и именам (в нижнем регистре)
+func tableAliases(toks []token) map[string]string {
+	out := map[string]string{}
+	for i := 0; i+1 < len(toks); i++ {
+		if toks[i].kind != tokWord || !tableContext[strings.ToLower(toks[i].text)] {
+			continue
+		}
+		t := toks[i+1]
+		if t.kind != tokWord && t.kind != tokString || isReserved(t) {
+			continue
+		}
+		table := strings.TrimSuffix(t.text, ".csv")
+		out[strings.ToLower(table)] = table
+		j := i + 2
+		if j < len(toks) && strings.EqualFold(toks[j].text, "as") {
+			j++
+		}
+		if j < len(toks) && toks[j].kind == tokWord && !isReserved(toks[j]) {
+			out[strings.ToLower(toks[j].text)] = table
+		}
+	}
+	return out
+}
+
+func tableNames() []string {
+	var out []string
+	for _, f := range listTables(".") {
+		out = append(out, strings.TrimSuffix(f, ".csv"))
+	}
+	return out
+}
+
+func matchPrefix(prefix string, names []string) []string {
+	var out []string
+	p := strings.ToLower(strings.TrimLeft(prefix, `"`))
+	for _, n := range names {
+		l := strings.ToLower(strings.Trim(n, `"`))
+		if strings.HasPrefix(l, p) && l != p {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// ключевые слова в регистре набранного префикса
+func keywordCase(prefix string, words []string) []string {
+	upper := prefix != "" && strings.ToUpper(prefix) == prefix && strings.ToLower(prefix) != prefix
+	if !upper {
+		return words
+	}
+	out := make([]string, len(words))
+	for i, w := range words {
+		out[i] = strings.ToUpper(w)
+	}
+	return out
+}
+
+// имена, которые лексер не прочтёт одним словом, берутся в кавычки
+func quoteNames(names []string) []string {
+	out := make([]string, len(names))
+	for i, n := range names {
+		out[i] = n
+		rs := []rune(n)
+		plain := len(rs) > 0 && isWordStart(rs[0])
+		for j, r := range rs {
+			if !wordRuneAt(rs, j) || unicode.IsSpace(r) {
+				plain = false
+			}
+		}
+		if !plain || reservedWords[strings.ToLower(n)] {
+			out[i] = `"` + strings.ReplaceAll(n, `"`, `""`) + `"`
+		}
+	}
+	return out
+}
+
+func dedupFold(items []string) []string {
+	seen := map[string]bool{}
+	out := items[:0]
+	for _, it := range items {
+		k := strings.ToLower(it)
+		if !seen[k] {
+			seen[k] = true
+			out = append(out, it)
+		}
+	}
+	return out
+}
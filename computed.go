@@ -0,0 +1,308 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// --- Вычисляемые колонки ---
+//
+// ALTER TABLE <table> ADD <col> AS <выражение>
+// ALTER TABLE <table> ALTER <col> AS <выражение>
+// DROP и RENAME работают как для обычных колонок.
+//
+// Определения хранятся в метаданных таблицы, значения вычисляются при
+// чтении и в CSV не записываются. Вычисляемые колонки идут после
+// колонок файла; выражение может ссылаться на колонки таблицы и на
+// вычисляемые колонки, объявленные раньше. Ошибка вычисления в строке
+// даёт пустое значение (NULL).
+
+type computedColumn struct {
+	Name string `json:"name"`
+	Expr string `json:"expr"`
+}
+
+// разобранные и привязанные определения для заголовка таблицы
+type computedSet struct {
+	names  []string
+	exprs  []expr
+	scopes []*columnScope // область видимости каждого выражения
+	width  int            // колонок в CSV
+	err    error          // первая ошибка вычисления
+}
+
+func parseComputedExpr(src string) (expr, error) {
+	p := newParser(src)
+	e, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectEnd(); err != nil {
+		return nil, err
+	}
+	if hasAggregate(e) {
+		return nil, errors.New("агрегатные функции в вычисляемой колонке недопустимы")
+	}
+	return e, nil
+}
+
+// вычисляемые колонки таблицы; nil — их нет
+func loadComputed(fileName string, header []string) (*computedSet, error) {
+	tm, err := getTableMeta(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defs := tm.Computed
+	if len(defs) == 0 {
+		return nil, nil
+	}
+	cs := &computedSet{width: len(header)}
+	scope := tableScope(fileName, strings.TrimSuffix(filepath.Base(fileName), ".csv"), header)
+	for _, d := range defs {
+		e, err := parseComputedExpr(d.Expr)
+		if err == nil {
+			err = bindExpr(e, scope)
+		}
+		if err != nil {
+			// позиция в тексте выражения не относится к запросу
+			return nil, fmt.Errorf("вычисляемая колонка %s: %v", d.Name, err)
+		}
+		cs.add(d.Name, e, scope)
+		scope = cloneScope(scope)
+		scope.add(scope.quals[0], d.Name, "")
+	}
+	return cs, nil
+}
+
+func (cs *computedSet) add(name string, e expr, scope *columnScope) {
+	cs.names = append(cs.names, name)
+	cs.exprs = append(cs.exprs, e)
+	cs.scopes = append(cs.scopes, scope)
+}
+
+func cloneScope(s *columnScope) *columnScope {
+	return &columnScope{
+		names: append([]string(nil), s.names...),
+		quals: append([]string(nil), s.quals...),
+		types: append([]string(nil), s.types...),
+	}
+}
+
+func (cs *computedSet) header(h []string) []string {
+	return append(append([]string(nil), h...), cs.names...)
+}
+
+// строка с дописанными значениями вычисляемых колонок
+func (cs *computedSet) extend(row []string) []string {
+	out := make([]string, cs.width, cs.width+len(cs.names))
+	copy(out, row)
+	for i, e := range cs.exprs {
+		v, err := e.eval(&rowEnv{scope: cs.scopes[i], row: out})
+		if err != nil {
+			if cs.err == nil {
+				cs.err = err
+			}
+			v = nullValue
+		}
+		out = append(out, v.String())
+	}
+	return out
+}
+
+// заголовок и чтение строк вместе с вычисляемыми колонками
+func withComputed(fileName string, header []string, next func() ([]string, error)) ([]string, func() ([]string, error), error) {
+	cs, err := loadComputed(fileName, header)
+	if err != nil || cs == nil {
+		return header, next, err
+	}
+	return cs.header(header), func() ([]string, error) {
+		row, err := next()
+		if err != nil {
+			return nil, err
+		}
+		return cs.extend(row), nil
+	}, nil
+}
+
+// таблица целиком вместе с вычисляемыми колонками
+func withComputedData(fileName string, data [][]string) ([][]string, error) {
+	if len(data) == 0 {
+		return data, nil
+	}
+	cs, err := loadComputed(fileName, data[0])
+	if err != nil || cs == nil {
+		return data, err
+	}
+	out := make([][]string, len(data))
+	out[0] = cs.header(data[0])
+	for r := 1; r < len(data); r++ {
+		out[r] = cs.extend(data[r])
+	}
+	return out, nil
+}
+
+// Только вычисляемые колонки для строк data (заголовок — имена);
+// nil — у таблицы их нет. evalErr — первая ошибка вычисления в строках.
+func computeColumns(fileName string, data [][]string) (cols [][]string, evalErr error, err error) {
+	if len(data) == 0 {
+		return nil, nil, nil
+	}
+	cs, err := loadComputed(fileName, data[0])
+	if err != nil || cs == nil {
+		return nil, nil, err
+	}
+	cols = make([][]string, len(data))
+	cols[0] = cs.names
+	for r := 1; r < len(data); r++ {
+		cols[r] = cs.extend(data[r])[cs.width:]
+	}
+	return cols, cs.err, nil
+}
+
+// имена колонок таблицы вместе с вычисляемыми
+func tableColumns(fileName string) ([]string, error) {
+	header, err := readHeader(fileName)
+	if err != nil {
+		return nil, err
+	}
+	tm, err := getTableMeta(fileName)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range tm.Computed {
+		header = append(header, c.Name)
+	}
+	return header, nil
+}
+
+func computedIndex(defs []computedColumn, name string) int {
+	for i, c := range defs {
+		if strings.EqualFold(c.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// вычисляемые колонки, выражения которых ссылаются на колонку name
+func computedDependents(defs []computedColumn, name string) []string {
+	var out []string
+	for _, c := range defs {
+		e, err := parseComputedExpr(c.Expr)
+		if err != nil {
+			continue
+		}
+		uses := false
+		_ = walkExpr(e, func(n expr) error {
+			if r, ok := n.(*colRef); ok && (strings.EqualFold(r.name, name) || strings.EqualFold(r.raw, name)) {
+				uses = true
+			}
+			return nil
+		})
+		if uses && !strings.EqualFold(c.Name, name) {
+			out = append(out, c.Name)
+		}
+	}
+	return out
+}
+
+// колонку нельзя удалить или переименовать, пока на неё ссылаются выражения
+func checkNoDependents(fileName, name string) error {
+	tm, err := getTableMeta(fileName)
+	if err != nil {
+		return err
+	}
+	if deps := computedDependents(tm.Computed, name); len(deps) > 0 {
+		return fmt.Errorf("колонка '%s' используется в вычисляемых колонках: %s", name, strings.Join(deps, ", "))
+	}
+	return nil
+}
+
+// Добавить (at < 0) или переопределить вычисляемую колонку. Выражение
+// проверяется по колонкам таблицы и предшествующим вычисляемым.
+func defineComputed(fileName, name string, e expr, src string, replace bool) error {
+	header, err := readHeader(fileName)
+	if err != nil {
+		return err
+	}
+	name = strings.TrimSpace(name)
+	tm, err := getTableMeta(fileName)
+	if err != nil {
+		return err
+	}
+	defs := tm.Computed
+	at := computedIndex(defs, name)
+	switch {
+	case replace && at < 0:
+		return fmt.Errorf("вычисляемая колонка '%s' не найдена", name)
+	case !replace:
+		if err := checkNewColumnName(header, name, -1); err != nil {
+			return err
+		}
+		if at >= 0 {
+			return fmt.Errorf("колонка '%s' уже существует", defs[at].Name)
+		}
+		at = len(defs)
+	}
+	scope := tableScope(fileName, strings.TrimSuffix(filepath.Base(fileName), ".csv"), header)
+	for _, c := range defs[:at] {
+		scope.add(scope.quals[0], c.Name, "")
+	}
+	if err := bindExpr(e, scope); err != nil {
+		return err
+	}
+	if hasAggregate(e) {
+		return errors.New("агрегатные функции в вычисляемой колонке недопустимы")
+	}
+	return updateTableMeta(fileName, func(tm *tableMeta) bool {
+		def := computedColumn{Name: name, Expr: src}
+		if replace {
+			tm.Computed[at] = def
+		} else {
+			tm.Computed = append(tm.Computed, def)
+		}
+		return true
+	})
+}
+
+func dropComputed(fileName, name string) error {
+	if err := checkNoDependents(fileName, name); err != nil {
+		return err
+	}
+	return updateTableMeta(fileName, func(tm *tableMeta) bool {
+		if i := computedIndex(tm.Computed, name); i >= 0 {
+			tm.Computed = append(tm.Computed[:i], tm.Computed[i+1:]...)
+		}
+		return true
+	})
+}
+
+func renameComputed(fileName, oldName, newName string) error {
+	header, err := readHeader(fileName)
+	if err != nil {
+		return err
+	}
+	newName = strings.TrimSpace(newName)
+	if err := checkNewColumnName(header, newName, -1); err != nil {
+		return err
+	}
+	tm, err := getTableMeta(fileName)
+	if err != nil {
+		return err
+	}
+	defs := tm.Computed
+	if i := computedIndex(defs, newName); i >= 0 && !strings.EqualFold(defs[i].Name, oldName) {
+		return fmt.Errorf("колонка '%s' уже существует", defs[i].Name)
+	}
+	if err := checkNoDependents(fileName, oldName); err != nil {
+		return err
+	}
+	return updateTableMeta(fileName, func(tm *tableMeta) bool {
+		if i := computedIndex(tm.Computed, oldName); i >= 0 {
+			tm.Computed[i].Name = newName
+		}
+		return true
+	})
+}
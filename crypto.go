@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// --- Зашифрованные таблицы ---
+//
+// Формат файла: encMagic | соль (16 байт) | nonce (12 байт) | шифртекст AES-256-GCM.
+// Ключ выводится из пароля через PBKDF2-SHA256, магия и соль входят в AAD,
+// поэтому подмена заголовка обнаруживается при расшифровке.
+
+const (
+	encMagic      = "CSVDBENC1\n"
+	encSaltSize   = 16
+	encKeySize    = 32
+	encIterations = 600000
+)
+
+var (
+	errTableLocked   = errors.New("таблица зашифрована, требуется пароль")
+	errBadPassphrase = errors.New("неверный пароль")
+)
+
+// таблица зашифрована и не разблокирована; errors.Is(err, errTableLocked)
+type tableLockedError struct {
+	fileName string
+}
+
+func (e *tableLockedError) Error() string {
+	return filepath.Base(e.fileName) + ": " + errTableLocked.Error()
+}
+
+func (e *tableLockedError) Unwrap() error { return errTableLocked }
+
+type tableKey struct {
+	salt []byte
+	key  []byte
+}
+
+// ключи разблокированных таблиц живут только в памяти процесса
+var unlocked = struct {
+	sync.Mutex
+	keys map[string]*tableKey
+}{keys: map[string]*tableKey{}}
+
+func keyringName(fileName string) string {
+	if abs, err := filepath.Abs(fileName); err == nil {
+		return abs
+	}
+	return filepath.Clean(fileName)
+}
+
+func isEncryptedFile(fileName string) bool {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	buf := make([]byte, len(encMagic))
+	if _, err := io.ReadFull(f, buf); err != nil {
+		return false
+	}
+	return string(buf) == encMagic
+}
+
+func deriveKey(passphrase string, salt []byte) ([]byte, error) {
+	return pbkdf2.Key(sha256.New, passphrase, salt, encIterations, encKeySize)
+}
+
+func newTableKey(passphrase string) (*tableKey, error) {
+	if passphrase == "" {
+		return nil, errors.New("пароль не может быть пустым")
+	}
+	salt := make([]byte, encSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	key, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	return &tableKey{salt: salt, key: key}, nil
+}
+
+func (k *tableKey) aead() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(k.key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (k *tableKey) seal(plain []byte) ([]byte, error) {
+	gcm, err := k.aead()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(encMagic)+len(k.salt)+len(nonce)+len(plain)+gcm.Overhead())
+	out = append(out, encMagic...)
+	out = append(out, k.salt...)
+	out = append(out, nonce...)
+	aad := out[:len(encMagic)+len(k.salt)]
+	return gcm.Seal(out, nonce, plain, aad), nil
+}
+
+// разбор заголовка зашифрованного файла: соль, nonce и шифртекст
+func splitSealed(raw []byte) (salt, nonce, body, aad []byte, err error) {
+	const nonceSize = 12
+	head := len(encMagic) + encSaltSize
+	if len(raw) < head+nonceSize || string(raw[:len(encMagic)]) != encMagic {
+		return nil, nil, nil, nil, errors.New("повреждён заголовок зашифрованной таблицы")
+	}
+	return raw[len(encMagic):head], raw[head : head+nonceSize], raw[head+nonceSize:], raw[:head], nil
+}
+
+func (k *tableKey) open(raw []byte) ([]byte, error) {
+	_, nonce, body, aad, err := splitSealed(raw)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := k.aead()
+	if err != nil {
+		return nil, err
+	}
+	plain, err := gcm.Open(nil, nonce, body, aad)
+	if err != nil {
+		return nil, errBadPassphrase
+	}
+	return plain, nil
+}
+
+// ключ из пароля и соли, записанной в самом файле
+func keyFromFile(raw []byte, passphrase string) (*tableKey, error) {
+	salt, _, _, _, err := splitSealed(raw)
+	if err != nil {
+		return nil, err
+	}
+	key, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	return &tableKey{salt: append([]byte(nil), salt...), key: key}, nil
+}
+
+func lookupKey(fileName string) *tableKey {
+	unlocked.Lock()
+	defer unlocked.Unlock()
+	return unlocked.keys[keyringName(fileName)]
+}
+
+func rememberKey(fileName string, k *tableKey) {
+	unlocked.Lock()
+	defer unlocked.Unlock()
+	unlocked.keys[keyringName(fileName)] = k
+}
+
+func forgetKey(fileName string) {
+	unlocked.Lock()
+	defer unlocked.Unlock()
+	delete(unlocked.keys, keyringName(fileName))
+}
+
+// ключ для записи таблицы: nil для обычных файлов, ошибка — если файл зашифрован и не разблокирован
+func tableKeyFor(fileName string) (*tableKey, error) {
+	if !isEncryptedFile(fileName) {
+		return nil, nil
+	}
+	if k := lookupKey(fileName); k != nil {
+		return k, nil
+	}
+	return nil, &tableLockedError{fileName: fileName}
+}
+
+// открыть таблицу на чтение; зашифрованные файлы расшифровываются в память
+func openTableReader(fileName string) (io.ReadCloser, error) {
+	if !isEncryptedFile(fileName) {
+		return os.Open(fileName)
+	}
+	k, err := tableKeyFor(fileName)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := k.open(raw)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(plain)), nil
+}
+
+// атомарная запись содержимого файла через временный файл в той же папке
+func writeFileAtomic(fileName string, content []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(fileName), "csvdb_write_*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return atomicReplace(tmpPath, fileName)
+}
+
+// проверить пароль и запомнить ключ до конца сеанса
+func unlockTable(tableName, passphrase string) error {
+	fileName := tableFile(tableName)
+	raw, err := os.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(raw, []byte(encMagic)) {
+		return fmt.Errorf("таблица '%s' не зашифрована", tableName)
+	}
+	k, err := keyFromFile(raw, passphrase)
+	if err != nil {
+		return err
+	}
+	if _, err := k.open(raw); err != nil {
+		return err
+	}
+	rememberKey(fileName, k)
+	return nil
+}
+
+func lockTable(tableName string) {
+	forgetKey(tableFile(tableName))
+}
+
+func encryptTable(tableName, passphrase string) error {
+	fileName := tableFile(tableName)
+	raw, err := os.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+	if bytes.HasPrefix(raw, []byte(encMagic)) {
+		return fmt.Errorf("таблица '%s' уже зашифрована", tableName)
+	}
+	k, err := newTableKey(passphrase)
+	if err != nil {
+		return err
+	}
+	sealed, err := k.seal(raw)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(fileName, sealed); err != nil {
+		return err
+	}
+	rememberKey(fileName, k)
+	return recordChecksum(fileName)
+}
+
+func decryptTable(tableName, passphrase string) error {
+	fileName := tableFile(tableName)
+	raw, err := os.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(raw, []byte(encMagic)) {
+		return fmt.Errorf("таблица '%s' не зашифрована", tableName)
+	}
+	k, err := keyFromFile(raw, passphrase)
+	if err != nil {
+		return err
+	}
+	plain, err := k.open(raw)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(fileName, plain); err != nil {
+		return err
+	}
+	forgetKey(fileName)
+	return recordChecksum(fileName)
+}
+
+func changeTablePassphrase(tableName, oldPass, newPass string) error {
+	fileName := tableFile(tableName)
+	raw, err := os.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(raw, []byte(encMagic)) {
+		return fmt.Errorf("таблица '%s' не зашифрована", tableName)
+	}
+	oldKey, err := keyFromFile(raw, oldPass)
+	if err != nil {
+		return err
+	}
+	plain, err := oldKey.open(raw)
+	if err != nil {
+		return err
+	}
+	k, err := newTableKey(newPass)
+	if err != nil {
+		return err
+	}
+	sealed, err := k.seal(plain)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(fileName, sealed); err != nil {
+		return err
+	}
+	rememberKey(fileName, k)
+	return recordChecksum(fileName)
+}
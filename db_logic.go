@@ -1,12 +1,19 @@
 package main
 
 import (
+	"context"
+	"encoding/csv"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
@@ -16,6 +23,7 @@ import (
 	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/driver/desktop"
 	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/storage"
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
 )
@@ -133,6 +141,174 @@ func (e *EscEntry) TypedKey(ev *fyne.KeyEvent) {
 	e.Entry.TypedKey(ev)
 }
 
+/*************** Поле команды: история и автодополнение **********/
+// Up/Down — листание истории, Ctrl+R — поиск по истории, Tab или
+// Ctrl+Space — варианты дополнения; при открытом списке вариантов
+// Up/Down выбирают вариант, Tab вставляет его, Esc закрывает список.
+type CommandEntry struct {
+	widget.Entry
+	OnSearch func() // Ctrl+R
+
+	history *cmdHistory
+	popup   *widget.PopUp
+	list    *widget.List
+	items   []string
+	start   int // начало дополняемого слова (в рунах)
+	chosen  int
+}
+
+func NewCommandEntry(h *cmdHistory) *CommandEntry {
+	e := &CommandEntry{history: h}
+	e.ExtendBaseWidget(e)
+	e.list = widget.NewList(
+		func() int { return len(e.items) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			lbl := obj.(*widget.Label)
+			lbl.TextStyle = fyne.TextStyle{Bold: id == e.chosen}
+			lbl.SetText(e.items[id])
+		},
+	)
+	e.list.OnSelected = func(id widget.ListItemID) {
+		e.list.UnselectAll()
+		e.accept(id)
+	}
+	return e
+}
+
+func (e *CommandEntry) AcceptsTab() bool { return true }
+
+func (e *CommandEntry) suggesting() bool { return e.popup != nil && e.popup.Visible() }
+
+func (e *CommandEntry) TypedKey(ev *fyne.KeyEvent) {
+	switch ev.Name {
+	case fyne.KeyUp:
+		if e.suggesting() {
+			e.choose(e.chosen - 1)
+		} else if s, ok := e.history.prev(e.Text); ok {
+			e.setCommand(s)
+		}
+	case fyne.KeyDown:
+		if e.suggesting() {
+			e.choose(e.chosen + 1)
+		} else if s, ok := e.history.next(); ok {
+			e.setCommand(s)
+		}
+	case fyne.KeyTab:
+		if e.suggesting() {
+			e.accept(e.chosen)
+		} else {
+			e.suggest(true)
+		}
+	case fyne.KeyEscape:
+		e.hideSuggestions()
+	case fyne.KeyReturn, fyne.KeyEnter:
+		e.hideSuggestions()
+		e.Entry.TypedKey(ev)
+	default:
+		e.Entry.TypedKey(ev)
+		if e.suggesting() {
+			e.suggest(false)
+		}
+	}
+}
+
+func (e *CommandEntry) TypedRune(r rune) {
+	e.Entry.TypedRune(r)
+	e.suggest(false)
+}
+
+func (e *CommandEntry) TypedShortcut(s fyne.Shortcut) {
+	if cs, ok := s.(*desktop.CustomShortcut); ok && cs.Modifier == fyne.KeyModifierControl {
+		switch cs.KeyName {
+		case fyne.KeyR:
+			e.hideSuggestions()
+			if e.OnSearch != nil {
+				e.OnSearch()
+			}
+			return
+		case fyne.KeySpace:
+			e.suggest(true)
+			return
+		}
+	}
+	e.Entry.TypedShortcut(s)
+}
+
+func (e *CommandEntry) FocusLost() {
+	e.hideSuggestions()
+	e.Entry.FocusLost()
+}
+
+// текст из истории с курсором в конце
+func (e *CommandEntry) setCommand(s string) {
+	e.hideSuggestions()
+	e.SetText(s)
+	e.CursorColumn = len([]rune(s))
+	e.Refresh()
+}
+
+// explicit — вызвано по Tab: варианты показываются и для пустого слова
+func (e *CommandEntry) suggest(explicit bool) {
+	c := complete(e.Text, e.CursorColumn)
+	if len(c.items) == 0 || !explicit && c.start == e.CursorColumn {
+		e.hideSuggestions()
+		return
+	}
+	if len(c.items) == 1 && explicit {
+		e.items, e.start = c.items, c.start
+		e.accept(0)
+		return
+	}
+	e.items, e.start = c.items, c.start
+	cnv := fyne.CurrentApp().Driver().CanvasForObject(e)
+	if cnv == nil {
+		return
+	}
+	if e.popup == nil {
+		e.popup = widget.NewPopUp(e.list, cnv)
+	}
+	e.choose(0)
+	rowH := widget.NewLabel("").MinSize().Height + theme.Padding()
+	pos := fyne.CurrentApp().Driver().AbsolutePositionForObject(e)
+	e.popup.Resize(fyne.NewSize(320, min(float32(len(e.items))*rowH, 240)))
+	e.popup.ShowAtPosition(pos.Add(fyne.NewPos(0, e.Size().Height)))
+}
+
+func (e *CommandEntry) choose(i int) {
+	if len(e.items) == 0 {
+		return
+	}
+	// выбранный вариант выделяется жирным, вставляется по Tab
+	e.chosen = (i + len(e.items)) % len(e.items)
+	e.list.Refresh()
+	e.list.ScrollTo(e.chosen)
+}
+
+func (e *CommandEntry) accept(i int) {
+	if i < 0 || i >= len(e.items) {
+		return
+	}
+	rs := []rune(e.Text)
+	cursor := min(e.CursorColumn, len(rs))
+	start := min(e.start, cursor)
+	item := []rune(e.items[i])
+	text := string(rs[:start]) + string(item) + string(rs[cursor:])
+	e.hideSuggestions()
+	e.SetText(text)
+	e.CursorColumn = start + len(item)
+	e.Refresh()
+	if cnv := fyne.CurrentApp().Driver().CanvasForObject(e); cnv != nil {
+		cnv.Focus(e)
+	}
+}
+
+func (e *CommandEntry) hideSuggestions() {
+	if e.popup != nil {
+		e.popup.Hide()
+	}
+}
+
 /*************** IdCell — статичное поле крестика + центрированный ID **********/
 type IdCell struct {
 	widget.BaseWidget
@@ -270,22 +446,7 @@ func (r *idCellRenderer) Objects() []fyne.CanvasObject { return r.objs }
 
 /*************** Вспомогательные **********/
 func getCSVFiles() []string {
-	var files []string
-	items, _ := os.ReadDir(".")
-	for _, it := range items {
-		if it.IsDir() {
-			continue
-		}
-		n := it.Name()
-		if strings.HasPrefix(n, ".") {
-			continue
-		}
-		if strings.HasSuffix(strings.ToLower(n), ".csv") {
-			files = append(files, n)
-		}
-	}
-	sort.Strings(files)
-	return files
+	return listTables(".")
 }
 
 // Перенумерация ID (первая колонка) 1..N после удаления
@@ -298,30 +459,11 @@ func renumberIDs(data [][]string) {
 	}
 }
 
-// Разбор списка колонок: "name, age, city" или "name age city"
-func parseColumns(colsRaw string) []string {
-	cols := []string{}
-	if strings.Contains(colsRaw, ",") {
-		parts := strings.Split(colsRaw, ",")
-		for _, p := range parts {
-			t := strings.TrimSpace(p)
-			if t != "" {
-				cols = append(cols, t)
-			}
-		}
-	} else {
-		for _, p := range strings.Fields(colsRaw) {
-			t := strings.TrimSpace(p)
-			if t != "" {
-				cols = append(cols, t)
-			}
-		}
-	}
-	return cols
-}
-
 /*************** Приложение **********/
 func main() {
+	if isCLI(os.Args[1:]) {
+		os.Exit(runCLI(os.Args[1:], os.Stdout, os.Stderr))
+	}
 	myApp := app.New()
 	myApp.Settings().SetTheme(&forestTheme{})
 
@@ -330,12 +472,23 @@ func main() {
 
 	tableListData := binding.NewStringList()
 	_ = tableListData.Set(getCSVFiles())
+	viewListData := binding.NewStringList()
+	_ = viewListData.Set(listViews("."))
 
 	var current [][]string
+	var virtual [][]string // вычисляемые колонки таблицы: заголовок и значения, nil — нет
 	status := widget.NewLabel("Добро пожаловать в CSV DB Manager!")
 	var selected string
+	var readOnly bool    // результат запроса: без редактирования, удаления и строки «плюс»
+	var view *viewInfo   // открытое представление: правки идут в исходную таблицу
+	var lastQuery string // последний выполненный SELECT или FIND — для сохранения представлением
 
 	var updateTable func([][]string, string)
+	var setTableData func([][]string, string, bool)
+	var showColumnMenu func(id widget.TableCellID)
+	var runTableCmd func(st *tableStmt)
+	var syncSearchOptions func() // флажки поиска после SET
+	var reloadView func()
 
 	// Глобальные флаги и горячие клавиши для диалогов
 	var activeDlg *dialog.ConfirmDialog
@@ -347,13 +500,40 @@ func main() {
 	// ширина ID-колонки
 	idColWidth := float32(64)
 
+	// Вычисляемые колонки показываются справа от колонок файла курсивом
+	isVirtual := func(col int) bool {
+		return virtual != nil && len(current) > 0 && col >= len(current[0])
+	}
+	cellText := func(row, col int) string {
+		if isVirtual(col) {
+			if row < len(virtual) && col-len(current[0]) < len(virtual[row]) {
+				if row == 0 {
+					return "ƒ " + virtual[0][col-len(current[0])]
+				}
+				return virtual[row][col-len(current[0])]
+			}
+			return ""
+		}
+		if row < len(current) && col < len(current[row]) {
+			return current[row][col]
+		}
+		return ""
+	}
+
 	// Таблица: +1 «виртуальная» строка для плюса в колонке 0
 	dataTable := widget.NewTable(
 		func() (int, int) {
 			if len(current) == 0 {
 				return 0, 0
 			}
-			return len(current) + 1, len(current[0])
+			cols := len(current[0])
+			if virtual != nil {
+				cols += len(virtual[0])
+			}
+			if readOnly || view != nil {
+				return len(current), cols
+			}
+			return len(current) + 1, cols
 		},
 		func() fyne.CanvasObject {
 			bg := canvas.NewRectangle(myApp.Settings().Theme().Color(theme.ColorNameInputBackground, myApp.Settings().ThemeVariant()))
@@ -380,6 +560,12 @@ func main() {
 			plusCenter.Hide()
 			idCell.Hide()
 			lbl.Show()
+			lbl.TextStyle = fyne.TextStyle{Italic: isVirtual(id.Col)}
+
+			if readOnly {
+				lbl.SetText(cellText(id.Row, id.Col))
+				return
+			}
 
 			// Плюс — последняя виртуальная строка в колонке 0
 			if id.Row == len(current) && id.Col == 0 {
@@ -396,11 +582,7 @@ func main() {
 			}
 
 			// Заполнение текста
-			if id.Row < len(current) && id.Col < len(current[id.Row]) {
-				lbl.SetText(current[id.Row][id.Col])
-			} else {
-				lbl.SetText("")
-			}
+			lbl.SetText(cellText(id.Row, id.Col))
 
 			// ID-колонка с крестиком и центрированным текстом
 			if id.Col == 0 && id.Row > 0 && id.Row < len(current) {
@@ -412,7 +594,16 @@ func main() {
 					// Диалог подтверждения удаления «Да/Нет»
 					text := widget.NewLabel(fmt.Sprintf("Удалить запись с id %s?", current[rowIndex][0]))
 					doDelete := func() {
-						// Удаляем строку и перенумеровываем id
+						if view != nil {
+							if _, err := view.deleteRow(current[rowIndex][0]); err != nil {
+								dialog.ShowError(err, win)
+								return
+							}
+							reloadView()
+							return
+						}
+						// Удаляем строку и перенумеровываем id; при хуках на строки
+						// id не меняются, иначе удаление выглядело бы как update
 						newData := make([][]string, 0, len(current)-1)
 						for r := range current {
 							if r == rowIndex {
@@ -420,7 +611,9 @@ func main() {
 							}
 							newData = append(newData, current[r])
 						}
-						renumberIDs(newData)
+						if !hooksFor(tableFile(selected)).rowEvents() {
+							renumberIDs(newData)
+						}
 						if err := saveTableData(selected, newData); err != nil {
 							dialog.ShowError(err, win)
 							return
@@ -473,64 +666,21 @@ func main() {
 		if selected == "" || len(current) == 0 {
 			return
 		}
+		if readOnly {
+			dataTable.Unselect(id)
+			status.SetText("Результат запроса только для чтения — откройте таблицу для редактирования")
+			return
+		}
 
-		// Переименование заголовков (кроме id)
+		// Заголовок — меню колонки (ALTER TABLE)
 		if id.Row == 0 {
-			if id.Col == 0 {
-				inf := dialog.NewInformation("Переименование", "Колонку id переименовывать нельзя", win)
-				inf.Resize(fyne.NewSize(dialogW, dialogH))
-				inf.Show()
+			if view != nil {
+				status.SetText("Структуру меняйте в исходной таблице " + view.base)
 				dataTable.Unselect(id)
 				return
 			}
-			old := current[0][id.Col]
-			entry := NewEscEntry()
-			entry.SetText(old)
-			var dlg *dialog.ConfirmDialog
-			commit := func() {
-				newVal := strings.TrimSpace(entry.Text)
-				if newVal == "" {
-					newVal = old
-				}
-				current[0][id.Col] = newVal
-				if err := saveTableData(selected, current); err != nil {
-					current[0][id.Col] = old
-					dialog.ShowError(err, win)
-				} else {
-					updateTable(current, selected)
-					status.SetText(fmt.Sprintf("Переименован заголовок колонки %d", id.Col))
-				}
-				dataTable.Unselect(id)
-			}
-			entry.OnSubmitted = func(string) {
-				commit()
-				if dlg != nil {
-					dlg.Dismiss()
-				}
-				activeDlg = nil
-				onEnter = nil
-			}
-			entry.OnEsc = func() {
-				dataTable.Unselect(id)
-				if dlg != nil {
-					dlg.Dismiss()
-				}
-				activeDlg = nil
-				onEnter = nil
-			}
-			dlg = dialog.NewCustomConfirm("Переименовать колонку", "Сохранить", "Отмена", container.NewPadded(entry), func(ok bool) {
-				if ok {
-					commit()
-				} else {
-					dataTable.Unselect(id)
-				}
-				activeDlg = nil
-				onEnter = nil
-			}, win)
-			dlg.Resize(fyne.NewSize(renameDlgW, renameDlgH))
-			activeDlg = dlg
-			onEnter = func() { commit() }
-			dlg.Show()
+			showColumnMenu(id)
+			dataTable.Unselect(id)
 			return
 		}
 
@@ -538,6 +688,17 @@ func main() {
 		if id.Row >= len(current) {
 			return
 		}
+		if isVirtual(id.Col) {
+			name := virtual[0][id.Col-len(current[0])]
+			tm, _ := getTableMeta(selected)
+			for _, c := range tm.Computed {
+				if c.Name == name {
+					status.SetText(fmt.Sprintf("%s = %s (вычисляемая колонка, только чтение)", c.Name, c.Expr))
+				}
+			}
+			dataTable.Unselect(id)
+			return
+		}
 		// колонка id не редактируется
 		if id.Col == 0 {
 			inf := dialog.NewInformation("Редактирование", "Колонку id редактировать нельзя", win)
@@ -557,6 +718,30 @@ func main() {
 
 		commit := func() {
 			newVal := entry.Text
+			if view != nil {
+				v, rowID := view, current[id.Row][0]
+				if _, err := v.updateCell(rowID, id.Col, newVal); err != nil {
+					dialog.ShowError(err, win)
+				} else {
+					reloadView()
+					status.SetText(fmt.Sprintf("Изменено в %s: id %s, %s", v.base, rowID, v.columns[id.Col]))
+				}
+				dataTable.Unselect(id)
+				return
+			}
+			tm, err := getTableMeta(selected)
+			if err != nil {
+				dialog.ShowError(err, win)
+				dataTable.Unselect(id)
+				return
+			}
+			if typ, ok := tm.Types[current[0][id.Col]]; ok {
+				if err := checkValueType(typ, newVal); err != nil {
+					dialog.ShowError(err, win)
+					dataTable.Unselect(id)
+					return
+				}
+			}
 			current[id.Row][id.Col] = newVal
 			if err := saveTableData(selected, current); err != nil {
 				current[id.Row][id.Col] = old
@@ -606,11 +791,29 @@ func main() {
 	}
 
 	// Обновление таблицы и статуса
-	updateTable = func(data [][]string, name string) {
+	setTableData = func(data [][]string, name string, ro bool) {
 		current = data
+		readOnly = ro
+		virtual = nil
+		var calcErr error
+		if !ro && view == nil && name != "" {
+			var err error
+			if virtual, calcErr, err = computeColumns(name, data); err != nil {
+				calcErr = err
+			}
+		}
 		if len(data) > 0 && len(data[0]) > 0 {
-			dataTable.SetColumnWidth(0, idColWidth)
-			for i := 1; i < len(data[0]); i++ {
+			first := 1
+			if ro {
+				first = 0
+			} else {
+				dataTable.SetColumnWidth(0, idColWidth)
+			}
+			cols := len(data[0])
+			if virtual != nil {
+				cols += len(virtual[0])
+			}
+			for i := first; i < cols; i++ {
 				dataTable.SetColumnWidth(i, 220)
 			}
 		}
@@ -622,6 +825,12 @@ func main() {
 		} else {
 			status.SetText(fmt.Sprintf("Таблица %s пуста или не найдена", name))
 		}
+		if calcErr != nil {
+			status.SetText(status.Text + "; ошибка в вычисляемой колонке: " + calcErr.Error())
+		}
+	}
+	updateTable = func(data [][]string, name string) {
+		setTableData(data, name, false)
 	}
 
 	/*************** Список таблиц ***************/
@@ -673,17 +882,7 @@ func main() {
 				entry.SetText(base + "_copy.csv")
 
 				commitCopy := func() {
-					newName := entry.Text
-					if !strings.HasSuffix(newName, ".csv") {
-						newName += ".csv"
-					}
-					if err := copyFile(fn, newName); err != nil {
-						dialog.ShowError(err, win)
-						return
-					}
-					_ = tableListData.Set(getCSVFiles())
-					list.Refresh()
-					status.SetText(fmt.Sprintf("Таблица %s скопирована в %s", fn, newName))
+					runTableCmd(&tableStmt{cmd: "copy", table: fn, target: tableFile(entry.Text)})
 				}
 
 				entry.OnSubmitted = func(string) {
@@ -720,17 +919,7 @@ func main() {
 				entry.SetText(fn)
 
 				commitRename := func() {
-					newName := entry.Text
-					if !strings.HasSuffix(newName, ".csv") {
-						newName += ".csv"
-					}
-					if err := os.Rename(fn, newName); err != nil {
-						dialog.ShowError(err, win)
-						return
-					}
-					_ = tableListData.Set(getCSVFiles())
-					list.Refresh()
-					status.SetText(fmt.Sprintf("Таблица %s переименована в %s", fn, newName))
+					runTableCmd(&tableStmt{cmd: "rename", table: fn, target: tableFile(entry.Text)})
 				}
 
 				entry.OnSubmitted = func(string) {
@@ -765,17 +954,7 @@ func main() {
 			delAct.SetOnTapped(func() {
 				text := widget.NewLabel(fmt.Sprintf("Удалить таблицу %s?", fn))
 				commitDelete := func() {
-					if err := deleteTable(fn); err != nil {
-						dialog.ShowError(err, win)
-						return
-					}
-					_ = tableListData.Set(getCSVFiles())
-					list.Refresh()
-					status.SetText(fmt.Sprintf("Таблица %s удалена", fn))
-					if selected == fn {
-						selected = ""
-						updateTable(nil, "")
-					}
+					runTableCmd(&tableStmt{cmd: "drop", table: fn})
 				}
 				dlg := dialog.NewCustomConfirm("Удалить таблицу", "Да", "Нет", container.NewPadded(text), func(ok bool) {
 					if ok {
@@ -799,119 +978,958 @@ func main() {
 	)
 
 	/*************** Команды ***************/
-	commandsDesc := "CREATE <table> <col1,col2..> - создать таблицу с n-колонок. | FIND <table> <column> <value> - найти нужное значение в выбранной таблице и колонке."
-	cmdEntry := widget.NewEntry()
-	cmdEntry.SetPlaceHolder("Введите команду create или find ...")
-	cmdEntry.OnSubmitted = func(text string) {
-		cmd, table, args, err := parseQuery(text)
-		if err != nil {
-			status.SetText("Ошибка парсинга " + err.Error())
-			return
-		}
-		switch cmd {
-		case "create":
-			// args — это уже разложенные названия колонок
-			if table == "" || len(args) == 0 {
-				status.SetText("create требует имя таблицы и список колонок")
-				break
+	// Разблокировка зашифрованной таблицы с повтором действия
+	unlockAndRetry := func(fn string, retry func()) {
+		showPassphraseDialog(win, &activeDlg, &onEnter, "Таблица "+fn+" зашифрована", []string{"Пароль"}, func(p []string) error {
+			if err := unlockTable(fn, p[0]); err != nil {
+				return err
 			}
-			headers := append([]string{"id"}, args...)
-			newData := make([][]string, 0, 1)
-			newData = append(newData, headers)
-			filename := table + ".csv"
-			if err := saveTableData(filename, newData); err != nil {
-				status.SetText("Ошибка " + err.Error())
+			retry()
+			return nil
+		})
+	}
+
+	// Переход к строке таблицы (из отчёта проверки)
+	jumpTo := func(fn string, row, col int) {
+		for i, f := range getCSVFiles() {
+			if f == fn {
+				list.UnselectAll()
+				list.Select(i)
 				break
 			}
-			selected = filename
-			_ = tableListData.Set(getCSVFiles())
-			updateTable(newData, selected)
-			list.Refresh()
-			status.SetText("Таблица " + table + " создана: " + strings.Join(args, ", "))
-		case "find":
-			if len(args) < 2 {
-				status.SetText("find требует колонку и значение")
-				break
+		}
+		if row >= 0 && row < len(current) {
+			if col < 0 {
+				col = 0
 			}
-			if data, err := findRecord(table, args[0], args[1]); err != nil {
-				status.SetText("Ошибка " + err.Error())
-			} else {
-				selected = table + ".csv"
+			dataTable.ScrollTo(widget.TableCellID{Row: row, Col: col})
+			status.SetText(fmt.Sprintf("Таблица %s, строка %d", fn, row))
+		}
+	}
+
+	reloadSelected := func() {
+		if selected != "" && !readOnly {
+			if data, err := readTableData(selected); err == nil {
 				updateTable(data, selected)
-				list.Refresh()
 			}
-		default:
-			status.SetText("Неизвестная команда " + cmd)
 		}
-		cmdEntry.SetText("")
 	}
 
-	// Левая панель 20% — список; правая 80% — таблица + команды снизу
-	leftBg := canvas.NewRectangle(myApp.Settings().Theme().Color(theme.ColorNameInputBackground, myApp.Settings().ThemeVariant()))
-	leftPanel := widget.NewCard("Таблицы", "", container.NewMax(leftBg, list))
-
-	commandsBox := widget.NewCard("Команды", commandsDesc, container.NewPadded(cmdEntry))
-	rightPanel := container.NewBorder(nil, container.NewVBox(commandsBox, status), nil, nil, dataTable)
+	// Отчёт проверки целостности с повторной проверкой после автоисправления
+	showIssues := func(st *verifyStmt, res *queryResult) {
+		if len(res.Issues) == 0 {
+			return
+		}
+		showVerifyDialog(win, "Проверка целостности", res.Issues, jumpTo, func() []verifyIssue {
+			again, err := execStatement(&verifyStmt{table: st.table, fix: true})
+			reloadSelected()
+			if err != nil {
+				dialog.ShowError(err, win)
+				return res.Issues
+			}
+			status.SetText(again.Message)
+			return again.Issues
+		})
+	}
 
-	split := container.NewHSplit(leftPanel, rightPanel)
-	split.Offset = 0.2 // 20% слева, 80% справа
+	// Представление: при изменении исходных файлов перечитывается
+	var stopWatch context.CancelFunc
+	showView := func(v *viewInfo) {
+		if stopWatch != nil {
+			stopWatch()
+			stopWatch = nil
+		}
+		view = v
+		if v == nil {
+			return
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		stopWatch = cancel
+		watchFiles(ctx, v.sources, time.Second, func() {
+			fyne.Do(func() {
+				if ctx.Err() == nil {
+					reloadView()
+				}
+			})
+		})
+	}
 
-	win.SetContent(split)
+	// Показ результата выполненной команды
+	showResult := func(st statement, res *queryResult) {
+		_ = tableListData.Set(getCSVFiles())
+		_ = viewListData.Set(listViews("."))
+		switch st.(type) {
+		case *insertStmt, *updateStmt, *deleteStmt:
+			// изменённая таблица показывается целиком
+			if data, err := readTableData(res.Table); err == nil {
+				res.Data = data
+			}
+		}
+		if res.Data != nil {
+			selected = res.Table
+			showView(res.View)
+			setTableData(res.Data, res.Table, res.ReadOnly)
+		} else if vs, ok := st.(*viewStmt); ok && vs.cmd == "drop" && view != nil && view.name == viewFile(vs.name) {
+			showView(nil)
+			selected = ""
+			updateTable(nil, "")
+		} else if res.Table != "" && res.Table == selected {
+			switch st := st.(type) {
+			case *keyStmt:
+				// заблокированную таблицу больше не показываем
+				updateTable(nil, selected)
+			case *tableStmt:
+				switch st.cmd {
+				case "drop":
+					selected = ""
+					updateTable(nil, "")
+				case "rename":
+					selected = tableFile(st.target)
+					reloadSelected()
+				}
+			}
+		}
+		list.Refresh()
+		if res.Message != "" {
+			status.SetText(res.Message)
+		}
+		if _, ok := st.(*alterStmt); ok && len(res.Issues) > 0 {
+			showVerifyDialog(win, "Преобразование типа", res.Issues, jumpTo, nil)
+		}
+		if _, ok := st.(*setStmt); ok {
+			syncSearchOptions()
+		}
+		if _, ok := st.(*starStmt); ok && res.Data == nil && view == nil {
+			reloadSelected()
+		}
+		if vs, ok := st.(*verifyStmt); ok {
+			if vs.fix {
+				reloadSelected()
+			}
+			showIssues(vs, res)
+		}
+	}
 
-	// Выбор таблицы слева
-	list.OnSelected = func(id widget.ListItemID) {
-		fn, err := tableListData.GetValue(id)
-		if err != nil {
-			status.SetText("Ошибка выбора " + err.Error())
+	// Команды над таблицами из списка: при занятом имени — подтверждение перезаписи
+	reloadView = func() {
+		if view == nil {
 			return
 		}
-		selected = fn
-		if data, err := readTableData(fn); err != nil {
+		st := &viewStmt{cmd: "open", name: view.name}
+		res, err := execStatement(st)
+		if err != nil {
 			status.SetText("Ошибка " + err.Error())
-			updateTable(nil, fn)
-		} else {
-			updateTable(data, fn)
+			return
 		}
-		list.Refresh()
+		showResult(st, res)
 	}
 
-	// Запуск
-	win.ShowAndRun()
-}
-
-/*************** Диалог создания записи ***************/
-func showCreateDialog(
-	win fyne.Window,
-	activeDlg **dialog.ConfirmDialog,
-	onEnter *func(),
-	selected string,
-	current [][]string,
-	onSaved func([][]string),
-) {
-	// Информ-диалог фиксированного размера
-	showSizedInfo := func(title, msg string) {
-		lbl := widget.NewLabel(msg)
-		d := dialog.NewCustom(title, "OK", container.NewPadded(lbl), win)
-		d.Resize(fyne.NewSize(dialogW, dialogH))
-		d.Show()
+	runTableCmd = func(st *tableStmt) {
+		res, err := execStatement(st)
+		if errors.Is(err, errTableExists) && !st.force {
+			cnf := dialog.NewConfirm("Таблица существует", fmt.Sprintf("Таблица %s уже существует. Перезаписать?", tableFile(st.target)), func(ok bool) {
+				if ok {
+					st.force = true
+					runTableCmd(st)
+				}
+			}, win)
+			cnf.Resize(fyne.NewSize(dialogW, dialogH))
+			cnf.Show()
+			return
+		}
+		if err != nil {
+			dialog.ShowError(err, win)
+			return
+		}
+		showResult(st, res)
 	}
 
-	if selected == "" || len(current) == 0 {
-		showSizedInfo("Создание", "Сначала выберите таблицу")
-		return
-	}
-	headers := current[0][1:]
-	if len(headers) == 0 {
-		showSizedInfo("Создание", "Нет редактируемых колонок")
-		return
+	runAlter := func(st *alterStmt) error {
+		res, err := execStatement(st)
+		if err != nil {
+			return err
+		}
+		showResult(st, res)
+		return nil
 	}
 
-	fields := make([]*EscEntry, len(headers))
-	form := container.NewVBox()
-	for i, h := range headers {
+	// Меню заголовка: действия ALTER TABLE над колонкой
+	showColumnMenu = func(id widget.TableCellID) {
+		header := current[0]
+		table := selected
+		alter := func(st *alterStmt) {
+			st.table = table
+			if err := runAlter(st); err != nil {
+				dialog.ShowError(err, win)
+			}
+		}
+		menuPos := func() fyne.Position {
+			x := idColWidth + float32(id.Col-1)*220
+			if w := dataTable.Size().Width; x > w-220 {
+				x = w - 220
+			}
+			return fyne.NewPos(x, 0)
+		}
+		computeItem := fyne.NewMenuItem("Добавить вычисляемую колонку…", func() {
+			showFormDialog(win, &activeDlg, &onEnter, "Вычисляемая колонка", []string{"Имя", "Выражение"}, nil, func(v []string) error {
+				return runAlter(&alterStmt{table: table, action: "compute", column: strings.TrimSpace(v[0]), calcSrc: strings.TrimSpace(v[1])})
+			})
+		})
+
+		if isVirtual(id.Col) {
+			col := virtual[0][id.Col-len(header)]
+			src := ""
+			tm, _ := getTableMeta(table)
+			for _, c := range tm.Computed {
+				if c.Name == col {
+					src = c.Expr
+				}
+			}
+			exprItem := fyne.NewMenuItem("Выражение…", func() {
+				showFormDialog(win, &activeDlg, &onEnter, "Выражение колонки "+col, []string{"Выражение"}, []string{src}, func(v []string) error {
+					if strings.TrimSpace(v[0]) == src {
+						return nil
+					}
+					return runAlter(&alterStmt{table: table, action: "recompute", column: col, calcSrc: strings.TrimSpace(v[0])})
+				})
+			})
+			renameItem := fyne.NewMenuItem("Переименовать…", func() {
+				showFormDialog(win, &activeDlg, &onEnter, "Переименовать колонку", []string{"Новое имя"}, []string{col}, func(v []string) error {
+					newName := strings.TrimSpace(v[0])
+					if newName == "" || newName == col {
+						return nil
+					}
+					return runAlter(&alterStmt{table: table, action: "rename", column: col, newName: newName})
+				})
+			})
+			dropItem := fyne.NewMenuItem("Удалить колонку", func() {
+				alter(&alterStmt{action: "drop", column: col})
+			})
+			menu := fyne.NewMenu("", exprItem, renameItem, computeItem, fyne.NewMenuItemSeparator(), dropItem)
+			widget.ShowPopUpMenuAtRelativePosition(menu, win.Canvas(), menuPos(), dataTable)
+			return
+		}
+		col := header[id.Col]
+
+		addItem := fyne.NewMenuItem("Добавить колонку справа…", func() {
+			showAddColumnDialog(win, &activeDlg, &onEnter, func(name, typ, def string) error {
+				st := &alterStmt{table: table, action: "add", column: name, typ: typ, def: &literalExpr{v: textValue(def)}}
+				if id.Col == 0 {
+					st.first = true
+				} else {
+					st.after = col
+				}
+				return runAlter(st)
+			})
+		})
+		if id.Col == 0 {
+			// у id только добавление колонки
+			widget.ShowPopUpMenuAtRelativePosition(fyne.NewMenu("", addItem, computeItem), win.Canvas(), fyne.NewPos(0, 0), dataTable)
+			return
+		}
+
+		renameItem := fyne.NewMenuItem("Переименовать…", func() {
+			showFormDialog(win, &activeDlg, &onEnter, "Переименовать колонку", []string{"Новое имя"}, []string{col}, func(v []string) error {
+				newName := strings.TrimSpace(v[0])
+				if newName == "" || newName == col {
+					return nil
+				}
+				return runAlter(&alterStmt{table: table, action: "rename", column: col, newName: newName})
+			})
+		})
+		typeItem := fyne.NewMenuItem("Тип…", func() {
+			tm, err := getTableMeta(table)
+			if err != nil {
+				dialog.ShowError(err, win)
+				return
+			}
+			showRetypeDialog(win, col, tm.Types[col], func(typ string, force bool) error {
+				return runAlter(&alterStmt{table: table, action: "type", column: col, typ: typ, force: force})
+			})
+		})
+		leftItem := fyne.NewMenuItem("Переместить влево", func() {
+			if id.Col == 1 {
+				return
+			}
+			if id.Col == 2 {
+				alter(&alterStmt{action: "move", column: col, first: true})
+			} else {
+				alter(&alterStmt{action: "move", column: col, after: header[id.Col-2]})
+			}
+		})
+		leftItem.Disabled = id.Col == 1
+		rightItem := fyne.NewMenuItem("Переместить вправо", func() {
+			if id.Col+1 < len(header) {
+				alter(&alterStmt{action: "move", column: col, after: header[id.Col+1]})
+			}
+		})
+		rightItem.Disabled = id.Col+1 >= len(header)
+		dropItem := fyne.NewMenuItem("Удалить колонку", func() {
+			cnf := dialog.NewConfirm("Удаление колонки", fmt.Sprintf("Удалить колонку %s со всеми значениями?", col), func(ok bool) {
+				if ok {
+					alter(&alterStmt{action: "drop", column: col})
+				}
+			}, win)
+			cnf.Resize(fyne.NewSize(dialogW, dialogH))
+			cnf.Show()
+		})
+
+		menu := fyne.NewMenu("", renameItem, typeItem, addItem, computeItem, fyne.NewMenuItemSeparator(), leftItem, rightItem, fyne.NewMenuItemSeparator(), dropItem)
+		widget.ShowPopUpMenuAtRelativePosition(menu, win.Canvas(), menuPos(), dataTable)
+	}
+
+	runVerify := func(table string, fix bool) {
+		st := &verifyStmt{table: table, fix: fix}
+		res, err := execStatement(st)
+		if err != nil {
+			status.SetText("Ошибка " + err.Error())
+			return
+		}
+		showResult(st, res)
+	}
+
+	// Экспорт показанной сетки (таблицы или результата запроса) в CSV
+	// или формат расширения
+	exportAs := func(format, ext string, write func(w io.Writer, data [][]string, types map[string]string) error) {
+		if len(current) == 0 {
+			status.SetText("Нет данных для экспорта")
+			return
+		}
+		data := current
+		name := "result"
+		switch {
+		case view != nil:
+			name = strings.TrimSuffix(filepath.Base(view.name), viewExt)
+		case !readOnly && selected != "":
+			name = strings.TrimSuffix(filepath.Base(selected), ".csv")
+		}
+		name += ext
+		save := func() {
+			d := dialog.NewFileSave(func(w fyne.URIWriteCloser, err error) {
+				if err != nil {
+					dialog.ShowError(err, win)
+					return
+				}
+				if w == nil {
+					return
+				}
+				defer w.Close()
+				// типы колонок исходной таблицы; у результата запроса — по имени колонки
+				var types map[string]string
+				if selected != "" {
+					tm, err := getTableMeta(selected)
+					if err != nil {
+						dialog.ShowError(err, win)
+						return
+					}
+					types = tm.Types
+				}
+				if err := write(w, data, types); err != nil {
+					dialog.ShowError(err, win)
+					return
+				}
+				status.SetText(fmt.Sprintf("Экспортировано строк %d в %s", len(data)-1, w.URI().Name()))
+			}, win)
+			d.SetFileName(name)
+			d.Resize(fyne.NewSize(winW*0.7, winH*0.7))
+			d.Show()
+		}
+		if virtual == nil {
+			save()
+			return
+		}
+		// вычисляемые колонки можно записать в файл значениями
+		cnf := dialog.NewConfirm("Экспорт", "Записать значения вычисляемых колонок в "+format+"?", func(ok bool) {
+			if ok {
+				data = make([][]string, len(current))
+				for r := range current {
+					data[r] = append(append([]string(nil), current[r]...), virtual[r]...)
+				}
+			}
+			save()
+		}, win)
+		cnf.Resize(fyne.NewSize(dialogW, dialogH))
+		cnf.Show()
+	}
+
+	exportCurrent := func() {
+		exportAs("CSV", ".csv", func(w io.Writer, data [][]string, _ map[string]string) error {
+			return csv.NewWriter(w).WriteAll(data)
+		})
+	}
+
+	// Импорт файла в новую таблицу: сначала предпросмотр колонок и строк
+	importFrom := func(imp tableImporter) {
+		d := dialog.NewFileOpen(func(r fyne.URIReadCloser, err error) {
+			if err != nil {
+				dialog.ShowError(err, win)
+				return
+			}
+			if r == nil {
+				return
+			}
+			defer r.Close()
+			data, types, err := readImport(imp, r)
+			if err != nil {
+				dialog.ShowError(err, win)
+				return
+			}
+			name := strings.TrimSuffix(r.URI().Name(), r.URI().Extension())
+			showImportDialog(win, &activeDlg, &onEnter, "Импорт из "+imp.Name(), name, data, types, func(table string) error {
+				if table == "" {
+					return errors.New("укажите имя таблицы")
+				}
+				res, err := importTable(table, imp.Name(), data, types)
+				if err != nil {
+					return err
+				}
+				showResult(nil, res)
+				return nil
+			})
+		}, win)
+		d.SetFilter(storage.NewExtensionFileFilter(imp.Exts()))
+		d.Resize(fyne.NewSize(winW*0.7, winH*0.7))
+		d.Show()
+	}
+
+	// Выполнение скрипта .csvql с журналом по командам
+	runScriptFile := func() {
+		d := dialog.NewFileOpen(func(r fyne.URIReadCloser, err error) {
+			if err != nil {
+				dialog.ShowError(err, win)
+				return
+			}
+			if r == nil {
+				return
+			}
+			path := r.URI().Path()
+			r.Close()
+			cont := widget.NewCheck("Продолжать после ошибок", nil)
+			content := container.NewVBox(widget.NewLabel("Выполнить команды из "+filepath.Base(path)+"?"), cont)
+			cnf := dialog.NewCustomConfirm("Выполнить скрипт", "Выполнить", "Отмена", content, func(ok bool) {
+				if !ok {
+					return
+				}
+				st := &sourceStmt{file: path, cont: cont.Checked}
+				res, err := execStatement(st)
+				var se *scriptError
+				switch {
+				case errors.As(err, &se):
+					showResult(st, se.res)
+					status.SetText("Ошибка " + err.Error())
+				case err != nil:
+					dialog.ShowError(err, win)
+				default:
+					showResult(st, res)
+				}
+			}, win)
+			cnf.Resize(fyne.NewSize(dialogW, dialogH*0.6))
+			cnf.Show()
+		}, win)
+		d.SetFilter(storage.NewExtensionFileFilter([]string{scriptExt}))
+		if abs, err := filepath.Abs("."); err == nil {
+			if dir, err := storage.ListerForURI(storage.NewFileURI(abs)); err == nil {
+				d.SetLocation(dir)
+			}
+		}
+		d.Resize(fyne.NewSize(winW*0.7, winH*0.7))
+		d.Show()
+	}
+
+	// Сохранение последнего SELECT или FIND как представления
+	saveView := func() {
+		if lastQuery == "" {
+			status.SetText("Сначала выполните SELECT или FIND")
+			return
+		}
+		showFormDialog(win, &activeDlg, &onEnter, "Сохранить как представление", []string{"Имя представления"}, nil, func(v []string) error {
+			name := strings.TrimSpace(v[0])
+			if name == "" {
+				return errors.New("укажите имя представления")
+			}
+			st := &viewStmt{cmd: "create", name: name, query: lastQuery}
+			res, err := execStatement(st)
+			if err != nil {
+				return err
+			}
+			showResult(st, res)
+			return nil
+		})
+	}
+
+	// HTTP API к папке: запросы выполняются в потоке интерфейса,
+	// поэтому изменения через API сразу видны в открытой таблице
+	var apiSrv *http.Server
+	var mainMenu *fyne.MainMenu
+	apiItem := fyne.NewMenuItem("Запустить HTTP API…", nil)
+	apiItem.Action = func() {
+		if apiSrv != nil {
+			_ = apiSrv.Close() // Shutdown ждал бы запросы, которые ждут поток интерфейса
+			apiSrv = nil
+			apiItem.Label = "Запустить HTTP API…"
+			mainMenu.Refresh()
+			status.SetText("HTTP API остановлен")
+			return
+		}
+		showFormDialog(win, &activeDlg, &onEnter, "HTTP API", []string{"Адрес", "Токен"}, []string{apiAddr, newAPIToken()}, func(v []string) error {
+			token := strings.TrimSpace(v[1])
+			if token == "" {
+				return errors.New("укажите токен")
+			}
+			srv := newAPIServer(token)
+			srv.run = fyne.DoAndWait
+			srv.onChange = func(fileName string) {
+				_ = tableListData.Set(getCSVFiles())
+				if fileName == selected && view == nil {
+					reloadSelected()
+				}
+				status.SetText("Таблица " + fileName + " изменена через HTTP API")
+			}
+			hs, addr, err := srv.start(strings.TrimSpace(v[0]))
+			if err != nil {
+				return err
+			}
+			apiSrv = hs
+			apiItem.Label = "Остановить HTTP API"
+			mainMenu.Refresh()
+			myApp.Clipboard().SetContent(token)
+			status.SetText(fmt.Sprintf("HTTP API: http://%s/api/tables, токен скопирован в буфер обмена", addr))
+			return nil
+		})
+	}
+
+	dbItems := []*fyne.MenuItem{
+		fyne.NewMenuItem("Проверить целостность…", func() { runVerify("", false) }),
+		fyne.NewMenuItem("Экспорт в CSV…", exportCurrent),
+	}
+	// форматы расширений
+	for _, exp := range exporters() {
+		dbItems = append(dbItems, fyne.NewMenuItem("Экспорт в "+exp.Name()+"…", func() {
+			exportAs(exp.Name(), exp.Exts()[0], exp.Export)
+		}))
+	}
+	for _, imp := range importers() {
+		dbItems = append(dbItems, fyne.NewMenuItem("Импорт из "+imp.Name()+"…", func() { importFrom(imp) }))
+	}
+	dbItems = append(dbItems,
+		fyne.NewMenuItem("Сохранить запрос как представление…", saveView),
+		fyne.NewMenuItem("Выполнить скрипт…", runScriptFile),
+		fyne.NewMenuItem("Редактор сценариев…", func() {
+			showStarEditor(myApp, func(affected int, err error) {
+				_ = tableListData.Set(getCSVFiles())
+				if view == nil {
+					reloadSelected()
+				}
+				if err != nil {
+					status.SetText("Ошибка сценария: " + err.Error())
+					return
+				}
+				status.SetText(fmt.Sprintf("Сценарий выполнен: изменено строк %d", affected))
+			})
+		}),
+		fyne.NewMenuItemSeparator(),
+		apiItem,
+	)
+	mainMenu = fyne.NewMainMenu(fyne.NewMenu("База данных", dbItems...))
+	win.SetMainMenu(mainMenu)
+
+	commandsDesc := strings.Join(append([]string{
+		"Имена и значения с пробелами берите в кавычки.",
+		"CREATE <table> <col1:type,col2..> - создать таблицу с n-колонок.",
+		"FIND <table> <column> [~|^|<|>|!=] <value> [NOCASE] - найти значение в колонке: ~ содержит, ^ начинается с, /регулярка/i, диапазон 10..50 или 2024-01-01..2024-12-31, NOCASE без учёта регистра, % нечётко с опечатками.",
+		"SET FUZZY <0..1> / SET TRANSLIT ON|OFF - порог сходства и транслитерация для нечёткого поиска.",
+		`SELECT <cols|*> FROM <table> [WHERE ...] [ORDER BY ...] [LIMIT n] [OFFSET m] - выборка; строки в 'одинарных', колонки в "двойных" кавычках; [LEFT] JOIN <table> ON a.col = b.col соединяет таблицы; GROUP BY ... [HAVING ...] с COUNT, SUM, AVG, MIN, MAX, COUNT(DISTINCT x) - итоги по группам, результат можно выгрузить через меню «Экспорт в CSV».`,
+		"INSERT INTO <table> [(cols)] VALUES (...), (...) / UPDATE <table> SET col = expr [WHERE ...] / DELETE FROM <table> [WHERE ...] - изменение данных; DRY RUN <команда> - показать затрагиваемые строки без записи.",
+		"ALTER TABLE <table> ADD <col[:type]> [DEFAULT v] [FIRST|AFTER col] / DROP <col> / RENAME <col> TO <name> / MOVE <col> FIRST|AFTER col / ALTER <col> TYPE <type> [FORCE] - изменение структуры; щелчок по заголовку открывает меню колонки.",
+		"ALTER TABLE <table> ADD <col> AS <выражение> / ALTER <col> AS <выражение> - вычисляемая колонка (показывается курсивом, в CSV не хранится). В выражениях: + - * / % (минус перед именем колонки — через пробел: a - b), || склейка строк, дата ± дни, UPPER, LOWER, TRIM, LENGTH, SUBSTR, REPLACE, CONCAT, ROUND, ABS, FLOOR, CEIL, COALESCE, IF(усл, да, нет), TODAY(), YEAR, MONTH, DAY, ADD_MONTHS, CASE WHEN ... THEN ... ELSE ... END.",
+		"DROP TABLE [IF EXISTS] <table> / TRUNCATE <table> / RENAME TABLE <a> TO <b> [FORCE] / COPY TABLE <a> TO [IF NOT EXISTS] <b> [FORCE] - управление таблицами; существующая таблица перезаписывается только с FORCE.",
+		"CREATE [OR REPLACE] VIEW <name> AS <SELECT|FIND ...> / OPEN VIEW <name> / DROP VIEW [IF EXISTS] <name> - сохранённые запросы; представление из одной таблицы можно править, оно обновляется при изменении CSV.",
+		"SOURCE <файл[.csvql]> [CONTINUE] - выполнить команды из скрипта (разделитель ;), журнал по каждой команде; без CONTINUE остановка на первой ошибке, также меню «Выполнить скрипт…».",
+		"CREATE [OR REPLACE] HOOK <name> ON <table|*> AFTER INSERT, UPDATE, DELETE, CREATE, DROP RUN '<команда>' | LOG '<файл>' / DROP HOOK [IF EXISTS] <name> / HOOKS - хуки изменений: команда получает событие JSON на stdin, LOG дописывает события в файл JSON Lines; команды RUN из чужой папки выполняются после HOOKS TRUST.",
+		`SCRIPT '<код>' / SCRIPT FILE <файл[.star]> - сценарий Starlark для разовых правок: tables(), columns(t), rows(t), transform(t, fn), insert, update, delete, create_table, drop_table, query("select ..."), num, print; также меню «Редактор сценариев…».`,
+		"ENCRYPT / DECRYPT / PASSWD / LOCK <table> - шифрование таблицы паролем.",
+		"VERIFY [table] [FIX] - проверка целостности.",
+	}, pluginUsage()...), " | ")
+	// Позиция ошибки разбора под полем ввода
+	queryErr := widget.NewLabelWithStyle("", fyne.TextAlignLeading, fyne.TextStyle{Monospace: true})
+	queryErr.Hide()
+
+	runKeyCommand := func(ks *keyStmt) {
+		fn := tableFile(ks.table)
+		switch ks.cmd {
+		case "encrypt":
+			showPassphraseDialog(win, &activeDlg, &onEnter, "Зашифровать "+fn, []string{"Пароль", "Повторите пароль"}, func(p []string) error {
+				if p[0] != p[1] {
+					return errors.New("пароли не совпадают")
+				}
+				if err := encryptTable(fn, p[0]); err != nil {
+					return err
+				}
+				status.SetText("Таблица " + fn + " зашифрована")
+				return nil
+			})
+		case "decrypt":
+			showPassphraseDialog(win, &activeDlg, &onEnter, "Расшифровать "+fn, []string{"Пароль"}, func(p []string) error {
+				if err := decryptTable(fn, p[0]); err != nil {
+					return err
+				}
+				status.SetText("Таблица " + fn + " расшифрована")
+				return nil
+			})
+		case "passwd":
+			labels := []string{"Текущий пароль", "Новый пароль", "Повторите новый пароль"}
+			showPassphraseDialog(win, &activeDlg, &onEnter, "Сменить пароль "+fn, labels, func(p []string) error {
+				if p[1] != p[2] {
+					return errors.New("новые пароли не совпадают")
+				}
+				if err := changeTablePassphrase(fn, p[0], p[1]); err != nil {
+					return err
+				}
+				status.SetText("Пароль таблицы " + fn + " изменён")
+				return nil
+			})
+		}
+	}
+
+	history := loadHistory(historyFile)
+	cmdEntry := NewCommandEntry(history)
+	cmdEntry.SetPlaceHolder("Введите команду create, find или select ... (↑↓ история, Ctrl+R поиск, Tab дополнение)")
+	cmdEntry.OnChanged = func(string) { queryErr.Hide() }
+	cmdEntry.OnSearch = func() {
+		showHistorySearch(win, &activeDlg, &onEnter, history, func(cmd string) {
+			cmdEntry.setCommand(cmd)
+			win.Canvas().Focus(cmdEntry)
+		})
+	}
+	cmdEntry.OnSubmitted = func(text string) {
+		_ = history.add(text)
+		st, err := parseQuery(text)
+		if err != nil {
+			status.SetText("Ошибка парсинга " + err.Error())
+			var qe *queryError
+			if errors.As(err, &qe) {
+				queryErr.SetText(qe.caret(text))
+				queryErr.Show()
+			}
+			return
+		}
+		queryErr.Hide()
+
+		// команды с вводом пароля
+		if ks, ok := st.(*keyStmt); ok && ks.cmd != "lock" {
+			runKeyCommand(ks)
+			cmdEntry.SetText("")
+			return
+		}
+
+		res, err := execStatement(st)
+		var locked *tableLockedError
+		if errors.As(err, &locked) {
+			unlockAndRetry(locked.fileName, func() { cmdEntry.OnSubmitted(text) })
+			return
+		}
+		if err != nil {
+			var se *scriptError
+			if errors.As(err, &se) {
+				showResult(st, se.res) // журнал до ошибки
+			}
+			status.SetText("Ошибка " + err.Error())
+			var qe *queryError
+			if errors.As(err, &qe) {
+				queryErr.SetText(qe.caret(text))
+				queryErr.Show()
+			}
+			return
+		}
+		switch st.(type) {
+		case *selectStmt, *findStmt:
+			lastQuery = text
+		}
+		showResult(st, res)
+		cmdEntry.SetText("")
+	}
+
+	/*************** Список представлений ***************/
+	var viewList *widget.List
+	viewList = widget.NewListWithData(
+		viewListData,
+		func() fyne.CanvasObject {
+			del := NewIconAction(theme.DeleteIcon(), cellSize, nil)
+			del.Hide()
+			return container.NewHBox(widget.NewLabel(""), layout.NewSpacer(), del)
+		},
+		func(it binding.DataItem, obj fyne.CanvasObject) {
+			row := obj.(*fyne.Container)
+			fn, _ := it.(binding.String).Get()
+			row.Objects[0].(*widget.Label).SetText(strings.TrimSuffix(fn, viewExt))
+			del := row.Objects[2].(*IconAction)
+			del.SetOnTapped(func() {
+				cnf := dialog.NewConfirm("Удалить представление", fmt.Sprintf("Удалить представление %s? Таблицы не изменятся.", fn), func(ok bool) {
+					if !ok {
+						return
+					}
+					st := &viewStmt{cmd: "drop", name: fn}
+					res, err := execStatement(st)
+					if err != nil {
+						dialog.ShowError(err, win)
+						return
+					}
+					viewList.UnselectAll()
+					showResult(st, res)
+				}, win)
+				cnf.Resize(fyne.NewSize(dialogW, dialogH))
+				cnf.Show()
+			})
+			if view != nil && view.name == fn {
+				del.Show()
+			} else {
+				del.Hide()
+			}
+		},
+	)
+
+	/*************** Глобальный поиск ***************/
+	var hits []searchHit
+	var cancelSearch context.CancelFunc
+	searchSeq := 0 // номер текущего поиска: результаты прежних отбрасываются
+
+	hitsTitle := widget.NewLabel("")
+	hitsList := widget.NewList(
+		func() int { return len(hits) },
+		func() fyne.CanvasObject {
+			rt := widget.NewRichText()
+			rt.Truncation = fyne.TextTruncateEllipsis
+			return rt
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			h := hits[id]
+			rt := obj.(*widget.RichText)
+			prefix := fmt.Sprintf("%s · id %s · %s: ", h.Table, h.ID, h.Column)
+			if h.Score < 1 {
+				prefix = fmt.Sprintf("%.0f%% · ", h.Score*100) + prefix
+			}
+			rt.Segments = []widget.RichTextSegment{
+				&widget.TextSegment{Style: widget.RichTextStyleInline, Text: prefix + h.Before},
+				&widget.TextSegment{Style: widget.RichTextStyleStrong, Text: h.Match},
+				&widget.TextSegment{Style: widget.RichTextStyleInline, Text: h.After},
+			}
+			rt.Refresh()
+		},
+	)
+	hitsList.OnSelected = func(id widget.ListItemID) {
+		h := hits[id]
+		hitsList.Unselect(id)
+		jumpTo(h.Table, h.Row, h.Col)
+		status.SetText(fmt.Sprintf("Таблица %s, id %s, колонка %s", h.Table, h.ID, h.Column))
+	}
+
+	var hitsPanel *fyne.Container
+	stopSearch := func() {
+		if cancelSearch != nil {
+			cancelSearch()
+			cancelSearch = nil
+		}
+		searchSeq++
+	}
+	closeHits := widget.NewButtonWithIcon("", theme.CancelIcon(), func() {
+		stopSearch()
+		hits = nil
+		hitsPanel.Hide()
+	})
+	closeHits.Importance = widget.LowImportance
+	hitsPanel = container.NewBorder(container.NewHBox(hitsTitle, layout.NewSpacer(), closeHits), nil, nil, nil, hitsList)
+	hitsPanel.Hide()
+
+	// нечёткий режим: порог задаётся командой SET FUZZY
+	fuzzyCheck := widget.NewCheck("Нечётко", nil)
+	translitCheck := widget.NewCheck("Транслит", setTranslit)
+	syncSearchOptions = func() {
+		translitCheck.SetChecked(currentFuzzy().translit)
+	}
+
+	searchEntry := NewEscEntry()
+	searchEntry.SetPlaceHolder("Поиск по всем таблицам…")
+	searchEntry.OnEsc = func() {
+		searchEntry.SetText("")
+		closeHits.OnTapped()
+	}
+	searchEntry.OnSubmitted = func(text string) {
+		stopSearch()
+		text = strings.TrimSpace(text)
+		hits = nil
+		hitsList.Refresh()
+		if text == "" {
+			hitsPanel.Hide()
+			return
+		}
+		tables := getCSVFiles()
+		hitsTitle.SetText(fmt.Sprintf("Поиск «%s»…", text))
+		hitsPanel.Show()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancelSearch = cancel
+		seq := searchSeq
+		match := newCellMatcher(text, fuzzyCheck.Checked)
+		go func() {
+			truncated, skipped := searchTables(ctx, tables, match, searchLimit, func(h searchHit) {
+				fyne.Do(func() {
+					if seq != searchSeq {
+						return
+					}
+					// более похожие — выше; равные в порядке нахождения
+					i := sort.Search(len(hits), func(i int) bool { return hits[i].Score < h.Score })
+					hits = slices.Insert(hits, i, h)
+					hitsList.Refresh()
+				})
+			})
+			fyne.Do(func() {
+				if seq != searchSeq {
+					return
+				}
+				cancelSearch = nil
+				msg := fmt.Sprintf("«%s»: совпадений %d в таблицах: %d", text, len(hits), len(tables))
+				if truncated {
+					msg += fmt.Sprintf(", показаны первые %d", searchLimit)
+				}
+				hitsTitle.SetText(msg)
+				if len(skipped) > 0 {
+					status.SetText(fmt.Sprintf("Пропущено таблиц %d: %v", len(skipped), skipped[0]))
+				}
+			})
+		}()
+	}
+
+	// Левая панель 20% — список; правая 80% — таблица + команды снизу
+	leftBg := canvas.NewRectangle(myApp.Settings().Theme().Color(theme.ColorNameInputBackground, myApp.Settings().ThemeVariant()))
+	viewsBox := container.NewBorder(widget.NewLabelWithStyle("Представления", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}), nil, nil, nil, viewList)
+	leftSplit := container.NewVSplit(container.NewMax(leftBg, list), viewsBox)
+	leftSplit.Offset = 0.7
+	leftPanel := widget.NewCard("Таблицы", "", container.NewBorder(container.NewVBox(searchEntry, container.NewHBox(fuzzyCheck, translitCheck)), nil, nil, nil, leftSplit))
+
+	commandsBox := widget.NewCard("Команды", commandsDesc, container.NewPadded(container.NewVBox(cmdEntry, queryErr)))
+	tableArea := container.NewVSplit(dataTable, hitsPanel)
+	tableArea.Offset = 0.65
+	rightPanel := container.NewBorder(nil, container.NewVBox(commandsBox, status), nil, nil, tableArea)
+
+	split := container.NewHSplit(leftPanel, rightPanel)
+	split.Offset = 0.2 // 20% слева, 80% справа
+
+	win.SetContent(split)
+
+	// Выбор таблицы слева
+	list.OnSelected = func(id widget.ListItemID) {
+		fn, err := tableListData.GetValue(id)
+		if err != nil {
+			status.SetText("Ошибка выбора " + err.Error())
+			return
+		}
+		viewList.UnselectAll()
+		showView(nil)
+		selected = fn
+		if data, err := readTableData(fn); errors.Is(err, errTableLocked) {
+			updateTable(nil, fn)
+			unlockAndRetry(fn, func() { list.OnSelected(id) })
+		} else if err != nil {
+			status.SetText("Ошибка " + err.Error())
+			updateTable(nil, fn)
+		} else {
+			updateTable(data, fn)
+		}
+		list.Refresh()
+	}
+
+	// Открытие представления
+	viewList.OnSelected = func(id widget.ListItemID) {
+		fn, err := viewListData.GetValue(id)
+		if err != nil {
+			status.SetText("Ошибка выбора " + err.Error())
+			return
+		}
+		list.UnselectAll()
+		st := &viewStmt{cmd: "open", name: fn}
+		res, err := execStatement(st)
+		var locked *tableLockedError
+		if errors.As(err, &locked) {
+			unlockAndRetry(locked.fileName, func() { viewList.OnSelected(id) })
+			return
+		}
+		if err != nil {
+			status.SetText("Ошибка " + err.Error())
+			return
+		}
+		showResult(st, res)
+		viewList.Refresh()
+	}
+
+	// Команды хуков пришли вместе с папкой: выполнять только с согласия
+	if cmds := untrustedHookCommands("."); len(cmds) > 0 {
+		text := widget.NewLabel("В папке есть хуки, которые при изменении таблиц выполняют команды:\n\n" +
+			strings.Join(cmds, "\n") + "\n\nВыполнять их? Без подтверждения хуки RUN пропускаются.")
+		text.Wrapping = fyne.TextWrapWord
+		dlg := dialog.NewCustomConfirm("Хуки папки", "Выполнять", "Не выполнять", container.NewPadded(text), func(ok bool) {
+			if !ok {
+				return
+			}
+			if err := trustFolderHooks("."); err != nil {
+				dialog.ShowError(err, win)
+				return
+			}
+			status.SetText("Команды хуков подтверждены")
+		}, win)
+		dlg.Resize(fyne.NewSize(dialogW, dialogH))
+		dlg.Show()
+	}
+
+	// Запуск
+	win.ShowAndRun()
+	waitHooks()
+}
+
+/*************** Диалог создания записи ***************/
+func showCreateDialog(
+	win fyne.Window,
+	activeDlg **dialog.ConfirmDialog,
+	onEnter *func(),
+	selected string,
+	current [][]string,
+	onSaved func([][]string),
+) {
+	// Информ-диалог фиксированного размера
+	showSizedInfo := func(title, msg string) {
+		lbl := widget.NewLabel(msg)
+		d := dialog.NewCustom(title, "OK", container.NewPadded(lbl), win)
+		d.Resize(fyne.NewSize(dialogW, dialogH))
+		d.Show()
+	}
+
+	if selected == "" || len(current) == 0 {
+		showSizedInfo("Создание", "Сначала выберите таблицу")
+		return
+	}
+	headers := current[0][1:]
+	if len(headers) == 0 {
+		showSizedInfo("Создание", "Нет редактируемых колонок")
+		return
+	}
+
+	// типы колонок, в том числе проверки расширений, подсвечивают
+	// неверное значение до сохранения
+	tm, err := getTableMeta(selected)
+	if err != nil {
+		dialog.ShowError(err, win)
+		return
+	}
+	types := tm.Types
+	fields := make([]*EscEntry, len(headers))
+	form := container.NewVBox()
+	for i, h := range headers {
 		lbl := widget.NewLabel(h)
 		entry := NewEscEntry()
 		entry.SetPlaceHolder(h)
+		if typ, ok := types[h]; ok {
+			entry.SetPlaceHolder(h + " (" + typ + ")")
+			entry.Validator = func(s string) error { return checkValueType(typ, s) }
+		}
 		entry.Wrapping = fyne.TextWrapOff
 		entry.SetMinRowsVisible(1)
 		fields[i] = entry
@@ -1003,37 +2021,612 @@ func showCreateDialog(
 	dlg.Show()
 }
 
-/*************** Парсер команд ***************/
-func parseQuery(q string) (cmd, table string, args []string, err error) {
-	parts := strings.Fields(q)
-	if len(parts) == 0 {
-		return "", "", nil, fmt.Errorf("пустой запрос")
+/*************** Отчёт проверки целостности ***************/
+func showVerifyDialog(
+	win fyne.Window,
+	title string,
+	issues []verifyIssue,
+	onJump func(table string, row, col int),
+	onFix func() []verifyIssue,
+) {
+	summary := widget.NewLabel("")
+	var issueList *widget.List
+	var fixBtn *widget.Button
+	refresh := func() {
+		fixable := 0
+		for _, is := range issues {
+			if is.Fixable {
+				fixable++
+			}
+		}
+		if onFix == nil {
+			summary.SetText(fmt.Sprintf("Проблем: %d", len(issues)))
+		} else {
+			summary.SetText(fmt.Sprintf("Проблем: %d, исправимых автоматически: %d", len(issues), fixable))
+		}
+		if fixable == 0 {
+			fixBtn.Disable()
+		} else {
+			fixBtn.Enable()
+		}
+		issueList.Refresh()
+	}
+
+	issueList = widget.NewList(
+		func() int { return len(issues) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			text := issues[id].String()
+			if issues[id].Fixable {
+				text += " (исправимо)"
+			}
+			obj.(*widget.Label).SetText(text)
+		},
+	)
+
+	d := dialog.NewCustomWithoutButtons(title, container.NewBorder(summary, nil, nil, nil, issueList), win)
+	issueList.OnSelected = func(id widget.ListItemID) {
+		is := issues[id]
+		issueList.Unselect(id)
+		if is.Row < 0 {
+			return
+		}
+		d.Hide()
+		onJump(is.Table, is.Row, is.Col)
+	}
+	fixBtn = widget.NewButton("Исправить автоматически", func() {
+		issues = onFix()
+		refresh()
+	})
+	fixBtn.Importance = widget.HighImportance
+	if onFix != nil {
+		d.SetButtons([]fyne.CanvasObject{widget.NewButton("Закрыть", d.Hide), fixBtn})
+	} else {
+		// отчёт без автоисправления
+		d.SetButtons([]fyne.CanvasObject{widget.NewButton("Закрыть", d.Hide)})
 	}
-	cmd = strings.ToLower(parts[0])
-	if len(parts) < 2 {
-		return "", "", nil, fmt.Errorf("не указано имя таблицы")
+	refresh()
+	d.Resize(fyne.NewSize(winW*0.6, winH*0.6))
+	d.Show()
+}
+
+/*************** Редактор сценариев ***************/
+
+// многострочное поле кода: Ctrl+Enter выполняет
+type CodeEntry struct {
+	widget.Entry
+	OnRun func()
+}
+
+func NewCodeEntry() *CodeEntry {
+	e := &CodeEntry{}
+	e.MultiLine = true
+	e.Wrapping = fyne.TextWrapOff
+	e.TextStyle = fyne.TextStyle{Monospace: true}
+	e.ExtendBaseWidget(e)
+	return e
+}
+
+func (e *CodeEntry) AcceptsTab() bool { return true }
+
+func (e *CodeEntry) TypedShortcut(s fyne.Shortcut) {
+	if cs, ok := s.(*desktop.CustomShortcut); ok && cs.Modifier == fyne.KeyModifierControl &&
+		(cs.KeyName == fyne.KeyReturn || cs.KeyName == fyne.KeyEnter) {
+		if e.OnRun != nil {
+			e.OnRun()
+		}
+		return
 	}
-	table = parts[1]
+	e.Entry.TypedShortcut(s)
+}
 
-	switch cmd {
-	case "create":
-		if len(parts) < 3 {
-			return "", "", nil, fmt.Errorf("create требует список колонок")
+// Окно сценария Starlark. Код выполняется в фоне, обращения к таблицам —
+// в потоке интерфейса; print выводится по мере выполнения. onDone
+// получает число изменённых строк и ошибку.
+func showStarEditor(a fyne.App, onDone func(affected int, err error)) {
+	w := a.NewWindow("Сценарий Starlark")
+	code := NewCodeEntry()
+	code.SetPlaceHolder(`def fix(row):
+    row["name"] = row["name"].strip()
+
+print(transform("people", fix), "строк изменено")`)
+	output := widget.NewLabelWithStyle("", fyne.TextAlignLeading, fyne.TextStyle{Monospace: true})
+	output.Wrapping = fyne.TextWrapWord
+	outScroll := container.NewVScroll(output)
+	state := widget.NewLabel("Ctrl+Enter — выполнить")
+
+	path := ""
+	var stop chan struct{}
+	var runBtn, stopBtn *widget.Button
+	appendOut := func(s string) {
+		output.SetText(output.Text + s + "\n")
+		outScroll.ScrollToBottom()
+	}
+	run := func() {
+		if stop != nil || strings.TrimSpace(code.Text) == "" {
+			return
 		}
-		colsRaw := strings.Join(parts[2:], " ")
-		args = parseColumns(colsRaw)
-		if len(args) == 0 {
-			return "", "", nil, fmt.Errorf("не найдены названия колонок")
+		name := "сценарий"
+		if path != "" {
+			name = filepath.Base(path)
 		}
-	case "find":
-		if len(parts) < 4 {
-			return "", "", nil, fmt.Errorf("find: укажите колонку и значение")
+		stop = make(chan struct{})
+		env := &starEnv{
+			run:   fyne.DoAndWait,
+			print: func(s string) { fyne.Do(func() { appendOut(s) }) },
+			stop:  stop,
+		}
+		output.SetText("")
+		state.SetText("Выполняется…")
+		runBtn.Disable()
+		stopBtn.Enable()
+		src := code.Text
+		go func() {
+			err := env.exec(name, src)
+			fyne.Do(func() {
+				stop = nil
+				runBtn.Enable()
+				stopBtn.Disable()
+				if err != nil {
+					appendOut("Ошибка: " + err.Error())
+					state.SetText(fmt.Sprintf("Ошибка, изменено строк %d", env.affected))
+				} else {
+					state.SetText(fmt.Sprintf("Выполнено, изменено строк %d", env.affected))
+				}
+				onDone(env.affected, err)
+			})
+		}()
+	}
+	code.OnRun = run
+	runBtn = widget.NewButton("Выполнить", run)
+	runBtn.Importance = widget.HighImportance
+	halt := func() {
+		if stop != nil && !stopBtn.Disabled() {
+			close(stop)
+			stopBtn.Disable()
+		}
+	}
+	stopBtn = widget.NewButton("Остановить", halt)
+	stopBtn.Disable()
+
+	setPath := func(p string) {
+		path = p
+		w.SetTitle("Сценарий Starlark — " + filepath.Base(p))
+	}
+	folder := func(d interface{ SetLocation(fyne.ListableURI) }) {
+		if abs, err := filepath.Abs("."); err == nil {
+			if dir, err := storage.ListerForURI(storage.NewFileURI(abs)); err == nil {
+				d.SetLocation(dir)
+			}
+		}
+	}
+	openBtn := widget.NewButton("Открыть…", func() {
+		d := dialog.NewFileOpen(func(r fyne.URIReadCloser, err error) {
+			if err != nil {
+				dialog.ShowError(err, w)
+				return
+			}
+			if r == nil {
+				return
+			}
+			defer r.Close()
+			raw, err := io.ReadAll(r)
+			if err != nil {
+				dialog.ShowError(err, w)
+				return
+			}
+			code.SetText(string(raw))
+			setPath(r.URI().Path())
+		}, w)
+		d.SetFilter(storage.NewExtensionFileFilter([]string{starExt}))
+		folder(d)
+		d.Show()
+	})
+	saveBtn := widget.NewButton("Сохранить…", func() {
+		if path != "" {
+			if err := os.WriteFile(path, []byte(code.Text), 0644); err != nil {
+				dialog.ShowError(err, w)
+				return
+			}
+			state.SetText("Сохранено в " + filepath.Base(path))
+			return
+		}
+		d := dialog.NewFileSave(func(wc fyne.URIWriteCloser, err error) {
+			if err != nil {
+				dialog.ShowError(err, w)
+				return
+			}
+			if wc == nil {
+				return
+			}
+			defer wc.Close()
+			if _, err := io.WriteString(wc, code.Text); err != nil {
+				dialog.ShowError(err, w)
+				return
+			}
+			setPath(wc.URI().Path())
+			state.SetText("Сохранено в " + filepath.Base(path))
+		}, w)
+		d.SetFileName("fix" + starExt)
+		folder(d)
+		d.Show()
+	})
+	w.SetOnClosed(halt)
+
+	tools := container.NewHBox(openBtn, saveBtn, layout.NewSpacer(), state, stopBtn, runBtn)
+	split := container.NewVSplit(code, outScroll)
+	split.Offset = 0.7
+	w.SetContent(container.NewBorder(tools, nil, nil, nil, split))
+	w.Resize(fyne.NewSize(winW*0.7, winH*0.8))
+	w.Show()
+	w.Canvas().Focus(code)
+}
+
+/*************** Диалог ввода пароля ***************/
+func showPassphraseDialog(
+	win fyne.Window,
+	activeDlg **dialog.ConfirmDialog,
+	onEnter *func(),
+	title string,
+	labels []string,
+	onOK func(values []string) error,
+) {
+	fields := make([]*EscEntry, len(labels))
+	form := container.NewVBox()
+	for i, l := range labels {
+		entry := NewEscEntry()
+		entry.Password = true
+		entry.SetPlaceHolder(l)
+		fields[i] = entry
+		form.Add(container.NewBorder(nil, nil, widget.NewLabel(l), nil, entry))
+	}
+
+	var dlg *dialog.ConfirmDialog
+	commit := func() {
+		values := make([]string, len(fields))
+		for i, f := range fields {
+			values[i] = f.Text
+		}
+		if err := onOK(values); err != nil {
+			dialog.ShowError(err, win)
+		}
+	}
+	closeDlg := func() {
+		if dlg != nil {
+			dlg.Dismiss()
+		}
+		*activeDlg = nil
+		*onEnter = nil
+	}
+	for _, f := range fields {
+		f.OnSubmitted = func(string) {
+			closeDlg()
+			commit()
+		}
+		f.OnEsc = closeDlg
+	}
+
+	dlg = dialog.NewCustomConfirm(title, "OK", "Отмена", container.NewPadded(form), func(ok bool) {
+		*activeDlg = nil
+		*onEnter = nil
+		if ok {
+			commit()
+		}
+	}, win)
+	dlg.Resize(fyne.NewSize(newRecDlgW, editDlgH+float32(len(labels))*48))
+	*activeDlg = dlg
+	*onEnter = func() { commit() }
+	dlg.Show()
+	win.Canvas().Focus(fields[0])
+}
+
+/*************** Диалоги колонок ***************/
+
+// Форма из текстовых полей; Enter — OK, Esc — отмена.
+// Диалог остаётся открытым, если onOK вернул ошибку.
+// Поиск по истории команд (Ctrl+R): список сужается по мере ввода,
+// Enter или щелчок вставляет команду в поле ввода
+func showHistorySearch(
+	win fyne.Window,
+	activeDlg **dialog.ConfirmDialog,
+	onEnter *func(),
+	h *cmdHistory,
+	onPick func(cmd string),
+) {
+	const shown = 200
+	matches := h.search("", shown)
+	picked := 0
+	query := NewEscEntry()
+	query.SetPlaceHolder("Часть команды")
+	list := widget.NewList(
+		func() int { return len(matches) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			obj.(*widget.Label).SetText(matches[id])
+		},
+	)
+
+	var dlg *dialog.ConfirmDialog
+	closeDlg := func() {
+		if dlg != nil {
+			dlg.Dismiss()
+		}
+		*activeDlg = nil
+		*onEnter = nil
+	}
+	pick := func() {
+		if picked < len(matches) {
+			onPick(matches[picked])
 		}
-		col := parts[2]
-		val := strings.Join(parts[3:], " ")
-		args = []string{col, val}
-	default:
-		// поддерживаем только create/find в этой строке команд
 	}
-	return
+	list.OnSelected = func(id widget.ListItemID) {
+		picked = id
+		pick()
+		closeDlg()
+	}
+	query.OnChanged = func(q string) {
+		matches = h.search(q, shown)
+		picked = 0
+		list.UnselectAll()
+		list.Refresh()
+		list.ScrollToTop()
+	}
+	query.OnSubmitted = func(string) {
+		pick()
+		closeDlg()
+	}
+	query.OnEsc = closeDlg
+
+	content := container.NewBorder(query, nil, nil, nil, list)
+	dlg = dialog.NewCustomConfirm("Поиск в истории", "Вставить", "Отмена", content, func(ok bool) {
+		*activeDlg = nil
+		*onEnter = nil
+		if ok {
+			pick()
+		}
+	}, win)
+	dlg.Resize(fyne.NewSize(winW*0.6, winH*0.6))
+	*activeDlg = dlg
+	*onEnter = pick
+	dlg.Show()
+	win.Canvas().Focus(query)
+}
+
+func showFormDialog(
+	win fyne.Window,
+	activeDlg **dialog.ConfirmDialog,
+	onEnter *func(),
+	title string,
+	labels, values []string,
+	onOK func(values []string) error,
+) {
+	fields := make([]*EscEntry, len(labels))
+	form := container.NewVBox()
+	for i, l := range labels {
+		entry := NewEscEntry()
+		if i < len(values) {
+			entry.SetText(values[i])
+		}
+		fields[i] = entry
+		form.Add(container.NewBorder(nil, nil, widget.NewLabel(l), nil, entry))
+	}
+
+	var dlg *dialog.ConfirmDialog
+	closeDlg := func() {
+		if dlg != nil {
+			dlg.Dismiss()
+		}
+		*activeDlg = nil
+		*onEnter = nil
+	}
+	commit := func() bool {
+		vals := make([]string, len(fields))
+		for i, f := range fields {
+			vals[i] = f.Text
+		}
+		if err := onOK(vals); err != nil {
+			dialog.ShowError(err, win)
+			return false
+		}
+		return true
+	}
+	for _, f := range fields {
+		f.OnSubmitted = func(string) {
+			if commit() {
+				closeDlg()
+			}
+		}
+		f.OnEsc = closeDlg
+	}
+
+	dlg = dialog.NewCustomConfirm(title, "OK", "Отмена", container.NewPadded(form), func(ok bool) {
+		*activeDlg = nil
+		*onEnter = nil
+		if ok {
+			commit()
+		}
+	}, win)
+	dlg.Resize(fyne.NewSize(newRecDlgW, editDlgH+float32(len(labels))*48))
+	*activeDlg = dlg
+	*onEnter = func() {
+		if commit() {
+			closeDlg()
+		}
+	}
+	dlg.Show()
+	win.Canvas().Focus(fields[0])
+}
+
+// Предпросмотр импорта: колонки с типами, первые строки и имя новой таблицы
+func showImportDialog(
+	win fyne.Window,
+	activeDlg **dialog.ConfirmDialog,
+	onEnter *func(),
+	title, name string,
+	data [][]string,
+	types map[string]string,
+	onOK func(table string) error,
+) {
+	const previewRows = 50
+	header := data[0]
+	shown := data[:min(len(data), previewRows+1)]
+	preview := widget.NewTable(
+		func() (int, int) { return len(shown), len(header) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(id widget.TableCellID, obj fyne.CanvasObject) {
+			lbl := obj.(*widget.Label)
+			lbl.Truncation = fyne.TextTruncateEllipsis
+			text := cellAt(shown[id.Row], id.Col)
+			if id.Row == 0 {
+				if typ, ok := types[text]; ok {
+					text += " : " + typ
+				}
+			}
+			lbl.TextStyle = fyne.TextStyle{Bold: id.Row == 0}
+			lbl.SetText(text)
+		},
+	)
+	for c := range header {
+		preview.SetColumnWidth(c, 140)
+	}
+	preview.SetColumnWidth(0, 60)
+
+	info := fmt.Sprintf("Строк %d, колонок %d", len(data)-1, len(header)-1)
+	if len(data)-1 > previewRows {
+		info += fmt.Sprintf(", показаны первые %d", previewRows)
+	}
+	entry := NewEscEntry()
+	entry.SetText(name)
+
+	var dlg *dialog.ConfirmDialog
+	closeDlg := func() {
+		if dlg != nil {
+			dlg.Dismiss()
+		}
+		*activeDlg = nil
+		*onEnter = nil
+	}
+	commit := func() bool {
+		if err := onOK(strings.TrimSpace(entry.Text)); err != nil {
+			dialog.ShowError(err, win)
+			return false
+		}
+		return true
+	}
+	entry.OnSubmitted = func(string) {
+		if commit() {
+			closeDlg()
+		}
+	}
+	entry.OnEsc = closeDlg
+
+	top := container.NewVBox(
+		container.NewBorder(nil, nil, widget.NewLabel("Имя таблицы"), nil, entry),
+		widget.NewLabel(info),
+	)
+	dlg = dialog.NewCustomConfirm(title, "Импортировать", "Отмена", container.NewBorder(top, nil, nil, nil, preview), func(ok bool) {
+		*activeDlg = nil
+		*onEnter = nil
+		if ok {
+			commit()
+		}
+	}, win)
+	dlg.Resize(fyne.NewSize(winW*0.7, winH*0.7))
+	*activeDlg = dlg
+	*onEnter = func() {
+		if commit() {
+			closeDlg()
+		}
+	}
+	dlg.Show()
+	win.Canvas().Focus(entry)
+}
+
+// Новая колонка: имя, тип и значение по умолчанию для существующих строк
+func showAddColumnDialog(
+	win fyne.Window,
+	activeDlg **dialog.ConfirmDialog,
+	onEnter *func(),
+	onOK func(name, typ, def string) error,
+) {
+	name := NewEscEntry()
+	name.SetPlaceHolder("Имя колонки")
+	def := NewEscEntry()
+	def.SetPlaceHolder("Пусто")
+	typSel := widget.NewSelect(columnTypes, nil)
+	typSel.SetSelected(typeText)
+
+	var dlg *dialog.ConfirmDialog
+	closeDlg := func() {
+		if dlg != nil {
+			dlg.Dismiss()
+		}
+		*activeDlg = nil
+		*onEnter = nil
+	}
+	commit := func() bool {
+		if strings.TrimSpace(name.Text) == "" {
+			dialog.ShowError(errors.New("укажите имя колонки"), win)
+			return false
+		}
+		if err := onOK(strings.TrimSpace(name.Text), typSel.Selected, def.Text); err != nil {
+			dialog.ShowError(err, win)
+			return false
+		}
+		return true
+	}
+	for _, e := range []*EscEntry{name, def} {
+		e.OnSubmitted = func(string) {
+			if commit() {
+				closeDlg()
+			}
+		}
+		e.OnEsc = closeDlg
+	}
+
+	form := container.NewVBox(
+		container.NewBorder(nil, nil, widget.NewLabel("Имя"), nil, name),
+		container.NewBorder(nil, nil, widget.NewLabel("Тип"), nil, typSel),
+		container.NewBorder(nil, nil, widget.NewLabel("По умолчанию"), nil, def),
+	)
+	dlg = dialog.NewCustomConfirm("Добавить колонку", "Добавить", "Отмена", container.NewPadded(form), func(ok bool) {
+		*activeDlg = nil
+		*onEnter = nil
+		if ok {
+			commit()
+		}
+	}, win)
+	dlg.Resize(fyne.NewSize(newRecDlgW, editDlgH+3*48))
+	*activeDlg = dlg
+	*onEnter = func() {
+		if commit() {
+			closeDlg()
+		}
+	}
+	dlg.Show()
+	win.Canvas().Focus(name)
+}
+
+// Смена типа колонки; отчёт о непреобразуемых значениях показывает вызывающая сторона
+func showRetypeDialog(win fyne.Window, column, current string, onOK func(typ string, force bool) error) {
+	if current == "" {
+		current = typeText
+	}
+	typSel := widget.NewSelect(columnTypes, nil)
+	typSel.SetSelected(current)
+	force := widget.NewCheck("Очистить значения, которые не удалось преобразовать", nil)
+	form := container.NewVBox(
+		container.NewBorder(nil, nil, widget.NewLabel("Тип"), nil, typSel),
+		force,
+	)
+	dlg := dialog.NewCustomConfirm("Тип колонки "+column, "Применить", "Отмена", container.NewPadded(form), func(ok bool) {
+		if !ok || typSel.Selected == current && !force.Checked {
+			return
+		}
+		if err := onOK(typSel.Selected, force.Checked); err != nil {
+			dialog.ShowError(err, win)
+		}
+	}, win)
+	dlg.Resize(fyne.NewSize(newRecDlgW, editDlgH+2*48))
+	dlg.Show()
 }
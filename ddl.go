@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// --- Управление таблицами ---
+//
+// DROP TABLE [IF EXISTS] <table>
+// TRUNCATE [TABLE] [IF EXISTS] <table>
+// RENAME TABLE [IF EXISTS] <table> TO [IF NOT EXISTS] <new> [FORCE]
+// COPY TABLE [IF EXISTS] <table> TO [IF NOT EXISTS] <new> [FORCE]
+//
+// IF EXISTS — не ошибка, если исходной таблицы нет; IF NOT EXISTS —
+// пропустить команду, если таблица назначения уже есть; FORCE —
+// перезаписать существующую таблицу назначения.
+
+type tableStmt struct {
+	cmd         string // drop, truncate, rename, copy
+	table       string
+	target      string
+	ifExists    bool
+	ifNotExists bool
+	force       bool
+}
+
+func (*tableStmt) statementNode() {}
+
+func (p *parser) acceptIfExists() (bool, error) {
+	if !p.acceptKeyword("if") {
+		return false, nil
+	}
+	return true, p.expectKeyword("exists")
+}
+
+func (p *parser) acceptIfNotExists() (bool, error) {
+	if !p.acceptKeyword("if") {
+		return false, nil
+	}
+	if err := p.expectKeyword("not"); err != nil {
+		return false, err
+	}
+	return true, p.expectKeyword("exists")
+}
+
+func (p *parser) parseTableCmd(cmd string) (*tableStmt, error) {
+	st := &tableStmt{cmd: cmd}
+	if cmd == "truncate" {
+		p.acceptKeyword("table")
+	} else if err := p.expectKeyword("table"); err != nil {
+		return nil, err
+	}
+	var err error
+	if st.ifExists, err = p.acceptIfExists(); err != nil {
+		return nil, err
+	}
+	if st.table, err = p.name("имя таблицы"); err != nil {
+		return nil, err
+	}
+	if cmd != "rename" && cmd != "copy" {
+		return st, nil
+	}
+	if err := p.expectKeyword("to"); err != nil {
+		return nil, err
+	}
+	if st.ifNotExists, err = p.acceptIfNotExists(); err != nil {
+		return nil, err
+	}
+	if st.target, err = p.name("имя новой таблицы"); err != nil {
+		return nil, err
+	}
+	forceTok := p.tok
+	if st.force = p.acceptKeyword("force"); st.force && st.ifNotExists {
+		return nil, p.errorf(forceTok, "FORCE нельзя сочетать с IF NOT EXISTS")
+	}
+	return st, nil
+}
+
+func execTableCmd(st *tableStmt) (*queryResult, error) {
+	fileName := tableFile(st.table)
+	res := &queryResult{Table: fileName}
+	if !tableExists(fileName) {
+		if st.ifExists {
+			return &queryResult{Message: fmt.Sprintf("Таблица %s не найдена, команда пропущена", fileName)}, nil
+		}
+		return nil, fmt.Errorf("таблица '%s' не найдена", st.table)
+	}
+
+	target := tableFile(st.target)
+	var err error
+	switch st.cmd {
+	case "drop":
+		err = deleteTable(fileName)
+		res.Message = fmt.Sprintf("Таблица %s удалена", fileName)
+	case "truncate":
+		if res.Affected, err = truncateTable(fileName); err == nil {
+			res.Data, err = readTableData(fileName)
+		}
+		res.Message = fmt.Sprintf("Таблица %s очищена, удалено строк %d", fileName, res.Affected)
+	case "rename":
+		err = renameTable(fileName, target, st.force)
+		res.Message = fmt.Sprintf("Таблица %s переименована в %s", fileName, target)
+	case "copy":
+		err = copyTable(fileName, target, st.force)
+		res.Message = fmt.Sprintf("Таблица %s скопирована в %s", fileName, target)
+	}
+	if errors.Is(err, errTableExists) && st.ifNotExists {
+		return &queryResult{Message: fmt.Sprintf("Таблица %s уже существует, команда пропущена", target)}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
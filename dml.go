@@ -0,0 +1,456 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// --- INSERT, UPDATE, DELETE ---
+//
+// INSERT INTO <table> [(col, ...)] VALUES (v, ...), (v, ...)
+// UPDATE <table> SET col = <выражение>, ... [WHERE <условие>]
+// DELETE FROM <table> [WHERE <условие>]
+// DRY RUN <команда> — показать затрагиваемые строки без записи
+
+type insertStmt struct {
+	table   string
+	columns []string // пусто — все колонки, кроме id, по порядку
+	colPos  []int
+	rows    [][]expr
+}
+
+type setClause struct {
+	column string
+	pos    int
+	expr   expr
+}
+
+type updateStmt struct {
+	table string
+	sets  []setClause
+	where expr
+}
+
+type deleteStmt struct {
+	table string
+	where expr
+}
+
+type dryRunStmt struct {
+	stmt statement
+}
+
+func (*insertStmt) statementNode() {}
+func (*updateStmt) statementNode() {}
+func (*deleteStmt) statementNode() {}
+func (*dryRunStmt) statementNode() {}
+
+func (p *parser) parseInsert() (*insertStmt, error) {
+	if err := p.expectKeyword("into"); err != nil {
+		return nil, err
+	}
+	table, err := p.name("имя таблицы")
+	if err != nil {
+		return nil, err
+	}
+	st := &insertStmt{table: table}
+	if p.acceptOp("(") {
+		for {
+			pos := p.tok.pos
+			col, err := p.name("имя колонки")
+			if err != nil {
+				return nil, err
+			}
+			st.columns = append(st.columns, col)
+			st.colPos = append(st.colPos, pos)
+			if !p.acceptOp(",") {
+				break
+			}
+		}
+		if err := p.expectOp(")"); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expectKeyword("values"); err != nil {
+		return nil, err
+	}
+	for {
+		if err := p.expectOp("("); err != nil {
+			return nil, err
+		}
+		var row []expr
+		for {
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			row = append(row, e)
+			if !p.acceptOp(",") {
+				break
+			}
+		}
+		if err := p.expectOp(")"); err != nil {
+			return nil, err
+		}
+		st.rows = append(st.rows, row)
+		if !p.acceptOp(",") {
+			return st, nil
+		}
+	}
+}
+
+func (p *parser) parseUpdate() (*updateStmt, error) {
+	table, err := p.name("имя таблицы")
+	if err != nil {
+		return nil, err
+	}
+	st := &updateStmt{table: table}
+	if err := p.expectKeyword("set"); err != nil {
+		return nil, err
+	}
+	for {
+		sc := setClause{pos: p.tok.pos}
+		if sc.column, err = p.name("имя колонки"); err != nil {
+			return nil, err
+		}
+		if err := p.expectOp("="); err != nil {
+			return nil, err
+		}
+		if sc.expr, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+		st.sets = append(st.sets, sc)
+		if !p.acceptOp(",") {
+			break
+		}
+	}
+	if p.acceptKeyword("where") {
+		if st.where, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	return st, nil
+}
+
+func (p *parser) parseDelete() (*deleteStmt, error) {
+	if err := p.expectKeyword("from"); err != nil {
+		return nil, err
+	}
+	table, err := p.name("имя таблицы")
+	if err != nil {
+		return nil, err
+	}
+	st := &deleteStmt{table: table}
+	if p.acceptKeyword("where") {
+		if st.where, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	return st, nil
+}
+
+// индекс колонки для изменения; колонку id менять нельзя
+func writableColumn(header []string, name string, pos int) (int, error) {
+	switch i := columnIndex(header, name); {
+	case i < 0:
+		return -1, &queryError{pos: pos, msg: fmt.Sprintf("колонка '%s' не найдена", name)}
+	case i == 0:
+		return -1, &queryError{pos: pos, msg: "колонка id назначается автоматически и не изменяется"}
+	default:
+		return i, nil
+	}
+}
+
+// значение выражения как текст ячейки; ссылка на колонку копирует ячейку как есть
+func exprString(e expr, env *rowEnv) (string, error) {
+	if c, ok := e.(*colRef); ok {
+		if err := c.bind(env.scope); err != nil {
+			return "", err
+		}
+		return cellAt(env.row, c.idx), nil
+	}
+	v, err := e.eval(env)
+	if err != nil {
+		return "", err
+	}
+	return v.String(), nil
+}
+
+// подготовка строк INSERT: значения без id в порядке колонок таблицы
+func planInsert(st *insertStmt) (header []string, rows [][]string, err error) {
+	fileName := tableFile(st.table)
+	if !tableExists(fileName) {
+		return nil, nil, fmt.Errorf("таблица '%s' не найдена", st.table)
+	}
+	if header, err = readHeader(fileName); err != nil {
+		return nil, nil, err
+	}
+	if len(header) == 0 {
+		return nil, nil, errors.New("таблица без заголовка")
+	}
+	idx := make([]int, 0, len(header)-1)
+	if len(st.columns) == 0 {
+		for i := 1; i < len(header); i++ {
+			idx = append(idx, i)
+		}
+	} else {
+		for k, col := range st.columns {
+			i, err := writableColumn(header, col, st.colPos[k])
+			if err != nil {
+				return nil, nil, err
+			}
+			idx = append(idx, i)
+		}
+	}
+
+	tm, err := getTableMeta(fileName)
+	if err != nil {
+		return nil, nil, err
+	}
+	types := tm.Types
+	env := &rowEnv{scope: &columnScope{}}
+	for n, vals := range st.rows {
+		if len(vals) != len(idx) {
+			return nil, nil, fmt.Errorf("строка %d: ожидалось значений %d, получено %d", n+1, len(idx), len(vals))
+		}
+		row := make([]string, len(header)-1)
+		for k, e := range vals {
+			s, err := exprString(e, env)
+			if err != nil {
+				return nil, nil, err
+			}
+			row[idx[k]-1] = s
+		}
+		if err := validateRow(types, header[1:], row); err != nil {
+			return nil, nil, fmt.Errorf("строка %d: %w", n+1, err)
+		}
+		rows = append(rows, row)
+	}
+	return header, rows, nil
+}
+
+// подготовка UPDATE: данные таблицы с применёнными изменениями и номера изменённых строк
+func planUpdate(st *updateStmt) (data [][]string, changed []int, err error) {
+	fileName := tableFile(st.table)
+	if data, err = readTableData(fileName); err != nil {
+		return nil, nil, err
+	}
+	if len(data) == 0 {
+		return nil, nil, errors.New("таблица пуста")
+	}
+	header := data[0]
+	// вычисляемые колонки доступны в выражениях, но не в SET
+	cs, err := loadComputed(fileName, header)
+	if err != nil {
+		return nil, nil, err
+	}
+	scopeHeader := header
+	if cs != nil {
+		scopeHeader = cs.header(header)
+	}
+	scope := tableScope(fileName, strings.TrimSuffix(st.table, ".csv"), scopeHeader)
+	if err := bindExpr(st.where, scope); err != nil {
+		return nil, nil, err
+	}
+	cols := make([]int, len(st.sets))
+	for k, sc := range st.sets {
+		if cs != nil && columnIndex(cs.names, sc.column) >= 0 {
+			return nil, nil, &queryError{pos: sc.pos, msg: fmt.Sprintf("колонка '%s' вычисляемая, её значение задаёт выражение", sc.column)}
+		}
+		if cols[k], err = writableColumn(header, sc.column, sc.pos); err != nil {
+			return nil, nil, err
+		}
+		if err := bindExpr(sc.expr, scope); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	tm, err := getTableMeta(fileName)
+	if err != nil {
+		return nil, nil, err
+	}
+	types := tm.Types
+	env := &rowEnv{scope: scope}
+	for r := 1; r < len(data); r++ {
+		env.row = data[r]
+		if cs != nil {
+			env.row = cs.extend(data[r])
+		}
+		if st.where != nil {
+			v, err := st.where.eval(env)
+			if err != nil {
+				return nil, nil, err
+			}
+			if !v.truthy() {
+				continue
+			}
+		}
+		// все выражения SET вычисляются по исходной строке
+		updated := append([]string(nil), data[r]...)
+		for k, sc := range st.sets {
+			s, err := exprString(sc.expr, env)
+			if err != nil {
+				return nil, nil, err
+			}
+			updated[cols[k]] = s
+		}
+		if err := validateRow(types, header, updated); err != nil {
+			return nil, nil, fmt.Errorf("id %s: %w", updated[0], err)
+		}
+		data[r] = updated
+		changed = append(changed, r)
+	}
+	return data, changed, nil
+}
+
+// подготовка DELETE: заголовок и удаляемые строки
+func planDelete(st *deleteStmt) (header []string, rows [][]string, err error) {
+	fileName := tableFile(st.table)
+	sc, err := openTableScanner(fileName)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer sc.Close()
+	scopeHeader, next, err := withComputed(fileName, sc.header, sc.next)
+	if err != nil {
+		return nil, nil, err
+	}
+	scope := tableScope(fileName, strings.TrimSuffix(st.table, ".csv"), scopeHeader)
+	if err := bindExpr(st.where, scope); err != nil {
+		return nil, nil, err
+	}
+	env := &rowEnv{scope: scope}
+	for {
+		rec, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if st.where != nil {
+			env.row = rec
+			v, err := st.where.eval(env)
+			if err != nil {
+				return nil, nil, err
+			}
+			if !v.truthy() {
+				continue
+			}
+		}
+		rows = append(rows, rec[:min(len(rec), len(sc.header))])
+	}
+	return sc.header, rows, nil
+}
+
+func execInsert(st *insertStmt, dry bool) (*queryResult, error) {
+	fileName := tableFile(st.table)
+	header, rows, err := planInsert(st)
+	if err != nil {
+		return nil, err
+	}
+	if dry {
+		next, err := getNextID(fileName)
+		if err != nil {
+			return nil, err
+		}
+		preview := [][]string{header}
+		for i, row := range rows {
+			preview = append(preview, append([]string{strconv.Itoa(next + i)}, row...))
+		}
+		return dryRunResult(fileName, preview, "добавлено", len(rows)), nil
+	}
+	// одна строка дописывается в конец файла, несколько — одной записью таблицы
+	switch len(rows) {
+	case 0:
+	case 1:
+		err = insertRecord(fileName, rows[0])
+	default:
+		err = insertRecords(fileName, rows)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return mutationResult(fileName, "Добавлено", len(rows)), nil
+}
+
+func execUpdate(st *updateStmt, dry bool) (*queryResult, error) {
+	fileName := tableFile(st.table)
+	data, changed, err := planUpdate(st)
+	if err != nil {
+		return nil, err
+	}
+	if dry {
+		preview := [][]string{data[0]}
+		for _, r := range changed {
+			preview = append(preview, data[r])
+		}
+		return dryRunResult(fileName, preview, "изменено", len(changed)), nil
+	}
+	if len(changed) > 0 {
+		if err := saveTableData(fileName, data); err != nil {
+			return nil, err
+		}
+	}
+	return mutationResult(fileName, "Изменено", len(changed)), nil
+}
+
+func execDelete(st *deleteStmt, dry bool) (*queryResult, error) {
+	fileName := tableFile(st.table)
+	header, rows, err := planDelete(st)
+	if err != nil {
+		return nil, err
+	}
+	if dry {
+		return dryRunResult(fileName, append([][]string{header}, rows...), "удалено", len(rows)), nil
+	}
+	switch len(rows) {
+	case 0:
+	case 1:
+		if err := deleteRecord(fileName, rows[0][0]); err != nil {
+			return nil, err
+		}
+	default:
+		data, err := readTableData(fileName)
+		if err != nil {
+			return nil, err
+		}
+		drop := map[string]bool{}
+		for _, r := range rows {
+			drop[r[0]] = true
+		}
+		kept := data[:1]
+		for _, r := range data[1:] {
+			if !drop[r[0]] {
+				kept = append(kept, r)
+			}
+		}
+		if err := saveTableData(fileName, kept); err != nil {
+			return nil, err
+		}
+	}
+	return mutationResult(fileName, "Удалено", len(rows)), nil
+}
+
+// Результат изменения — только сообщение и число строк; окно само
+// перечитывает таблицу (showResult), строке csvdb таблица не нужна.
+func mutationResult(fileName, verb string, n int) *queryResult {
+	return &queryResult{
+		Table:    fileName,
+		Affected: n,
+		Message:  fmt.Sprintf("%s строк %d в таблице %s", verb, n, fileName),
+	}
+}
+
+func dryRunResult(fileName string, preview [][]string, verb string, n int) *queryResult {
+	return &queryResult{
+		Table:    fileName,
+		Data:     preview,
+		ReadOnly: true,
+		Affected: n,
+		Message:  fmt.Sprintf("Пробный запуск: будет %s строк %d в таблице %s, изменения не сохранены", verb, n, fileName),
+	}
+}
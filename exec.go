@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// результат выполнения команды
+type queryResult struct {
+	Table    string        // файл таблицы, к которой относится результат
+	Data     [][]string    // заголовок и строки; nil — команда без табличного результата
+	ReadOnly bool          // результат нельзя редактировать в сетке
+	Message  string        // текст для строки состояния
+	Affected int           // число добавленных, изменённых или удалённых строк
+	Issues   []verifyIssue // отчёт VERIFY
+	View     *viewInfo     // открытое представление
+}
+
+// Выполнение команды без участия интерфейса. Команды, которым нужен
+// ввод пароля (ENCRYPT, DECRYPT, PASSWD), обрабатывает вызывающая сторона.
+func execStatement(st statement) (*queryResult, error) {
+	switch st := st.(type) {
+	case *createStmt:
+		fileName := tableFile(st.table)
+		err := createTable(st.table, st.columns)
+		if errors.Is(err, errTableExists) && st.ifNotExists {
+			return &queryResult{Table: fileName, Message: "Таблица " + st.table + " уже существует, команда пропущена"}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		header, err := readHeader(fileName)
+		if err != nil {
+			return nil, err
+		}
+		return &queryResult{
+			Table:   fileName,
+			Data:    [][]string{header},
+			Message: "Таблица " + st.table + " создана: " + strings.Join(header[1:], ", "),
+		}, nil
+	case *findStmt:
+		data, err := findRecord(st.table, st.column, st.match)
+		if err != nil {
+			return nil, err
+		}
+		return &queryResult{
+			Table:   tableFile(st.table),
+			Data:    data,
+			Message: fmt.Sprintf("Найдено записей %d", len(data)-1),
+		}, nil
+	case *selectStmt:
+		return execSelect(st)
+	case *insertStmt:
+		return execInsert(st, false)
+	case *updateStmt:
+		return execUpdate(st, false)
+	case *deleteStmt:
+		return execDelete(st, false)
+	case *alterStmt:
+		return execAlter(st)
+	case *setStmt:
+		return execSet(st)
+	case *viewStmt:
+		return execView(st)
+	case *hookStmt:
+		return execHook(st)
+	case *pluginStmt:
+		return execPlugin(st)
+	case *sourceStmt:
+		return execSource(st)
+	case *starStmt:
+		return execStar(st)
+	case *tableStmt:
+		return execTableCmd(st)
+	case *dryRunStmt:
+		switch inner := st.stmt.(type) {
+		case *insertStmt:
+			return execInsert(inner, true)
+		case *updateStmt:
+			return execUpdate(inner, true)
+		case *deleteStmt:
+			return execDelete(inner, true)
+		}
+	case *verifyStmt:
+		var issues []verifyIssue
+		dir := "."
+		if st.table != "" {
+			fileName := tableFile(st.table)
+			dir = filepath.Dir(fileName)
+			issues = verifyTable(fileName)
+		} else {
+			issues = verifyDatabase(dir)
+		}
+		if st.fix {
+			issues = fixIssues(dir, issues)
+		}
+		msg := "Проверка завершена: проблем не найдено"
+		if len(issues) > 0 {
+			msg = fmt.Sprintf("Проверка завершена: найдено проблем %d", len(issues))
+		}
+		return &queryResult{Issues: issues, Message: msg}, nil
+	case *keyStmt:
+		if st.cmd != "lock" {
+			return nil, fmt.Errorf("команда %s требует ввода пароля", strings.ToUpper(st.cmd))
+		}
+		lockTable(st.table)
+		fileName := tableFile(st.table)
+		return &queryResult{Table: fileName, Message: "Таблица " + fileName + " заблокирована"}, nil
+	}
+	return nil, errors.New("неподдерживаемая команда")
+}
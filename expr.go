@@ -0,0 +1,695 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// --- Выражения запросов ---
+//
+// Значения в CSV — строки; пустая ячейка считается NULL. Тип значения
+// колонки берётся из объявленного типа (meta), а для колонок без типа
+// числа распознаются при сравнении.
+
+type valueKind int
+
+const (
+	valNull valueKind = iota
+	valText
+	valNumber
+	valBool
+)
+
+type value struct {
+	kind valueKind
+	s    string
+	n    float64
+	b    bool
+}
+
+var nullValue = value{kind: valNull}
+
+func textValue(s string) value    { return value{kind: valText, s: s} }
+func numberValue(n float64) value { return value{kind: valNumber, n: n} }
+func boolValue(b bool) value      { return value{kind: valBool, b: b} }
+
+// значение ячейки с учётом объявленного типа колонки
+func cellValue(s, typ string) value {
+	if strings.TrimSpace(s) == "" {
+		return nullValue
+	}
+	switch typ {
+	case typeInt, typeFloat:
+		if n, err := parseNumber(s); err == nil {
+			return numberValue(n)
+		}
+	case typeBool:
+		if b, err := parseBool(s); err == nil {
+			return boolValue(b)
+		}
+	}
+	return textValue(s)
+}
+
+func (v value) String() string {
+	switch v.kind {
+	case valNull:
+		return ""
+	case valNumber:
+		if v.n == math.Trunc(v.n) && math.Abs(v.n) < 1e15 {
+			return strconv.FormatInt(int64(v.n), 10)
+		}
+		return strconv.FormatFloat(v.n, 'f', -1, 64)
+	case valBool:
+		if v.b {
+			return "true"
+		}
+		return "false"
+	}
+	return v.s
+}
+
+func (v value) isNull() bool { return v.kind == valNull }
+
+// числовое представление: числа и текст, похожий на число
+func (v value) number() (float64, bool) {
+	switch v.kind {
+	case valNumber:
+		return v.n, true
+	case valText:
+		if n, err := parseNumber(v.s); err == nil {
+			return n, true
+		}
+	}
+	return 0, false
+}
+
+func (v value) truthy() bool {
+	switch v.kind {
+	case valBool:
+		return v.b
+	case valNumber:
+		return v.n != 0
+	case valText:
+		if b, err := parseBool(v.s); err == nil {
+			return b
+		}
+		return v.s != ""
+	}
+	return false
+}
+
+// Сравнение двух значений: числа — численно, даты — по времени,
+// остальное — как строки. NULL сравнивается как пустая строка; в
+// условиях сравнение с NULL ложно, пустые ячейки находит только IS NULL.
+func compareValues(a, b value) int {
+	if a.kind == valBool && b.kind == valBool {
+		switch {
+		case a.b == b.b:
+			return 0
+		case !a.b:
+			return -1
+		}
+		return 1
+	}
+	if x, ok := a.number(); ok {
+		if y, ok := b.number(); ok {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	as, bs := a.String(), b.String()
+	if a.kind == valText && b.kind == valText {
+		if x, err := parseDate(as); err == nil {
+			if y, err := parseDate(bs); err == nil {
+				return x.Compare(y)
+			}
+		}
+	}
+	return strings.Compare(as, bs)
+}
+
+// --- Область видимости колонок ---
+
+type columnScope struct {
+	names []string // имена колонок
+	quals []string // псевдоним таблицы для каждой колонки
+	types []string // объявленные типы
+}
+
+func (s *columnScope) add(qual, name, typ string) {
+	s.names = append(s.names, name)
+	s.quals = append(s.quals, qual)
+	s.types = append(s.types, typ)
+}
+
+// Колонки таблицы с типами из метаданных. Ошибку метаданных сообщает
+// loadComputed, которую вызывают до построения области.
+func tableScope(fileName, qual string, header []string) *columnScope {
+	tm, _ := getTableMeta(fileName)
+	types := tm.Types
+	s := &columnScope{}
+	for _, h := range header {
+		s.add(qual, h, types[h])
+	}
+	return s
+}
+
+// поиск колонки без учёта регистра; qual — необязательный псевдоним таблицы
+func (s *columnScope) resolve(qual, name string) (int, error) {
+	found := -1
+	for i, n := range s.names {
+		if !strings.EqualFold(n, name) || qual != "" && !strings.EqualFold(s.quals[i], qual) {
+			continue
+		}
+		if found >= 0 {
+			return -1, fmt.Errorf("колонка '%s' неоднозначна, укажите таблицу", name)
+		}
+		found = i
+	}
+	if found < 0 {
+		if qual != "" {
+			return -1, fmt.Errorf("колонка '%s.%s' не найдена", qual, name)
+		}
+		return -1, fmt.Errorf("колонка '%s' не найдена", name)
+	}
+	return found, nil
+}
+
+// заголовок колонки: имя, а при совпадении имён у разных таблиц — t.имя
+func (s *columnScope) title(i int) string {
+	for j, n := range s.names {
+		if j != i && strings.EqualFold(n, s.names[i]) && s.quals[i] != "" {
+			return s.quals[i] + "." + s.names[i]
+		}
+	}
+	return s.names[i]
+}
+
+type rowEnv struct {
+	scope *columnScope
+	row   []string
+	aggs  []value // значения агрегатов группы
+}
+
+// --- Узлы выражений ---
+
+type expr interface {
+	eval(env *rowEnv) (value, error)
+}
+
+type literalExpr struct{ v value }
+
+// ссылка на колонку: name или qual.name
+type colRef struct {
+	qual, name string
+	raw        string // исходное слово, например "t.name"
+	pos        int
+	quoted     bool // имя было в двойных кавычках
+	scope      *columnScope
+	idx        int
+}
+
+type unaryExpr struct {
+	op string // "not" или "-"
+	x  expr
+}
+
+type binaryExpr struct {
+	op   string // and, or, =, !=, <, <=, >, >=
+	l, r expr
+}
+
+type likeExpr struct {
+	x, pattern expr
+	not, icase bool
+}
+
+type inExpr struct {
+	x    expr
+	list []expr
+	not  bool
+}
+
+type isNullExpr struct {
+	x   expr
+	not bool
+}
+
+func (e *literalExpr) eval(*rowEnv) (value, error) { return e.v, nil }
+
+// индекс колонки в области видимости без привязки
+func (e *colRef) lookup(scope *columnScope) (int, error) {
+	idx, err := scope.resolve("", e.raw)
+	if err != nil && e.qual != "" {
+		idx, err = scope.resolve(e.qual, e.name)
+	}
+	return idx, err
+}
+
+// привязка ссылки к индексу колонки в области видимости
+func (e *colRef) bind(scope *columnScope) error {
+	if e.scope == scope {
+		return nil
+	}
+	idx, err := e.lookup(scope)
+	if err != nil {
+		msg := err.Error()
+		if e.quoted {
+			msg += " (строковые значения пишутся в 'одинарных' кавычках)"
+		}
+		return &queryError{pos: e.pos, msg: msg}
+	}
+	e.scope, e.idx = scope, idx
+	return nil
+}
+
+func (e *colRef) eval(env *rowEnv) (value, error) {
+	if err := e.bind(env.scope); err != nil {
+		return nullValue, err
+	}
+	if e.idx >= len(env.row) {
+		return nullValue, nil
+	}
+	return cellValue(env.row[e.idx], env.scope.types[e.idx]), nil
+}
+
+func (e *unaryExpr) eval(env *rowEnv) (value, error) {
+	v, err := e.x.eval(env)
+	if err != nil {
+		return nullValue, err
+	}
+	if e.op == "not" {
+		return boolValue(!v.truthy()), nil
+	}
+	if n, ok := v.number(); ok {
+		return numberValue(-n), nil
+	}
+	return nullValue, fmt.Errorf("унарный минус к нечисловому значению '%s'", v)
+}
+
+func (e *binaryExpr) eval(env *rowEnv) (value, error) {
+	l, err := e.l.eval(env)
+	if err != nil {
+		return nullValue, err
+	}
+	switch e.op {
+	case "and":
+		if !l.truthy() {
+			return boolValue(false), nil
+		}
+		r, err := e.r.eval(env)
+		return boolValue(r.truthy()), err
+	case "or":
+		if l.truthy() {
+			return boolValue(true), nil
+		}
+		r, err := e.r.eval(env)
+		return boolValue(r.truthy()), err
+	}
+	r, err := e.r.eval(env)
+	if err != nil {
+		return nullValue, err
+	}
+	if l.isNull() || r.isNull() {
+		return boolValue(false), nil
+	}
+	c := compareValues(l, r)
+	switch e.op {
+	case "=":
+		return boolValue(c == 0), nil
+	case "!=":
+		return boolValue(c != 0), nil
+	case "<":
+		return boolValue(c < 0), nil
+	case "<=":
+		return boolValue(c <= 0), nil
+	case ">":
+		return boolValue(c > 0), nil
+	case ">=":
+		return boolValue(c >= 0), nil
+	}
+	return nullValue, fmt.Errorf("неизвестная операция %s", e.op)
+}
+
+func (e *likeExpr) eval(env *rowEnv) (value, error) {
+	v, err := e.x.eval(env)
+	if err != nil {
+		return nullValue, err
+	}
+	p, err := e.pattern.eval(env)
+	if err != nil {
+		return nullValue, err
+	}
+	if v.isNull() || p.isNull() {
+		return boolValue(false), nil
+	}
+	s, pat := v.String(), p.String()
+	if e.icase {
+		s, pat = strings.ToLower(s), strings.ToLower(pat)
+	}
+	return boolValue(likeMatch([]rune(s), []rune(pat)) != e.not), nil
+}
+
+func (e *inExpr) eval(env *rowEnv) (value, error) {
+	v, err := e.x.eval(env)
+	if err != nil {
+		return nullValue, err
+	}
+	if v.isNull() {
+		return boolValue(false), nil
+	}
+	for _, item := range e.list {
+		w, err := item.eval(env)
+		if err != nil {
+			return nullValue, err
+		}
+		if !w.isNull() && compareValues(v, w) == 0 {
+			return boolValue(!e.not), nil
+		}
+	}
+	return boolValue(e.not), nil
+}
+
+func (e *isNullExpr) eval(env *rowEnv) (value, error) {
+	v, err := e.x.eval(env)
+	if err != nil {
+		return nullValue, err
+	}
+	return boolValue(v.isNull() != e.not), nil
+}
+
+// Сопоставление с шаблоном LIKE: % — любая последовательность,
+// _ — один символ, \ экранирует следующий символ.
+func likeMatch(s, p []rune) bool {
+	si, pi := 0, 0
+	star, mark := -1, 0
+	for si < len(s) {
+		switch {
+		case pi < len(p) && p[pi] == '%':
+			star, mark = pi, si
+			pi++
+		case pi < len(p) && p[pi] == '\\' && pi+1 < len(p) && p[pi+1] == s[si]:
+			si++
+			pi += 2
+		case pi < len(p) && p[pi] != '\\' && (p[pi] == '_' || p[pi] == s[si]):
+			si++
+			pi++
+		case star >= 0:
+			pi = star + 1
+			mark++
+			si = mark
+		default:
+			return false
+		}
+	}
+	for pi < len(p) && p[pi] == '%' {
+		pi++
+	}
+	return pi == len(p)
+}
+
+// обход дерева выражения
+func walkExpr(e expr, fn func(expr) error) error {
+	if e == nil {
+		return nil
+	}
+	if err := fn(e); err != nil {
+		return err
+	}
+	switch e := e.(type) {
+	case *unaryExpr:
+		return walkExpr(e.x, fn)
+	case *binaryExpr:
+		if err := walkExpr(e.l, fn); err != nil {
+			return err
+		}
+		return walkExpr(e.r, fn)
+	case *likeExpr:
+		if err := walkExpr(e.x, fn); err != nil {
+			return err
+		}
+		return walkExpr(e.pattern, fn)
+	case *inExpr:
+		if err := walkExpr(e.x, fn); err != nil {
+			return err
+		}
+		for _, it := range e.list {
+			if err := walkExpr(it, fn); err != nil {
+				return err
+			}
+		}
+	case *isNullExpr:
+		return walkExpr(e.x, fn)
+	case *aggExpr:
+		return walkExpr(e.arg, fn)
+	case *arithExpr:
+		if err := walkExpr(e.l, fn); err != nil {
+			return err
+		}
+		return walkExpr(e.r, fn)
+	case *funcExpr:
+		for _, a := range e.args {
+			if err := walkExpr(a, fn); err != nil {
+				return err
+			}
+		}
+	case *caseExpr:
+		if err := walkExpr(e.subject, fn); err != nil {
+			return err
+		}
+		for _, w := range e.whens {
+			if err := walkExpr(w.cond, fn); err != nil {
+				return err
+			}
+			if err := walkExpr(w.then, fn); err != nil {
+				return err
+			}
+		}
+		return walkExpr(e.orElse, fn)
+	}
+	return nil
+}
+
+// проверить, что все колонки выражения существуют
+func bindExpr(e expr, scope *columnScope) error {
+	return walkExpr(e, func(n expr) error {
+		if c, ok := n.(*colRef); ok {
+			return c.bind(scope)
+		}
+		return nil
+	})
+}
+
+// --- Разбор выражений ---
+//
+// Приоритет: OR < AND < NOT < сравнения, LIKE, IN, IS NULL < + - || <
+// * / % < унарный минус (арифметика, функции и CASE — в calc.go).
+// Слова без кавычек и "двойные кавычки" — имена колонок,
+// 'одинарные кавычки' и числа — значения.
+
+func (p *parser) parseExpr() (expr, error) {
+	return p.parseOr()
+}
+
+func (p *parser) parseOr() (expr, error) {
+	l, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("or") {
+		r, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l = &binaryExpr{op: "or", l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseAnd() (expr, error) {
+	l, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("and") {
+		r, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l = &binaryExpr{op: "and", l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseNot() (expr, error) {
+	if p.acceptKeyword("not") {
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryExpr{op: "not", x: x}, nil
+	}
+	return p.parseComparison()
+}
+
+var comparisonOps = map[string]string{
+	"=": "=", "==": "=", "!=": "!=", "<>": "!=",
+	"<": "<", "<=": "<=", ">": ">", ">=": ">=",
+}
+
+func (p *parser) parseComparison() (expr, error) {
+	l, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind == tokOp {
+		if op, ok := comparisonOps[p.tok.text]; ok {
+			p.advance()
+			r, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			return &binaryExpr{op: op, l: l, r: r}, nil
+		}
+	}
+
+	if p.acceptKeyword("is") {
+		not := p.acceptKeyword("not")
+		if err := p.expectKeyword("null"); err != nil {
+			return nil, err
+		}
+		return &isNullExpr{x: l, not: not}, nil
+	}
+
+	not := false
+	if p.isKeyword("not") {
+		not = true
+		p.advance()
+	}
+	switch {
+	case p.acceptKeyword("like"):
+		pat, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &likeExpr{x: l, pattern: pat, not: not}, nil
+	case p.acceptKeyword("ilike"):
+		pat, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &likeExpr{x: l, pattern: pat, not: not, icase: true}, nil
+	case p.acceptKeyword("in"):
+		if err := p.expectOp("("); err != nil {
+			return nil, err
+		}
+		in := &inExpr{x: l, not: not}
+		for {
+			item, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			in.list = append(in.list, item)
+			if !p.acceptOp(",") {
+				break
+			}
+		}
+		if err := p.expectOp(")"); err != nil {
+			return nil, err
+		}
+		return in, nil
+	}
+	if not {
+		return nil, p.errorf(p.tok, "после NOT ожидалось LIKE или IN, найдено %s", p.tok)
+	}
+	return l, nil
+}
+
+// ключевые слова, которые не могут быть именем колонки без кавычек
+var reservedWords = map[string]bool{
+	"select": true, "from": true, "where": true, "order": true, "by": true,
+	"limit": true, "offset": true, "and": true, "or": true, "not": true,
+	"like": true, "ilike": true, "in": true, "is": true, "null": true,
+	"as": true, "asc": true, "desc": true, "true": true, "false": true,
+	"set": true, "values": true,
+	"join": true, "inner": true, "left": true, "outer": true, "on": true,
+	"group": true, "having": true, "distinct": true,
+	"case": true, "when": true, "then": true, "else": true, "end": true,
+}
+
+func isReserved(t token) bool {
+	return t.kind == tokWord && reservedWords[strings.ToLower(t.text)]
+}
+
+func (p *parser) parseOperand() (expr, error) {
+	t := p.tok
+	switch {
+	case p.acceptOp("("):
+		e, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		return e, p.expectOp(")")
+	case p.acceptOp("-"):
+		x, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryExpr{op: "-", x: x}, nil
+	case t.kind == tokNumber:
+		p.advance()
+		n, _ := parseNumber(t.text)
+		return &literalExpr{v: numberValue(n)}, nil
+	case t.kind == tokString && t.quote == '\'':
+		p.advance()
+		return &literalExpr{v: textValue(t.text)}, nil
+	case t.kind == tokString:
+		p.advance()
+		return &colRef{name: t.text, raw: t.text, pos: t.pos, quoted: true}, nil
+	case p.acceptKeyword("null"):
+		return &literalExpr{v: nullValue}, nil
+	case p.acceptKeyword("true"):
+		return &literalExpr{v: boolValue(true)}, nil
+	case p.acceptKeyword("false"):
+		return &literalExpr{v: boolValue(false)}, nil
+	case p.acceptKeyword("case"):
+		return p.parseCase()
+	case t.kind == tokWord && !isReserved(t):
+		p.advance()
+		if p.isOp("(") {
+			name := strings.ToLower(t.text)
+			if aggregateFuncs[name] {
+				return p.parseAggregate(t)
+			}
+			if _, ok := scalarFuncs[name]; ok {
+				return p.parseFunc(t)
+			}
+			return nil, p.errorf(t, "неизвестная функция %s", t.text)
+		}
+		return newColRef(t), nil
+	}
+	return nil, p.errorf(t, "ожидалось значение или колонка, найдено %s", t)
+}
+
+// "t.name" — колонка name таблицы t (если нет колонки с точкой в имени)
+func newColRef(t token) *colRef {
+	c := &colRef{name: t.text, raw: t.text, pos: t.pos}
+	if i := strings.LastIndex(t.text, "."); i > 0 && i < len(t.text)-1 {
+		c.qual, c.name = t.text[:i], t.text[i+1:]
+	}
+	return c
+}
+
+// исходный текст между токенами — для заголовков колонок результата
+func (p *parser) sourceText(from, to int) string {
+	return strings.TrimFunc(string(p.lx.src[from:to]), unicode.IsSpace)
+}
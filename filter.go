@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// --- Фильтр для конвейеров ---
+//
+// cat data.csv | csvdb select [-cols "name, age"] [-in csv|tsv] [-format csv|tsv|json|table] "age > 30 order by name"
+//
+// CSV из stdin (первая строка — заголовок) проходит через SELECT без
+// таблиц на диске. Аргумент — условие WHERE и/или части GROUP BY, HAVING,
+// ORDER BY, LIMIT; без аргумента выводятся все строки, так что фильтр
+// годится и для перевода CSV в TSV или JSON. Без ORDER BY и GROUP BY
+// строки пишутся по мере чтения, LIMIT прекращает чтение. Типов у
+// колонок нет: числа и даты сравниваются по значению, как в нетипизированных
+// таблицах. В выражениях таблица называется stdin (stdin.age).
+
+const filterQual = "stdin"
+
+// csvdb select: аргументы склеиваются через пробел, так что кавычки
+// вокруг условия не обязательны
+func runSelectCLI(args []string, stderr io.Writer, opt cliOptions) int {
+	if opt.in != "csv" && opt.in != "tsv" {
+		fmt.Fprintf(stderr, "csvdb: неизвестный формат ввода '%s' (доступны: csv, tsv)\n", opt.in)
+		return exitUsage
+	}
+	if isTerminal(int(os.Stdin.Fd())) {
+		fmt.Fprintln(stderr, `csvdb: select читает CSV из stdin: cat data.csv | csvdb select "age > 30"`)
+		return exitUsage
+	}
+	st, err := parseFilter(opt.cols, strings.Join(args, " "))
+	if err != nil {
+		fmt.Fprintln(stderr, "csvdb:", err)
+		return exitUsage
+	}
+	if err := runFilter(st, os.Stdin, os.Stdout, opt.in, opt.format); err != nil {
+		fmt.Fprintln(stderr, "csvdb:", err)
+		return exitFailed
+	}
+	return exitOK
+}
+
+// SELECT над stdin: колонки из -cols, остальное из аргумента
+func parseFilter(cols, cond string) (*selectStmt, error) {
+	st := &selectStmt{limit: -1}
+	p := newParser(cols)
+	items, err := p.parseSelectItems()
+	if err == nil {
+		err = p.expectEnd()
+	}
+	if err != nil {
+		return nil, filterError("-cols", cols, err)
+	}
+	st.items = items
+
+	p = newParser(cond)
+	clause := false
+	for _, kw := range []string{"where", "group", "having", "order", "limit", "offset"} {
+		clause = clause || p.isKeyword(kw)
+	}
+	if !clause && !p.atEOF() {
+		if st.where, err = p.parseExpr(); err != nil {
+			return nil, filterError("условие", cond, err)
+		}
+		if p.isKeyword("where") {
+			err = p.errorf(p.tok, "условие уже задано, WHERE не нужен")
+			return nil, filterError("условие", cond, err)
+		}
+	}
+	if err = p.parseSelectClauses(st); err == nil {
+		err = p.expectEnd()
+	}
+	if err != nil {
+		return nil, filterError("условие", cond, err)
+	}
+	return st, nil
+}
+
+// ошибка разбора с указателем на место в тексте
+func filterError(what, src string, err error) error {
+	var qe *queryError
+	if errors.As(err, &qe) {
+		return fmt.Errorf("%s: %v\n%s", what, err, qe.caret(src))
+	}
+	return err
+}
+
+// Выполнение фильтра. Вывод сбрасывается, когда прочитанный ввод
+// закончился: при медленном источнике (tail -f) строки не копятся.
+func runFilter(st *selectStmt, stdin io.Reader, stdout io.Writer, inFormat, format string) error {
+	in := bufio.NewReader(stdin)
+	r := csv.NewReader(in)
+	r.FieldsPerRecord = -1
+	if inFormat == "tsv" {
+		r.Comma = '\t'
+		r.LazyQuotes = true
+	}
+	header, err := r.Read()
+	if err == io.EOF {
+		return errors.New("на входе нет данных: ожидался CSV с заголовком")
+	}
+	if err != nil {
+		return err
+	}
+	scope := &columnScope{}
+	for _, h := range header {
+		scope.add(filterQual, h, "")
+	}
+	if err := st.bind(scope); err != nil {
+		return err
+	}
+
+	if format == "table" {
+		// выравнивание требует всех строк
+		data := [][]string{st.header(scope)}
+		err := runSelect(st, scope, r.Read, func(row []string) error {
+			data = append(data, row)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return writeAligned(stdout, data)
+	}
+
+	out := bufio.NewWriter(stdout)
+	rw := newRowWriter(out, format)
+	if err := rw.header(st.header(scope)); err != nil {
+		return err
+	}
+	err = runSelect(st, scope, r.Read, func(row []string) error {
+		if err := rw.row(row); err != nil {
+			return err
+		}
+		if in.Buffered() == 0 {
+			return out.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		out.Flush()
+		return err
+	}
+	if err := rw.close(); err != nil {
+		return err
+	}
+	return out.Flush()
+}
+
+// --- Построчный вывод ---
+
+type rowWriter interface {
+	header(cols []string) error
+	row(cells []string) error
+	close() error
+}
+
+func newRowWriter(w io.Writer, format string) rowWriter {
+	switch format {
+	case "json":
+		return &jsonRowWriter{w: w}
+	case "tsv":
+		return &tsvRowWriter{w: w}
+	}
+	return &csvRowWriter{w: csv.NewWriter(w)}
+}
+
+type csvRowWriter struct{ w *csv.Writer }
+
+func (c *csvRowWriter) header(cols []string) error { return c.row(cols) }
+
+func (c *csvRowWriter) row(cells []string) error {
+	if err := c.w.Write(cells); err != nil {
+		return err
+	}
+	c.w.Flush() // буфер — у вызывающего
+	return c.w.Error()
+}
+
+func (c *csvRowWriter) close() error { return nil }
+
+// TSV без кавычек: табуляции и переводы строк в значениях заменяются пробелами
+type tsvRowWriter struct{ w io.Writer }
+
+var tsvClean = strings.NewReplacer("\t", " ", "\n", " ", "\r", " ")
+
+func (t *tsvRowWriter) header(cols []string) error { return t.row(cols) }
+
+func (t *tsvRowWriter) row(cells []string) error {
+	for i, c := range cells {
+		if i > 0 {
+			if _, err := io.WriteString(t.w, "\t"); err != nil {
+				return err
+			}
+		}
+		if _, err := tsvClean.WriteString(t.w, c); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(t.w, "\n")
+	return err
+}
+
+func (t *tsvRowWriter) close() error { return nil }
+
+// строка как JSON-объект с ключами в порядке колонок
+type jsonRow struct {
+	cols  []string
+	cells []string
+}
+
+func (r jsonRow) MarshalJSON() ([]byte, error) {
+	var b strings.Builder
+	b.WriteString("{")
+	for i, c := range r.cols {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.Write(jsonText(c))
+		b.WriteString(":")
+		b.Write(jsonText(cellAt(r.cells, i)))
+	}
+	b.WriteString("}")
+	return []byte(b.String()), nil
+}
+
+// массив объектов с ключами в порядке колонок, по объекту на строку
+type jsonRowWriter struct {
+	w    io.Writer
+	keys [][]byte
+	n    int
+}
+
+func (j *jsonRowWriter) header(cols []string) error {
+	for _, h := range cols {
+		j.keys = append(j.keys, jsonText(h))
+	}
+	_, err := io.WriteString(j.w, "[")
+	return err
+}
+
+func (j *jsonRowWriter) row(cells []string) error {
+	var b strings.Builder
+	if j.n > 0 {
+		b.WriteString(",")
+	}
+	j.n++
+	b.WriteString("\n  {")
+	for i, k := range j.keys {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.Write(k)
+		b.WriteString(": ")
+		b.Write(jsonText(cellAt(cells, i)))
+	}
+	b.WriteString("}")
+	_, err := io.WriteString(j.w, b.String())
+	return err
+}
+
+func (j *jsonRowWriter) close() error {
+	end := "]\n"
+	if j.n > 0 {
+		end = "\n]\n"
+	}
+	_, err := io.WriteString(j.w, end)
+	return err
+}
+
+// строка JSON без замены <, > и & на \u-последовательности
+func jsonText(s string) []byte {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(s)
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n"))
+}
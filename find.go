@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// --- Условия FIND ---
+//
+// FIND <table> <column> [оператор] <значение> [NOCASE]
+//   значение     — точное совпадение
+//   ~ значение   — содержит
+//   ^ значение   — начинается с
+//   /регулярка/  — регулярное выражение (флаг i — без учёта регистра)
+//   % значение   — нечёткий поиск с опечатками (порог и транслитерация — SET FUZZY, SET TRANSLIT);
+//                  строки упорядочены по убыванию сходства
+//   10..50       — диапазон включительно (числа или даты; границу можно опустить)
+//   < <= > >= != — сравнение (числа, даты или строки)
+// NOCASE в конце команды отключает учёт регистра.
+
+type findMatcher struct {
+	op     string // =, ~, ^, %, regex, range, !=, <, <=, >, >=
+	value  string
+	lo, hi string // границы диапазона
+	re     *regexp.Regexp
+	fuzzy  *fuzzyQuery
+	nocase bool
+}
+
+var findOps = map[string]bool{"~": true, "%": true, "^": true, "=": true, "==": true, "!=": true, "<>": true, "<": true, "<=": true, ">": true, ">=": true}
+
+func (m *findMatcher) match(cell string) bool {
+	switch m.op {
+	case "regex":
+		return m.re.MatchString(cell)
+	case "%":
+		return m.fuzzy.accepts(cell)
+	case "range":
+		return inRange(cell, m.lo, m.hi)
+	case "!=", "<", "<=", ">", ">=":
+		if strings.TrimSpace(cell) == "" {
+			return false
+		}
+		if m.nocase && m.op == "!=" {
+			return !strings.EqualFold(cell, m.value)
+		}
+		c := compareValues(cellValue(cell, ""), textValue(m.value))
+		switch m.op {
+		case "!=":
+			return c != 0
+		case "<":
+			return c < 0
+		case "<=":
+			return c <= 0
+		case ">":
+			return c > 0
+		}
+		return c >= 0
+	}
+	s, v := cell, m.value
+	if m.nocase {
+		s, v = strings.ToLower(s), strings.ToLower(v)
+	}
+	switch m.op {
+	case "~":
+		return strings.Contains(s, v)
+	case "^":
+		return strings.HasPrefix(s, v)
+	}
+	return s == v
+}
+
+func (m *findMatcher) String() string {
+	switch m.op {
+	case "regex":
+		return "/" + m.re.String() + "/"
+	case "range":
+		return m.lo + ".." + m.hi
+	}
+	return m.op + " '" + m.value + "'"
+}
+
+// Диапазон: обе границы — числа или обе — даты; значение того же вида
+func inRange(cell, lo, hi string) bool {
+	if strings.TrimSpace(cell) == "" {
+		return false
+	}
+	bounds := []string{lo, hi}
+	numeric, dates := true, true
+	for _, b := range bounds {
+		if b == "" {
+			continue
+		}
+		if _, err := parseNumber(b); err != nil {
+			numeric = false
+		}
+		if _, err := parseDate(b); err != nil {
+			dates = false
+		}
+	}
+	switch {
+	case numeric:
+		n, err := parseNumber(cell)
+		if err != nil {
+			return false
+		}
+		if lo != "" {
+			if l, _ := parseNumber(lo); n < l {
+				return false
+			}
+		}
+		if hi != "" {
+			if h, _ := parseNumber(hi); n > h {
+				return false
+			}
+		}
+		return true
+	case dates:
+		d, err := parseDate(cell)
+		if err != nil {
+			return false
+		}
+		if lo != "" {
+			if l, _ := parseDate(lo); d.Before(l) {
+				return false
+			}
+		}
+		if hi != "" {
+			if h, _ := parseDate(hi); d.After(h) {
+				return false
+			}
+		}
+		return true
+	}
+	return (lo == "" || cell >= lo) && (hi == "" || cell <= hi)
+}
+
+// условие FIND после имени колонки
+func (p *parser) parseFindMatcher() (*findMatcher, error) {
+	m := &findMatcher{op: "="}
+	if p.isOp("/") {
+		start := p.tok
+		pattern, err := p.regexSource(m)
+		if err != nil {
+			return nil, err
+		}
+		if p.acceptKeyword("nocase") {
+			m.nocase = true
+		}
+		if m.nocase {
+			pattern = "(?i)" + pattern
+		}
+		if m.re, err = regexp.Compile(pattern); err != nil {
+			return nil, p.errorf(start, "регулярное выражение: %v", err)
+		}
+		m.op = "regex"
+		return m, nil
+	}
+	if p.tok.kind == tokOp && findOps[p.tok.text] {
+		m.op = p.tok.text
+		switch m.op {
+		case "==":
+			m.op = "="
+		case "<>":
+			m.op = "!="
+		}
+		p.advance()
+	}
+	if p.atEOF() {
+		return nil, p.errorf(p.tok, "find: укажите колонку и значение")
+	}
+	first := p.tok
+	m.value, m.nocase = p.findValue()
+	if m.op == "%" {
+		m.fuzzy = newFuzzyQuery(m.value, currentFuzzy())
+	}
+	if m.op == "=" && first.kind != tokString {
+		if lo, hi, ok := strings.Cut(m.value, ".."); ok && !strings.Contains(hi, "..") {
+			m.op, m.lo, m.hi = "range", strings.TrimSpace(lo), strings.TrimSpace(hi)
+			if m.lo == "" && m.hi == "" {
+				return nil, p.errorf(first, "у диапазона должна быть хотя бы одна граница")
+			}
+		}
+	}
+	return m, nil
+}
+
+// Значение до конца команды: строка в кавычках или исходный текст как есть.
+// Завершающее слово NOCASE — флаг, а не часть значения.
+func (p *parser) findValue() (string, bool) {
+	var toks []token
+	for !p.atEOF() {
+		toks = append(toks, p.tok)
+		p.advance()
+	}
+	nocase := false
+	if n := len(toks); n > 1 && toks[n-1].kind == tokWord && strings.EqualFold(toks[n-1].text, "nocase") {
+		nocase = true
+		toks = toks[:n-1]
+	}
+	if len(toks) == 1 && toks[0].kind == tokString {
+		return toks[0].text, nocase
+	}
+	return string(p.lx.src[toks[0].pos:toks[len(toks)-1].end]), nocase
+}
+
+// /регулярное выражение/[i] — читается из исходного текста мимо лексера
+func (p *parser) regexSource(m *findMatcher) (string, error) {
+	start := p.tok
+	src := p.lx.src
+	var b strings.Builder
+	i := start.end
+	for ; i < len(src) && src[i] != '/'; i++ {
+		if src[i] == '\\' && i+1 < len(src) && src[i+1] == '/' {
+			i++
+		}
+		b.WriteRune(src[i])
+	}
+	if i >= len(src) {
+		return "", p.errorf(start, "незакрытое регулярное выражение")
+	}
+	i++
+	for i < len(src) && src[i] == 'i' {
+		m.nocase = true
+		i++
+	}
+	// продолжить разбор после закрывающей /
+	p.lx.pos = i
+	p.tok.end = i
+	p.advance()
+	return b.String(), nil
+}
+
+func (m *findMatcher) notFound() error {
+	switch m.op {
+	case "=":
+		return fmt.Errorf("записи со значением '%s' не найдены", m.value)
+	case "%":
+		return fmt.Errorf("записи, похожие на '%s', не найдены (порог сходства %g)", m.value, m.fuzzy.opt.threshold)
+	}
+	return fmt.Errorf("записи по условию %s не найдены", m)
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// --- Нечёткий поиск ---
+//
+// Сходство запроса со значением — от 0 до 1: лучшее из расстояния
+// Левенштейна и сходства по триграммам. Значение сравнивается целиком и
+// окнами из стольких же слов, сколько в запросе, так что «Иванов»
+// находится и в «Пётр Иваноф». Вхождение запроса как подстроки — полное
+// совпадение. С транслитерацией кириллица и латиница сравниваются в
+// латинской записи: «Ivanov» ≈ «Иванов».
+
+type fuzzyOptions struct {
+	threshold float64
+	translit  bool
+}
+
+type fuzzyQuery struct {
+	opt   fuzzyOptions
+	q     []rune // запрос в нижнем регистре
+	qt    []rune // транслитерация запроса
+	words int
+}
+
+func newFuzzyQuery(text string, opt fuzzyOptions) *fuzzyQuery {
+	q := foldRunes([]rune(strings.TrimSpace(text)))
+	f := &fuzzyQuery{opt: opt, q: q, words: len(wordSpans(q))}
+	if f.words == 0 {
+		f.words = 1
+	}
+	if opt.translit {
+		f.qt = translitRunes(q)
+	}
+	return f
+}
+
+func (f *fuzzyQuery) String() string {
+	return string(f.q)
+}
+
+// лучшее сходство и границы совпавшего фрагмента (в символах cell)
+func (f *fuzzyQuery) match(cell string) (score float64, at, end int) {
+	s := foldRunes([]rune(cell))
+	if len(f.q) == 0 || len(s) == 0 {
+		return 0, 0, 0
+	}
+	if i := runeIndex(s, f.q); i >= 0 {
+		return 1, i, i + len(f.q)
+	}
+	try := func(from, to int) {
+		part := s[from:to]
+		sc := similarity(f.q, part)
+		if f.opt.translit && sc < 1 {
+			sc = max(sc, similarity(f.qt, translitRunes(part)))
+		}
+		if sc > score {
+			score, at, end = sc, from, to
+		}
+	}
+	spans := wordSpans(s)
+	if len(spans) == 0 {
+		return 0, 0, 0
+	}
+	try(spans[0][0], spans[len(spans)-1][1])
+	for i := 0; i+f.words <= len(spans); i++ {
+		try(spans[i][0], spans[i+f.words-1][1])
+	}
+	return score, at, end
+}
+
+func (f *fuzzyQuery) accepts(cell string) bool {
+	sc, _, _ := f.match(cell)
+	return sc >= f.opt.threshold
+}
+
+// строки по убыванию сходства значения в колонке col
+func (f *fuzzyQuery) rank(rows [][]string, col int) {
+	scores := make([]float64, len(rows))
+	for i, r := range rows {
+		if col < len(r) {
+			scores[i], _, _ = f.match(r[col])
+		}
+	}
+	idx := make([]int, len(rows))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool { return scores[idx[a]] > scores[idx[b]] })
+	sorted := make([][]string, len(rows))
+	for i, j := range idx {
+		sorted[i] = rows[j]
+	}
+	copy(rows, sorted)
+}
+
+func similarity(a, b []rune) float64 {
+	return max(editSimilarity(a, b), trigramSimilarity(a, b))
+}
+
+func editSimilarity(a, b []rune) float64 {
+	n := max(len(a), len(b))
+	if n == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(a, b))/float64(n)
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// коэффициент Жаккара по триграммам с пробелами по краям
+func trigramSimilarity(a, b []rune) float64 {
+	ta, tb := trigrams(a), trigrams(b)
+	if len(ta) == 0 || len(tb) == 0 {
+		return 0
+	}
+	common := 0
+	for t := range ta {
+		if tb[t] {
+			common++
+		}
+	}
+	return float64(common) / float64(len(ta)+len(tb)-common)
+}
+
+func trigrams(s []rune) map[string]bool {
+	p := append(append([]rune("  "), s...), ' ')
+	out := map[string]bool{}
+	for i := 0; i+3 <= len(p); i++ {
+		out[string(p[i:i+3])] = true
+	}
+	return out
+}
+
+// границы слов (букв и цифр) в символах
+func wordSpans(s []rune) [][2]int {
+	var spans [][2]int
+	start := -1
+	for i, r := range s {
+		word := unicode.IsLetter(r) || unicode.IsDigit(r)
+		switch {
+		case word && start < 0:
+			start = i
+		case !word && start >= 0:
+			spans = append(spans, [2]int{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, [2]int{start, len(s)})
+	}
+	return spans
+}
+
+var cyrLat = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e",
+	'ж': "zh", 'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m",
+	'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u",
+	'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch",
+	'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu", 'я': "ya",
+	'є': "ye", 'і': "i", 'ї': "yi", 'ґ': "g", 'ў': "u",
+}
+
+// латинская запись строки в нижнем регистре
+func translitRunes(s []rune) []rune {
+	var b strings.Builder
+	for _, r := range s {
+		if l, ok := cyrLat[r]; ok {
+			b.WriteString(l)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return []rune(b.String())
+}
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// --- GROUP BY и агрегатные функции ---
+//
+// COUNT(*), COUNT([DISTINCT] x), SUM, AVG, MIN, MAX. Пустые значения
+// (NULL) не учитываются. SUM и AVG принимают числа с десятичной
+// запятой; колонки с объявленным типом int/float читаются как числа.
+// Без GROUP BY агрегаты считаются по всем строкам одной группой.
+
+var aggregateFuncs = map[string]bool{"count": true, "sum": true, "avg": true, "min": true, "max": true}
+
+type aggExpr struct {
+	fn       string
+	arg      expr // nil для COUNT(*)
+	distinct bool
+	pos      int
+	slot     int // номер в rowEnv.aggs
+}
+
+func (e *aggExpr) eval(env *rowEnv) (value, error) {
+	if env.aggs == nil || e.slot >= len(env.aggs) {
+		return nullValue, &queryError{pos: e.pos, msg: fmt.Sprintf("агрегатная функция %s допустима только в SELECT, HAVING и ORDER BY", strings.ToUpper(e.fn))}
+	}
+	return env.aggs[e.slot], nil
+}
+
+// name( [DISTINCT] x | * ) — имя уже прочитано
+func (p *parser) parseAggregate(name token) (expr, error) {
+	e := &aggExpr{fn: strings.ToLower(name.text), pos: name.pos}
+	if err := p.expectOp("("); err != nil {
+		return nil, err
+	}
+	if e.fn == "count" && p.acceptOp("*") {
+		return e, p.expectOp(")")
+	}
+	e.distinct = p.acceptKeyword("distinct")
+	arg, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if hasAggregate(arg) {
+		return nil, p.errorf(name, "вложенные агрегатные функции недопустимы")
+	}
+	e.arg = arg
+	return e, p.expectOp(")")
+}
+
+func (p *parser) parseGroupBy() ([]expr, error) {
+	if !p.acceptKeyword("group") {
+		return nil, nil
+	}
+	if err := p.expectKeyword("by"); err != nil {
+		return nil, err
+	}
+	var list []expr
+	for {
+		e, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if hasAggregate(e) {
+			return nil, p.errorf(p.tok, "агрегатные функции в GROUP BY недопустимы")
+		}
+		list = append(list, e)
+		if !p.acceptOp(",") {
+			return list, nil
+		}
+	}
+}
+
+func hasAggregate(e expr) bool {
+	return len(aggregatesOf(e)) > 0
+}
+
+func aggregatesOf(e expr) []*aggExpr {
+	var out []*aggExpr
+	_ = walkExpr(e, func(n expr) error {
+		if a, ok := n.(*aggExpr); ok {
+			out = append(out, a)
+		}
+		return nil
+	})
+	return out
+}
+
+// запрос с группировкой: GROUP BY, HAVING или агрегаты в списке колонок
+func (st *selectStmt) grouped() bool {
+	if len(st.groupBy) > 0 || st.having != nil {
+		return true
+	}
+	for _, it := range st.items {
+		if hasAggregate(it.expr) {
+			return true
+		}
+	}
+	for _, o := range st.orderBy {
+		if hasAggregate(o.expr) {
+			return true
+		}
+	}
+	return false
+}
+
+// накопитель одной агрегатной функции в одной группе
+type aggState struct {
+	count    int
+	sum      float64
+	min, max value
+	seen     map[string]bool
+}
+
+func (a *aggExpr) add(s *aggState, env *rowEnv) error {
+	if a.arg == nil {
+		s.count++
+		return nil
+	}
+	v, err := a.arg.eval(env)
+	if err != nil || v.isNull() {
+		return err
+	}
+	if a.distinct {
+		k := hashKey(v)
+		if s.seen[k] {
+			return nil
+		}
+		if s.seen == nil {
+			s.seen = map[string]bool{}
+		}
+		s.seen[k] = true
+	}
+	switch a.fn {
+	case "sum", "avg":
+		n, ok := v.number()
+		if !ok {
+			return &queryError{pos: a.pos, msg: fmt.Sprintf("%s: '%s' не является числом", strings.ToUpper(a.fn), v)}
+		}
+		s.sum += n
+	case "min":
+		if s.count == 0 || compareValues(v, s.min) < 0 {
+			s.min = v
+		}
+	case "max":
+		if s.count == 0 || compareValues(v, s.max) > 0 {
+			s.max = v
+		}
+	}
+	s.count++
+	return nil
+}
+
+func (a *aggExpr) result(s *aggState) value {
+	switch a.fn {
+	case "count":
+		return numberValue(float64(s.count))
+	case "sum":
+		if s.count == 0 {
+			return nullValue
+		}
+		return numberValue(s.sum)
+	case "avg":
+		if s.count == 0 {
+			return nullValue
+		}
+		return numberValue(s.sum / float64(s.count))
+	case "min":
+		if s.count == 0 {
+			return nullValue
+		}
+		return s.min
+	case "max":
+		if s.count == 0 {
+			return nullValue
+		}
+		return s.max
+	}
+	return nullValue
+}
+
+type group struct {
+	row    []string // первая строка группы — для колонок из GROUP BY
+	states []aggState
+}
+
+// Колонки вне агрегатов должны входить в GROUP BY: сама колонка или
+// выражение целиком. При GROUP BY upper(name) колонка name без upper
+// дала бы случайное значение группы.
+func (st *selectStmt) checkGrouping() error {
+	check := func(e expr) error {
+		covered := map[*colRef]bool{}
+		mark := func(root expr) {
+			_ = walkExpr(root, func(n expr) error {
+				if c, ok := n.(*colRef); ok {
+					covered[c] = true
+				}
+				return nil
+			})
+		}
+		for _, a := range aggregatesOf(e) {
+			mark(a.arg)
+		}
+		_ = walkExpr(e, func(n expr) error {
+			for _, g := range st.groupBy {
+				if sameExpr(n, g) {
+					mark(n)
+					break
+				}
+			}
+			return nil
+		})
+		return walkExpr(e, func(n expr) error {
+			if c, ok := n.(*colRef); ok && !covered[c] {
+				return &queryError{pos: c.pos, msg: fmt.Sprintf("колонка '%s' должна быть в GROUP BY или внутри агрегатной функции", c.raw)}
+			}
+			return nil
+		})
+	}
+	for _, it := range st.items {
+		if it.star {
+			return fmt.Errorf("SELECT * нельзя использовать с группировкой")
+		}
+		if err := check(it.expr); err != nil {
+			return err
+		}
+	}
+	if err := check(st.having); err != nil {
+		return err
+	}
+	for _, o := range st.orderBy {
+		if err := check(o.expr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// одинаковые выражения: те же операции над теми же колонками и значениями
+func sameExpr(a, b expr) bool {
+	sameAll := func(x, y []expr) bool {
+		return slices.EqualFunc(x, y, sameExpr)
+	}
+	switch a := a.(type) {
+	case *colRef:
+		b, ok := b.(*colRef)
+		return ok && a.scope == b.scope && a.idx == b.idx
+	case *literalExpr:
+		b, ok := b.(*literalExpr)
+		return ok && a.v.kind == b.v.kind && a.v.String() == b.v.String()
+	case *unaryExpr:
+		b, ok := b.(*unaryExpr)
+		return ok && a.op == b.op && sameExpr(a.x, b.x)
+	case *binaryExpr:
+		b, ok := b.(*binaryExpr)
+		return ok && a.op == b.op && sameExpr(a.l, b.l) && sameExpr(a.r, b.r)
+	case *arithExpr:
+		b, ok := b.(*arithExpr)
+		return ok && a.op == b.op && sameExpr(a.l, b.l) && sameExpr(a.r, b.r)
+	case *likeExpr:
+		b, ok := b.(*likeExpr)
+		return ok && a.not == b.not && a.icase == b.icase && sameExpr(a.x, b.x) && sameExpr(a.pattern, b.pattern)
+	case *inExpr:
+		b, ok := b.(*inExpr)
+		return ok && a.not == b.not && sameExpr(a.x, b.x) && sameAll(a.list, b.list)
+	case *isNullExpr:
+		b, ok := b.(*isNullExpr)
+		return ok && a.not == b.not && sameExpr(a.x, b.x)
+	case *funcExpr:
+		b, ok := b.(*funcExpr)
+		return ok && strings.EqualFold(a.name, b.name) && sameAll(a.args, b.args)
+	case *caseExpr:
+		b, ok := b.(*caseExpr)
+		if !ok || len(a.whens) != len(b.whens) || !sameOptional(a.subject, b.subject) || !sameOptional(a.orElse, b.orElse) {
+			return false
+		}
+		for i := range a.whens {
+			if !sameExpr(a.whens[i].cond, b.whens[i].cond) || !sameExpr(a.whens[i].then, b.whens[i].then) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func sameOptional(a, b expr) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return sameExpr(a, b)
+}
+
+func (st *selectStmt) runGrouped(scope *columnScope, next func() ([]string, error), emit func([]string) error) error {
+	if err := st.checkGrouping(); err != nil {
+		return err
+	}
+	var aggs []*aggExpr
+	seen := map[*aggExpr]bool{}
+	collect := func(e expr) {
+		for _, a := range aggregatesOf(e) {
+			// ORDER BY по псевдониму ссылается на тот же узел, что и SELECT
+			if seen[a] {
+				continue
+			}
+			seen[a] = true
+			a.slot = len(aggs)
+			aggs = append(aggs, a)
+		}
+	}
+	for _, it := range st.items {
+		collect(it.expr)
+	}
+	collect(st.having)
+	for _, o := range st.orderBy {
+		collect(o.expr)
+	}
+
+	// группы в порядке первого появления
+	index := map[string]int{}
+	var groups []*group
+	env := &rowEnv{scope: scope}
+	for {
+		row, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		env.row = row
+		if st.where != nil {
+			v, err := st.where.eval(env)
+			if err != nil {
+				return err
+			}
+			if !v.truthy() {
+				continue
+			}
+		}
+		var kb strings.Builder
+		for _, e := range st.groupBy {
+			v, err := e.eval(env)
+			if err != nil {
+				return err
+			}
+			if !v.isNull() {
+				kb.WriteString(hashKey(v))
+			}
+			kb.WriteByte(0)
+		}
+		gi, ok := index[kb.String()]
+		if !ok {
+			gi = len(groups)
+			index[kb.String()] = gi
+			groups = append(groups, &group{row: row, states: make([]aggState, len(aggs))})
+		}
+		g := groups[gi]
+		for i, a := range aggs {
+			if err := a.add(&g.states[i], env); err != nil {
+				return err
+			}
+		}
+	}
+	// без GROUP BY результат — одна строка даже для пустой таблицы
+	if len(groups) == 0 && len(st.groupBy) == 0 {
+		groups = append(groups, &group{states: make([]aggState, len(aggs))})
+	}
+
+	var envs []*rowEnv
+	for _, g := range groups {
+		ge := &rowEnv{scope: scope, row: g.row, aggs: make([]value, len(aggs))}
+		for i, a := range aggs {
+			ge.aggs[i] = a.result(&g.states[i])
+		}
+		if st.having != nil {
+			v, err := st.having.eval(ge)
+			if err != nil {
+				return err
+			}
+			if !v.truthy() {
+				continue
+			}
+		}
+		envs = append(envs, ge)
+	}
+
+	idx, err := sortOrder(len(envs), func(i int) *rowEnv { return envs[i] }, st.orderBy)
+	if err != nil {
+		return err
+	}
+	skip, left := st.offset, st.limit
+	for i := range envs {
+		ge := envs[i]
+		if idx != nil {
+			ge = envs[idx[i]]
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		if left == 0 {
+			break
+		}
+		row, err := st.project(ge)
+		if err != nil {
+			return err
+		}
+		if err := emit(row); err != nil {
+			return err
+		}
+		if left > 0 {
+			left--
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+// --- История команд ---
+//
+// Введённые команды дописываются в .csvdb_history рядом с таблицами, по
+// строке на команду; хранятся последние historyLimit. Повтор последней
+// команды не записывается. Листание — prev/next, как стрелками в shell:
+// набранный, но не выполненный текст возвращается в конце листания.
+
+const (
+	historyFile  = ".csvdb_history"
+	historyLimit = 1000
+)
+
+type cmdHistory struct {
+	path  string
+	items []string // от старых к новым
+	pos   int      // позиция листания; len(items) — новая команда
+	draft string   // текст, набранный до начала листания
+}
+
+func loadHistory(path string) *cmdHistory {
+	h := &cmdHistory{path: path}
+	if b, err := os.ReadFile(path); err == nil {
+		for _, line := range strings.Split(string(b), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				h.items = append(h.items, line)
+			}
+		}
+	}
+	if len(h.items) > historyLimit {
+		h.items = h.items[len(h.items)-historyLimit:]
+	}
+	h.pos = len(h.items)
+	return h
+}
+
+func (h *cmdHistory) add(cmd string) error {
+	h.pos = len(h.items)
+	h.draft = ""
+	cmd = strings.TrimSpace(strings.ReplaceAll(cmd, "\n", " "))
+	if cmd == "" || len(h.items) > 0 && h.items[len(h.items)-1] == cmd {
+		return nil
+	}
+	h.items = append(h.items, cmd)
+	h.pos = len(h.items)
+	if len(h.items) > historyLimit {
+		// файл переписывается целиком только при обрезке
+		h.items = h.items[len(h.items)-historyLimit:]
+		h.pos = len(h.items)
+		return os.WriteFile(h.path, []byte(strings.Join(h.items, "\n")+"\n"), 0600)
+	}
+	f, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(cmd + "\n"); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// предыдущая команда; text — текущее содержимое поля ввода
+func (h *cmdHistory) prev(text string) (string, bool) {
+	if h.pos == len(h.items) {
+		h.draft = text
+	}
+	if h.pos == 0 {
+		return "", false
+	}
+	h.pos--
+	return h.items[h.pos], true
+}
+
+func (h *cmdHistory) next() (string, bool) {
+	if h.pos >= len(h.items) {
+		return "", false
+	}
+	h.pos++
+	if h.pos == len(h.items) {
+		return h.draft, true
+	}
+	return h.items[h.pos], true
+}
+
+// команды, содержащие q без учёта регистра, от новых к старым, без повторов
+func (h *cmdHistory) search(q string, limit int) []string {
+	q = strings.ToLower(q)
+	seen := map[string]bool{}
+	var out []string
+	for i := len(h.items) - 1; i >= 0 && len(out) < limit; i-- {
+		it := h.items[i]
+		if seen[it] || !strings.Contains(strings.ToLower(it), q) {
+			continue
+		}
+		seen[it] = true
+		out = append(out, it)
+	}
+	return out
+}
@@ -0,0 +1,676 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Хуки изменений ---
+//
+// CREATE [OR REPLACE] HOOK <имя> ON <table | *> [AFTER] <событие>, ... RUN '<команда>' | LOG '<файл>'
+// DROP HOOK [IF EXISTS] <имя>
+// HOOKS — список хуков
+// HOOKS TRUST — разрешить команды RUN хуков этой папки
+//
+// События: INSERT, UPDATE, DELETE (по строке), CREATE и DROP (таблица;
+// переименование — DROP старого имени и CREATE нового). Хуки хранятся в
+// .csvdb_hooks.json рядом с таблицами, файл можно править и вручную.
+//
+// Событие — JSON-строка {"time", "event", "table", "id", "before",
+// "after"}; before и after — строка таблицы до и после изменения. LOG
+// дописывает её в файл внутри папки с таблицами: абсолютный путь, выход
+// из папки через .., файлы таблиц и служебные .-файлы запрещены. RUN выполняет
+// команду оболочки в папке с таблицами: событие подаётся на stdin,
+// CSVDB_EVENT, CSVDB_TABLE и CSVDB_ID — в окружении. Команды
+// выполняются по очереди в фоне, запись в таблицу их не ждёт; ошибка
+// хука не отменяет изменение и видна в списке HOOKS.
+//
+// Файл хуков приходит вместе с папкой, поэтому команды RUN выполняются
+// только после подтверждения: HOOKS TRUST или вопрос окна при запуске.
+// Подтверждённый набор команд запоминается для папки в настройках
+// пользователя (не в папке с таблицами); изменённые вручную команды
+// нужно подтвердить заново. Хуки, созданные CREATE HOOK в подтверждённой
+// папке, подтверждаются сразу.
+//
+// Для зашифрованных таблиц before и after не передаются: событие несёт
+// только время, тип, таблицу и id, чтобы данные не попадали открытым
+// текстом в файл LOG и на вход команды.
+
+const (
+	hooksFileName = ".csvdb_hooks.json"
+	hookTimeout   = 30 * time.Second
+	hookQueueSize = 256
+)
+
+var hookEventNames = []string{"insert", "update", "delete", "create", "drop"}
+
+type tableHook struct {
+	Name  string   `json:"name"`
+	Table string   `json:"table"` // имя таблицы без .csv или * — все таблицы
+	On    []string `json:"on"`
+	Run   string   `json:"run,omitempty"`
+	Log   string   `json:"log,omitempty"`
+}
+
+type hookConfig struct {
+	Hooks []tableHook `json:"hooks"`
+}
+
+type hookStmt struct {
+	cmd       string // create, drop, list, trust
+	hook      tableHook
+	orReplace bool
+	ifExists  bool
+}
+
+func (*hookStmt) statementNode() {}
+
+// событие изменения таблицы
+type changeEvent struct {
+	Time   string   `json:"time"`
+	Event  string   `json:"event"`
+	Table  string   `json:"table"`
+	ID     string   `json:"id,omitempty"`
+	Before *jsonRow `json:"before,omitempty"`
+	After  *jsonRow `json:"after,omitempty"`
+}
+
+// --- Разбор ---
+
+// CREATE [OR REPLACE] HOOK уже прочитан
+func (p *parser) parseCreateHook(orReplace bool) (*hookStmt, error) {
+	st := &hookStmt{cmd: "create", orReplace: orReplace}
+	var err error
+	if st.hook.Name, err = p.name("имя хука"); err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("on"); err != nil {
+		return nil, err
+	}
+	if p.acceptOp("*") {
+		st.hook.Table = "*"
+	} else if st.hook.Table, err = p.name("имя таблицы или *"); err != nil {
+		return nil, err
+	}
+	st.hook.Table = strings.TrimSuffix(st.hook.Table, ".csv")
+	p.acceptKeyword("after")
+	for {
+		t := p.tok
+		ev := strings.ToLower(t.text)
+		if t.kind != tokWord || !slices.Contains(hookEventNames, ev) {
+			return nil, p.errorf(t, "ожидалось событие INSERT, UPDATE, DELETE, CREATE или DROP, найдено %s", t)
+		}
+		p.advance()
+		if !slices.Contains(st.hook.On, ev) {
+			st.hook.On = append(st.hook.On, ev)
+		}
+		if !p.acceptOp(",") {
+			break
+		}
+	}
+	actTok := p.tok
+	switch {
+	case p.acceptKeyword("run"), p.acceptKeyword("log"):
+		if p.tok.kind != tokString {
+			return nil, p.errorf(p.tok, "ожидалась строка в кавычках, найдено %s", p.tok)
+		}
+		if strings.EqualFold(actTok.text, "run") {
+			st.hook.Run = p.tok.text
+		} else {
+			st.hook.Log = p.tok.text
+		}
+		p.advance()
+	default:
+		return nil, p.errorf(actTok, "ожидалось RUN '<команда>' или LOG '<файл>', найдено %s", actTok)
+	}
+	return st, nil
+}
+
+// DROP HOOK уже прочитан
+func (p *parser) parseDropHook() (*hookStmt, error) {
+	st := &hookStmt{cmd: "drop"}
+	var err error
+	if st.ifExists, err = p.acceptIfExists(); err != nil {
+		return nil, err
+	}
+	if st.hook.Name, err = p.name("имя хука"); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// --- Хранение ---
+
+var hooksMu sync.Mutex
+
+func loadHooks(dir string) (*hookConfig, error) {
+	cfg := &hookConfig{}
+	raw, err := os.ReadFile(filepath.Join(dir, hooksFileName))
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, cfg); err != nil {
+		return nil, fmt.Errorf("повреждён файл хуков %s: %w", hooksFileName, err)
+	}
+	return cfg, nil
+}
+
+func saveHooks(dir string, cfg *hookConfig) error {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false) // команды с > и & остаются читаемыми
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(cfg); err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, hooksFileName), b.Bytes())
+}
+
+func hookIndex(hooks []tableHook, name string) int {
+	return slices.IndexFunc(hooks, func(h tableHook) bool { return strings.EqualFold(h.Name, name) })
+}
+
+func execHook(st *hookStmt) (*queryResult, error) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	cfg, err := loadHooks(".")
+	if err != nil {
+		return nil, err
+	}
+	i := hookIndex(cfg.Hooks, st.hook.Name)
+	trusted := hooksTrusted(".", cfg)
+	switch st.cmd {
+	case "list":
+		res := hooksResult(cfg.Hooks)
+		if !trusted {
+			res.Message += "; команды RUN не подтверждены, разрешить: HOOKS TRUST"
+		}
+		return res, nil
+	case "trust":
+		cmds := hookCommands(cfg)
+		if len(cmds) == 0 {
+			return &queryResult{Message: "В папке нет хуков с командами RUN"}, nil
+		}
+		if err := trustHooks(".", cfg); err != nil {
+			return nil, err
+		}
+		res := hooksResult(cfg.Hooks)
+		res.Message = fmt.Sprintf("Команды хуков подтверждены: %d", len(cmds))
+		return res, nil
+	case "drop":
+		if i < 0 {
+			if st.ifExists {
+				return &queryResult{Message: fmt.Sprintf("Хук %s не найден, команда пропущена", st.hook.Name)}, nil
+			}
+			return nil, fmt.Errorf("хук '%s' не найден", st.hook.Name)
+		}
+		cfg.Hooks = slices.Delete(cfg.Hooks, i, i+1)
+		if err := saveHooks(".", cfg); err != nil {
+			return nil, err
+		}
+		if trusted {
+			if err := trustHooks(".", cfg); err != nil {
+				return nil, err
+			}
+		}
+		return &queryResult{Message: fmt.Sprintf("Хук %s удалён", st.hook.Name)}, nil
+	}
+	if st.hook.Log != "" {
+		if _, err := hookLogPath(".", st.hook.Log); err != nil {
+			return nil, err
+		}
+	}
+	if i >= 0 && !st.orReplace {
+		return nil, fmt.Errorf("хук %s уже существует, используйте CREATE OR REPLACE HOOK", st.hook.Name)
+	}
+	if i >= 0 {
+		cfg.Hooks[i] = st.hook
+	} else {
+		cfg.Hooks = append(cfg.Hooks, st.hook)
+	}
+	if err := saveHooks(".", cfg); err != nil {
+		return nil, err
+	}
+	if trusted {
+		if err := trustHooks(".", cfg); err != nil {
+			return nil, err
+		}
+	}
+	res := hooksResult(cfg.Hooks)
+	res.Message = fmt.Sprintf("Хук %s сохранён: %s при %s", st.hook.Name, st.hook.Table, strings.ToUpper(strings.Join(st.hook.On, ", ")))
+	return res, nil
+}
+
+func hooksResult(hooks []tableHook) *queryResult {
+	data := [][]string{{"хук", "таблица", "события", "действие", "последняя ошибка"}}
+	for _, h := range hooks {
+		action := "RUN " + h.Run
+		if h.Run == "" {
+			action = "LOG " + h.Log
+		}
+		data = append(data, []string{h.Name, h.Table, strings.ToUpper(strings.Join(h.On, ", ")), action, hookFailure(h.Name)})
+	}
+	return &queryResult{Data: data, ReadOnly: true, Message: fmt.Sprintf("Хуков %d", len(hooks))}
+}
+
+// --- Подтверждение команд ---
+
+var errHooksUntrusted = errors.New("команды хуков этой папки не подтверждены: проверьте их в HOOKS и выполните HOOKS TRUST")
+
+// команды RUN файла хуков без повторов, по порядку
+func hookCommands(cfg *hookConfig) []string {
+	var out []string
+	for _, h := range cfg.Hooks {
+		if h.Run != "" && !slices.Contains(out, h.Run) {
+			out = append(out, h.Run)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func hookDigest(cmds []string) string {
+	h := sha256.New()
+	for _, c := range cmds {
+		h.Write([]byte(c))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// подтверждённые наборы команд: абсолютный путь папки → хеш команд
+func hookTrustPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "csvdb", "trusted_hooks.json"), nil
+}
+
+func loadHookTrust() (map[string]string, error) {
+	trust := map[string]string{}
+	path, err := hookTrustPath()
+	if err != nil {
+		return nil, err
+	}
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return trust, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, &trust); err != nil {
+		return nil, fmt.Errorf("повреждён файл %s: %w", path, err)
+	}
+	return trust, nil
+}
+
+// Команды RUN папки подтверждены; без команд подтверждать нечего.
+// Вызывается под hooksMu.
+func hooksTrusted(dir string, cfg *hookConfig) bool {
+	cmds := hookCommands(cfg)
+	if len(cmds) == 0 {
+		return true
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	trust, err := loadHookTrust()
+	if err != nil {
+		reportHook("", err)
+		return false
+	}
+	return trust[abs] == hookDigest(cmds)
+}
+
+// запомнить команды RUN папки как подтверждённые; вызывается под hooksMu
+func trustHooks(dir string, cfg *hookConfig) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	trust, err := loadHookTrust()
+	if err != nil {
+		return err
+	}
+	if cmds := hookCommands(cfg); len(cmds) > 0 {
+		trust[abs] = hookDigest(cmds)
+	} else {
+		delete(trust, abs)
+	}
+	path, err := hookTrustPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	raw, err := json.MarshalIndent(trust, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(raw, '\n'))
+}
+
+// Неподтверждённые команды RUN папки — для вопроса при запуске окна.
+func untrustedHookCommands(dir string) []string {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	cfg, err := loadHooks(dir)
+	if err != nil || hooksTrusted(dir, cfg) {
+		return nil
+	}
+	return hookCommands(cfg)
+}
+
+// подтвердить команды RUN папки по ответу пользователя
+func trustFolderHooks(dir string) error {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	cfg, err := loadHooks(dir)
+	if err != nil {
+		return err
+	}
+	return trustHooks(dir, cfg)
+}
+
+// --- Хуки таблицы ---
+
+// хуки одной таблицы: файл хуков читается один раз на запись
+type tableHooks struct {
+	dir, table string
+	hooks      []tableHook
+	trusted    bool // команды RUN папки подтверждены
+	encrypted  bool // таблица зашифрована: строки в события не попадают
+}
+
+// хуки таблицы; ошибка файла хуков не мешает записи
+func hooksFor(fileName string) *tableHooks {
+	th := &tableHooks{dir: filepath.Dir(fileName), table: strings.TrimSuffix(filepath.Base(fileName), ".csv")}
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	cfg, err := loadHooks(th.dir)
+	if err != nil {
+		reportHook("", err)
+		return th
+	}
+	for _, h := range cfg.Hooks {
+		if h.Table == "*" || strings.EqualFold(h.Table, th.table) {
+			th.hooks = append(th.hooks, h)
+		}
+	}
+	if len(th.hooks) > 0 {
+		th.trusted = hooksTrusted(th.dir, cfg)
+		th.encrypted = isEncryptedFile(fileName)
+	}
+	return th
+}
+
+// есть хуки на изменение строк: только тогда saveTableData сравнивает данные
+func (th *tableHooks) rowEvents() bool {
+	for _, h := range th.hooks {
+		for _, ev := range []string{"insert", "update", "delete"} {
+			if slices.Contains(h.On, ev) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// --- События ---
+
+func rowEvent(event string, header, before, after []string) changeEvent {
+	ev := changeEvent{Event: event}
+	if before != nil {
+		ev.ID = cellAt(before, 0)
+		ev.Before = &jsonRow{cols: header, cells: before}
+	}
+	if after != nil {
+		ev.ID = cellAt(after, 0)
+		ev.After = &jsonRow{cols: header, cells: after}
+	}
+	return ev
+}
+
+// Изменения строк по id между старыми и новыми данными таблицы. При
+// смене заголовка (ALTER) строки не сравниваются.
+func rowChanges(old, data [][]string) []changeEvent {
+	if len(old) == 0 || len(data) == 0 || !slices.Equal(old[0], data[0]) {
+		return nil
+	}
+	header := data[0]
+	byID := make(map[string][]string, len(data))
+	for _, row := range data[1:] {
+		byID[cellAt(row, 0)] = row
+	}
+	var out []changeEvent
+	seen := make(map[string]bool, len(old))
+	for _, row := range old[1:] {
+		id := cellAt(row, 0)
+		seen[id] = true
+		switch now, ok := byID[id]; {
+		case !ok:
+			out = append(out, rowEvent("delete", header, row, nil))
+		case !slices.Equal(row, now):
+			out = append(out, rowEvent("update", header, row, now))
+		}
+	}
+	for _, row := range data[1:] {
+		if !seen[cellAt(row, 0)] {
+			out = append(out, rowEvent("insert", header, nil, row))
+		}
+	}
+	return out
+}
+
+// запуск хуков для событий таблицы
+func fireHooks(fileName string, events ...changeEvent) {
+	if len(events) > 0 {
+		hooksFor(fileName).fire(events...)
+	}
+}
+
+func (th *tableHooks) fire(events ...changeEvent) {
+	if len(th.hooks) == 0 {
+		return
+	}
+	now := time.Now().Format(time.RFC3339)
+	for _, ev := range events {
+		var hooks []tableHook
+		for _, h := range th.hooks {
+			if slices.Contains(h.On, ev.Event) {
+				hooks = append(hooks, h)
+			}
+		}
+		if len(hooks) == 0 {
+			continue
+		}
+		ev.Time, ev.Table = now, th.table
+		if th.encrypted {
+			ev.Before, ev.After = nil, nil
+		}
+		var b bytes.Buffer
+		enc := json.NewEncoder(&b)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(ev); err != nil {
+			reportHook("", err)
+			continue
+		}
+		line := bytes.TrimSuffix(b.Bytes(), []byte("\n"))
+		for _, h := range hooks {
+			if h.Log != "" {
+				reportHook(h.Name, appendEventLog(th.dir, h.Log, line))
+			}
+			switch {
+			case h.Run == "":
+			case !th.trusted:
+				reportHook(h.Name, errHooksUntrusted)
+			default:
+				enqueueHook(hookJob{hook: h, dir: th.dir, ev: ev, line: line})
+			}
+		}
+	}
+}
+
+func tableEvent(fileName, event string) {
+	fireHooks(fileName, changeEvent{Event: event})
+}
+
+// Путь файла LOG внутри папки с таблицами. Файл хуков можно править
+// вручную, поэтому путь проверяется и при каждой записи.
+func hookLogPath(dir, name string) (string, error) {
+	rel := filepath.Clean(name)
+	if filepath.IsAbs(rel) || filepath.VolumeName(rel) != "" || rel == ".." ||
+		strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("файл LOG '%s' должен быть внутри папки с таблицами", name)
+	}
+	base := filepath.Base(rel)
+	ext := strings.ToLower(filepath.Ext(base))
+	if rel == "." || strings.HasPrefix(base, ".") || ext == ".csv" || ext == viewExt {
+		return "", fmt.Errorf("файл LOG '%s' не может быть таблицей, представлением или служебным файлом", name)
+	}
+	return filepath.Join(dir, rel), nil
+}
+
+func appendEventLog(dir, name string, line []byte) error {
+	name, err := hookLogPath(dir, name)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// --- Выполнение команд ---
+
+type hookJob struct {
+	hook tableHook
+	dir  string
+	ev   changeEvent
+	line []byte
+}
+
+var hookRunner struct {
+	once    sync.Once
+	queue   chan hookJob
+	pending sync.WaitGroup
+
+	mu       sync.Mutex
+	failures map[string]string // хук → последняя ошибка
+}
+
+func enqueueHook(job hookJob) {
+	hookRunner.once.Do(func() {
+		hookRunner.queue = make(chan hookJob, hookQueueSize)
+		go func() {
+			for job := range hookRunner.queue {
+				reportHook(job.hook.Name, runHookCommand(job))
+				hookRunner.pending.Done()
+			}
+		}()
+	})
+	hookRunner.pending.Add(1)
+	hookRunner.queue <- job
+}
+
+// дождаться выполнения поставленных команд (перед выходом из csvdb без окна)
+func waitHooks() {
+	hookRunner.pending.Wait()
+}
+
+func runHookCommand(job hookJob) error {
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", job.hook.Run)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", job.hook.Run)
+	}
+	cmd.Dir = job.dir
+	cmd.Env = append(os.Environ(),
+		"CSVDB_EVENT="+job.ev.Event,
+		"CSVDB_TABLE="+job.ev.Table,
+		"CSVDB_ID="+job.ev.ID,
+	)
+	cmd.Stdin = bytes.NewReader(append(job.line, '\n'))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("команда не завершилась за %v", hookTimeout)
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%v: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// ошибка хука запоминается для HOOKS и пишется в stderr; nil — сброс
+func reportHook(name string, err error) {
+	hookRunner.mu.Lock()
+	defer hookRunner.mu.Unlock()
+	if hookRunner.failures == nil {
+		hookRunner.failures = map[string]string{}
+	}
+	key := strings.ToLower(name)
+	if err == nil {
+		delete(hookRunner.failures, key)
+		return
+	}
+	hookRunner.failures[key] = err.Error()
+	if name == "" {
+		name = hooksFileName
+	}
+	fmt.Fprintf(os.Stderr, "csvdb: хук %s: %v\n", name, err)
+}
+
+func hookFailure(name string) string {
+	hookRunner.mu.Lock()
+	defer hookRunner.mu.Unlock()
+	return hookRunner.failures[strings.ToLower(name)]
+}
+
+// имена хуков по порядку, для дополнения
+func hookNames() []string {
+	cfg, err := loadHooks(".")
+	if err != nil {
+		return nil
+	}
+	var out []string
+	for _, h := range cfg.Hooks {
+		out = append(out, h.Name)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// --- JOIN ---
+//
+// Соединение по равенствам (hash join): правая таблица читается в
+// память и раскладывается по ключу, строки левой части идут потоком.
+// LEFT JOIN дополняет строку без пары пустыми ячейками (NULL).
+// Пустые ключи не совпадают ни с чем.
+
+type joinClause struct {
+	left  bool // LEFT JOIN
+	table tableRef
+	on    expr
+}
+
+func (p *parser) parseJoins() ([]joinClause, error) {
+	var joins []joinClause
+	for {
+		var j joinClause
+		switch {
+		case p.acceptKeyword("join"):
+		case p.acceptKeyword("inner"):
+			if err := p.expectKeyword("join"); err != nil {
+				return nil, err
+			}
+		case p.acceptKeyword("left"):
+			p.acceptKeyword("outer")
+			if err := p.expectKeyword("join"); err != nil {
+				return nil, err
+			}
+			j.left = true
+		default:
+			return joins, nil
+		}
+		var err error
+		if j.table, err = p.parseTableRef(); err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("on"); err != nil {
+			return nil, err
+		}
+		if j.on, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+		joins = append(joins, j)
+	}
+}
+
+// источник строк для SELECT: FROM и все JOIN
+type rowSource struct {
+	scope  *columnScope
+	next   func() ([]string, error)
+	close  func() error
+	tables []string
+}
+
+func openSource(st *selectStmt) (*rowSource, error) {
+	fileName := tableFile(st.from.name)
+	sc, err := openTableScanner(fileName)
+	if err != nil {
+		return nil, err
+	}
+	header, next, err := withComputed(fileName, sc.header, sc.next)
+	if err != nil {
+		sc.Close()
+		return nil, err
+	}
+	src := &rowSource{
+		scope:  tableScope(fileName, st.from.qualifier(), header),
+		next:   next,
+		close:  sc.Close,
+		tables: []string{fileName},
+	}
+	for _, j := range st.joins {
+		if err := src.join(j); err != nil {
+			sc.Close()
+			return nil, err
+		}
+	}
+	return src, nil
+}
+
+// присоединить таблицу: область видимости расширяется её колонками
+func (src *rowSource) join(j joinClause) error {
+	fileName := tableFile(j.table.name)
+	qual := j.table.qualifier()
+	if scopeHasQualifier(src.scope, qual) {
+		return &queryError{pos: j.table.pos, msg: fmt.Sprintf("таблица '%s' уже есть в запросе, задайте псевдоним через AS", qual)}
+	}
+	data, err := readTableData(fileName)
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return fmt.Errorf("таблица %s пуста", fileName)
+	}
+	if data, err = withComputedData(fileName, data); err != nil {
+		return err
+	}
+	left := src.scope
+	right := tableScope(fileName, qual, data[0])
+	lkeys, rkeys, err := joinKeys(j.on, left, right)
+	if err != nil {
+		return err
+	}
+
+	// хеш-таблица правой стороны
+	index := map[string][]int{}
+	env := &rowEnv{scope: right}
+	for r := 1; r < len(data); r++ {
+		env.row = data[r]
+		key, ok, err := joinKey(rkeys, env)
+		if err != nil {
+			return err
+		}
+		if ok {
+			index[key] = append(index[key], r)
+		}
+	}
+
+	width, rwidth := len(left.names), len(right.names)
+	prev := src.next
+	lenv := &rowEnv{scope: left}
+	var pending [][]string
+	src.next = func() ([]string, error) {
+		for len(pending) == 0 {
+			row, err := prev()
+			if err != nil {
+				return nil, err
+			}
+			lenv.row = row
+			key, ok, err := joinKey(lkeys, lenv)
+			if err != nil {
+				return nil, err
+			}
+			var matches []int
+			if ok {
+				matches = index[key]
+			}
+			if len(matches) == 0 && j.left {
+				pending = append(pending, joinRow(row, nil, width, rwidth))
+			}
+			for _, m := range matches {
+				pending = append(pending, joinRow(row, data[m], width, rwidth))
+			}
+		}
+		row := pending[0]
+		pending = pending[1:]
+		return row, nil
+	}
+
+	merged := &columnScope{}
+	for _, s := range []*columnScope{left, right} {
+		for i := range s.names {
+			merged.add(s.quals[i], s.names[i], s.types[i])
+		}
+	}
+	src.scope = merged
+	src.tables = append(src.tables, fileName)
+	return nil
+}
+
+func joinRow(l, r []string, lw, rw int) []string {
+	out := make([]string, lw+rw)
+	copy(out, l)
+	copy(out[lw:], r)
+	return out
+}
+
+// Разбор ON на пары ключей: каждое условие — равенство выражения
+// над левой частью и выражения над присоединяемой таблицей.
+func joinKeys(on expr, left, right *columnScope) (lkeys, rkeys []expr, err error) {
+	for _, term := range splitAnd(on) {
+		b, ok := term.(*binaryExpr)
+		if !ok || b.op != "=" {
+			return nil, nil, errors.New("в ON поддерживаются только равенства, объединённые через AND")
+		}
+		ls, err := exprSide(b.l, left, right)
+		if err != nil {
+			return nil, nil, err
+		}
+		rs, err := exprSide(b.r, left, right)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch {
+		case ls == 1 && rs == 2:
+			lkeys, rkeys = append(lkeys, b.l), append(rkeys, b.r)
+		case ls == 2 && rs == 1:
+			lkeys, rkeys = append(lkeys, b.r), append(rkeys, b.l)
+		default:
+			return nil, nil, errors.New("каждое равенство в ON должно связывать колонки обеих таблиц")
+		}
+	}
+	for i := range lkeys {
+		if err := bindExpr(lkeys[i], left); err != nil {
+			return nil, nil, err
+		}
+		if err := bindExpr(rkeys[i], right); err != nil {
+			return nil, nil, err
+		}
+	}
+	return lkeys, rkeys, nil
+}
+
+func splitAnd(e expr) []expr {
+	if b, ok := e.(*binaryExpr); ok && b.op == "and" {
+		return append(splitAnd(b.l), splitAnd(b.r)...)
+	}
+	return []expr{e}
+}
+
+// сторона выражения: 1 — левая часть, 2 — присоединяемая таблица, 0 — без колонок
+func exprSide(e expr, left, right *columnScope) (int, error) {
+	side := 0
+	err := walkExpr(e, func(n expr) error {
+		c, ok := n.(*colRef)
+		if !ok {
+			return nil
+		}
+		_, errL := c.lookup(left)
+		_, errR := c.lookup(right)
+		s := 0
+		switch {
+		case errL == nil && errR == nil:
+			return &queryError{pos: c.pos, msg: fmt.Sprintf("колонка '%s' есть в обеих таблицах, укажите таблицу", c.raw)}
+		case errL == nil:
+			s = 1
+		case errR == nil && !mentions(left, c):
+			s = 2
+		default:
+			// в левой части колонка не найдена или неоднозначна
+			return &queryError{pos: c.pos, msg: errL.Error()}
+		}
+		if side != 0 && side != s {
+			return &queryError{pos: c.pos, msg: "выражение в ON смешивает колонки обеих таблиц"}
+		}
+		side = s
+		return nil
+	})
+	return side, err
+}
+
+// есть ли в области видимости колонка с таким именем (пусть и неоднозначная)
+func mentions(s *columnScope, c *colRef) bool {
+	for i, n := range s.names {
+		if strings.EqualFold(n, c.raw) || c.qual != "" && strings.EqualFold(n, c.name) && strings.EqualFold(s.quals[i], c.qual) {
+			return true
+		}
+	}
+	return false
+}
+
+// ключ соединения; равные по compareValues значения дают одинаковый ключ
+func joinKey(keys []expr, env *rowEnv) (string, bool, error) {
+	var b strings.Builder
+	for _, k := range keys {
+		v, err := k.eval(env)
+		if err != nil {
+			return "", false, err
+		}
+		if v.isNull() {
+			return "", false, nil
+		}
+		b.WriteString(hashKey(v))
+		b.WriteByte(0)
+	}
+	return b.String(), true, nil
+}
+
+func hashKey(v value) string {
+	if n, ok := v.number(); ok {
+		return "n" + strconv.FormatFloat(n, 'g', -1, 64)
+	}
+	if v.kind == valText {
+		if t, err := parseDate(v.s); err == nil {
+			return "d" + t.Format(dateLayouts[0])
+		}
+	}
+	return "s" + v.String()
+}
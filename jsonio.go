@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// --- Импорт и экспорт JSON ---
+//
+// Встроенные форматы расширений (plugin.go): JSON — массив объектов,
+// NDJSON — по объекту на строку. При импорте оба формата читают и то
+// и другое. Вложенные объекты раскладываются по колонкам с именами
+// через точку (address.city), массивы записываются JSON-текстом; если
+// имя совпало с ключом записи ("address.city" рядом с address), импорт
+// останавливается с ошибкой.
+// Колонка, где все значения — целые числа, получает тип int, числа —
+// float, true/false — bool; строки остаются текстом, даже если похожи
+// на числа. При экспорте значения колонок int, float и bool пишутся
+// без кавычек, пустые — null; остальные колонки — строками.
+
+func init() {
+	registerFormat(jsonFormat{})
+	registerFormat(jsonFormat{lines: true})
+}
+
+type jsonFormat struct {
+	lines bool // NDJSON
+}
+
+func (f jsonFormat) Name() string {
+	if f.lines {
+		return "NDJSON"
+	}
+	return "JSON"
+}
+
+func (f jsonFormat) Exts() []string {
+	if f.lines {
+		return []string{".ndjson", ".jsonl"}
+	}
+	return []string{".json"}
+}
+
+// --- Импорт ---
+
+// поле объекта в порядке файла
+type jsonField struct {
+	key string
+	val any // []jsonField, []any, string, json.Number, bool или nil
+}
+
+func (jsonFormat) Import(r io.Reader) ([][]string, map[string]string, error) {
+	dec := json.NewDecoder(bufio.NewReader(r))
+	dec.UseNumber()
+	var objs [][]jsonField
+	next := func() error {
+		v, err := readJSONValue(dec)
+		if err != nil {
+			return err
+		}
+		obj, ok := v.([]jsonField)
+		if !ok {
+			return fmt.Errorf("запись %d: ожидался объект, найдено %s", len(objs)+1, jsonKind(v))
+		}
+		objs = append(objs, obj)
+		return nil
+	}
+
+	tok, err := dec.Token()
+	if err == io.EOF {
+		return nil, nil, errors.New("файл пуст")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	switch tok {
+	case json.Delim('['): // массив объектов
+		for dec.More() {
+			if err := next(); err != nil {
+				return nil, nil, err
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, nil, err
+		}
+		if _, err := dec.Token(); err != io.EOF {
+			return nil, nil, errors.New("лишние данные после массива")
+		}
+	case json.Delim('{'): // объекты подряд (NDJSON)
+		obj, err := readJSONObject(dec)
+		if err != nil {
+			return nil, nil, err
+		}
+		objs = append(objs, obj)
+		for dec.More() {
+			if err := next(); err != nil {
+				return nil, nil, err
+			}
+		}
+	default:
+		return nil, nil, fmt.Errorf("ожидался массив или объекты JSON, найдено %v", tok)
+	}
+
+	// колонки в порядке первого появления
+	index := map[string]int{}
+	var header []string
+	var rows []map[string]any
+	for n, obj := range objs {
+		flat := map[string]any{}
+		err := flattenJSON("", obj, flat, func(key string) {
+			if _, ok := index[key]; !ok {
+				index[key] = len(header)
+				header = append(header, key)
+			}
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("запись %d: %w", n+1, err)
+		}
+		rows = append(rows, flat)
+	}
+	if len(header) == 0 {
+		return nil, nil, errors.New("в объектах нет полей")
+	}
+
+	data := [][]string{header}
+	kinds := make([]string, len(header))
+	for _, flat := range rows {
+		rec := make([]string, len(header))
+		for key, v := range flat {
+			i := index[key]
+			rec[i] = jsonCell(v)
+			kinds[i] = mergeKind(kinds[i], v)
+		}
+		data = append(data, rec)
+	}
+	types := map[string]string{}
+	for i, k := range kinds {
+		if k != "" && k != typeText {
+			types[header[i]] = k
+		}
+	}
+	return data, types, nil
+}
+
+func readJSONValue(dec *json.Decoder) (any, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		return readJSONObject(dec)
+	case json.Delim('['):
+		arr := []any{}
+		for dec.More() {
+			v, err := readJSONValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		_, err := dec.Token()
+		return arr, err
+	}
+	return tok, nil
+}
+
+// '{' уже прочитана
+func readJSONObject(dec *json.Decoder) ([]jsonField, error) {
+	obj := []jsonField{}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		v, err := readJSONValue(dec)
+		if err != nil {
+			return nil, err
+		}
+		obj = append(obj, jsonField{key: tok.(string), val: v})
+	}
+	_, err := dec.Token()
+	return obj, err
+}
+
+func jsonKind(v any) string {
+	switch v.(type) {
+	case []any:
+		return "массив"
+	case string:
+		return "строка"
+	case json.Number:
+		return "число"
+	case bool:
+		return "true/false"
+	case nil:
+		return "null"
+	}
+	return "объект"
+}
+
+// Вложенные объекты — колонки через точку. Одно имя колонки дважды
+// ({"a": {"b": 1}, "a.b": 2} или повтор ключа) — ошибка, а не потеря
+// одного из значений.
+func flattenJSON(prefix string, obj []jsonField, out map[string]any, seen func(string)) error {
+	for _, f := range obj {
+		key := prefix + f.key
+		if sub, ok := f.val.([]jsonField); ok && len(sub) > 0 {
+			if err := flattenJSON(key+".", sub, out, seen); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, dup := out[key]; dup {
+			return fmt.Errorf("поле '%s' встречается дважды", key)
+		}
+		seen(key)
+		out[key] = f.val
+	}
+	return nil
+}
+
+func jsonCell(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	case nil:
+		return ""
+	}
+	var b bytes.Buffer
+	writeJSONValue(&b, v)
+	return b.String()
+}
+
+func writeJSONValue(b *bytes.Buffer, v any) {
+	switch v := v.(type) {
+	case []jsonField:
+		b.WriteString("{")
+		for i, f := range v {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			b.Write(jsonText(f.key))
+			b.WriteString(":")
+			writeJSONValue(b, f.val)
+		}
+		b.WriteString("}")
+	case []any:
+		b.WriteString("[")
+		for i, e := range v {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			writeJSONValue(b, e)
+		}
+		b.WriteString("]")
+	case string:
+		b.Write(jsonText(v))
+	case nil:
+		b.WriteString("null")
+	default:
+		b.WriteString(jsonCell(v))
+	}
+}
+
+// тип колонки по значениям: null не влияет, int с float дают float,
+// любое другое сочетание — text
+func mergeKind(kind string, v any) string {
+	var k string
+	switch v := v.(type) {
+	case nil:
+		return kind
+	case json.Number:
+		k = typeFloat
+		if _, err := strconv.ParseInt(v.String(), 10, 64); err == nil {
+			k = typeInt
+		}
+	case bool:
+		k = typeBool
+	default:
+		k = typeText
+	}
+	switch {
+	case kind == "" || kind == k:
+		return k
+	case kind == typeInt && k == typeFloat || kind == typeFloat && k == typeInt:
+		return typeFloat
+	}
+	return typeText
+}
+
+// --- Экспорт ---
+
+func (f jsonFormat) Export(w io.Writer, data [][]string, types map[string]string) error {
+	if len(data) == 0 {
+		return errors.New("нет данных")
+	}
+	header := data[0]
+	keys := make([][]byte, len(header))
+	for i, h := range header {
+		keys[i] = jsonText(h)
+	}
+	bw := bufio.NewWriter(w)
+	if !f.lines {
+		bw.WriteString("[")
+	}
+	for r, rec := range data[1:] {
+		switch {
+		case f.lines:
+		case r > 0:
+			bw.WriteString(",\n  ")
+		default:
+			bw.WriteString("\n  ")
+		}
+		bw.WriteString("{")
+		for i, k := range keys {
+			if i > 0 {
+				bw.WriteString(", ")
+			}
+			bw.Write(k)
+			bw.WriteString(": ")
+			typ := types[header[i]]
+			if i == 0 && header[0] == "id" {
+				typ = typeInt
+			}
+			bw.Write(typedJSON(typ, cellAt(rec, i)))
+		}
+		bw.WriteString("}")
+		if f.lines {
+			bw.WriteString("\n")
+		}
+	}
+	if !f.lines {
+		if len(data) > 1 {
+			bw.WriteString("\n")
+		}
+		bw.WriteString("]\n")
+	}
+	return bw.Flush()
+}
+
+// значение по типу колонки; неподходящее типу пишется строкой
+func typedJSON(typ, v string) []byte {
+	s := strings.TrimSpace(v)
+	if s == "" && (typ == typeInt || typ == typeFloat || typ == typeBool) {
+		return []byte("null")
+	}
+	switch typ {
+	case typeInt:
+		if n, err := strconv.Atoi(s); err == nil {
+			return []byte(strconv.Itoa(n))
+		}
+	case typeFloat:
+		if json.Valid([]byte(s)) {
+			if _, err := strconv.ParseFloat(s, 64); err == nil {
+				return []byte(s) // как записано: 1.50 не становится 1.5
+			}
+		}
+		if n, err := parseNumber(s); err == nil && !math.IsInf(n, 0) && !math.IsNaN(n) {
+			return []byte(strconv.FormatFloat(n, 'f', -1, 64))
+		}
+	case typeBool:
+		if b, err := parseBool(s); err == nil {
+			return []byte(strconv.FormatBool(b))
+		}
+	}
+	return jsonText(v)
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// --- Лексер командной строки ---
+//
+// Слова без кавычек состоят из букв, цифр и символов _ . @, а внутри
+// слова допустимы также : и -, поэтому имена файлов (people.csv), даты
+// и объявления "age:int" остаются одним токеном. Строки в одинарных
+// или двойных кавычках поддерживают экранирование через \ и удвоение
+// кавычки. Комментарии: -- до конца строки и /* ... */.
+
+type tokenKind int
+
+const (
+	tokEOF    tokenKind = iota
+	tokWord             // слово без кавычек
+	tokNumber           // слово, являющееся числом
+	tokString           // строка в кавычках
+	tokOp               // знак: , ( ) ; * = != <> < <= > >= ...
+)
+
+type token struct {
+	kind  tokenKind
+	text  string // для строк — без кавычек, с раскрытым экранированием
+	pos   int    // позиция первого символа (в рунах)
+	end   int    // позиция после последнего символа
+	quote rune   // кавычка строки: ' или "
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "конец запроса"
+	case tokString:
+		return strconv.Quote(t.text)
+	}
+	return "'" + t.text + "'"
+}
+
+// ошибка разбора с позицией в исходной строке (в рунах)
+type queryError struct {
+	pos int
+	msg string
+}
+
+func (e *queryError) Error() string {
+	return fmt.Sprintf("позиция %d: %s", e.pos+1, e.msg)
+}
+
+// две строки для показа под полем ввода: запрос и указатель ^
+func (e *queryError) caret(src string) string {
+	line := strings.ReplaceAll(src, "\n", " ")
+	pos := e.pos
+	if n := len([]rune(line)); pos > n {
+		pos = n
+	}
+	return line + "\n" + strings.Repeat(" ", pos) + "^"
+}
+
+var twoCharOps = []string{"<=", ">=", "!=", "<>", "==", "||"}
+
+const singleCharOps = ",();*=<>!~^$+-/%|:"
+
+type lexer struct {
+	src []rune
+	pos int
+}
+
+func newLexer(src string) *lexer {
+	return &lexer{src: []rune(src)}
+}
+
+func isWordStart(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_.@", r)
+}
+
+func isWordRune(r rune) bool {
+	return isWordStart(r) || r == ':'
+}
+
+// '-' продолжает слово только перед буквой: my-table — одно имя,
+// age-1 — выражение
+func wordRuneAt(rs []rune, i int) bool {
+	if rs[i] == '-' {
+		return i+1 < len(rs) && unicode.IsLetter(rs[i+1])
+	}
+	return isWordRune(rs[i])
+}
+
+func (lx *lexer) peekRune(off int) rune {
+	if lx.pos+off < len(lx.src) {
+		return lx.src[lx.pos+off]
+	}
+	return 0
+}
+
+// пропуск пробелов и комментариев
+func (lx *lexer) skipSpace() error {
+	for lx.pos < len(lx.src) {
+		r := lx.src[lx.pos]
+		switch {
+		case unicode.IsSpace(r):
+			lx.pos++
+		case r == '-' && lx.peekRune(1) == '-':
+			for lx.pos < len(lx.src) && lx.src[lx.pos] != '\n' {
+				lx.pos++
+			}
+		case r == '/' && lx.peekRune(1) == '*':
+			start := lx.pos
+			lx.pos += 2
+			for {
+				if lx.pos >= len(lx.src) {
+					return &queryError{pos: start, msg: "незакрытый комментарий /*"}
+				}
+				if lx.src[lx.pos] == '*' && lx.peekRune(1) == '/' {
+					lx.pos += 2
+					break
+				}
+				lx.pos++
+			}
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func (lx *lexer) next() (token, error) {
+	if err := lx.skipSpace(); err != nil {
+		return token{}, err
+	}
+	start := lx.pos
+	if lx.pos >= len(lx.src) {
+		return token{kind: tokEOF, pos: start, end: start}, nil
+	}
+	r := lx.src[lx.pos]
+	switch {
+	case r == '\'' || r == '"':
+		return lx.quoted(r)
+	case isWordStart(r):
+		for lx.pos < len(lx.src) && wordRuneAt(lx.src, lx.pos) {
+			lx.pos++
+		}
+		text := string(lx.src[start:lx.pos])
+		kind := tokWord
+		if _, err := strconv.ParseFloat(text, 64); err == nil {
+			kind = tokNumber
+		}
+		return token{kind: kind, text: text, pos: start, end: lx.pos}, nil
+	}
+	if lx.pos+1 < len(lx.src) {
+		two := string(lx.src[lx.pos : lx.pos+2])
+		for _, op := range twoCharOps {
+			if two == op {
+				lx.pos += 2
+				return token{kind: tokOp, text: op, pos: start, end: lx.pos}, nil
+			}
+		}
+	}
+	if strings.ContainsRune(singleCharOps, r) {
+		lx.pos++
+		return token{kind: tokOp, text: string(r), pos: start, end: lx.pos}, nil
+	}
+	return token{}, &queryError{pos: start, msg: fmt.Sprintf("неожиданный символ '%c'", r)}
+}
+
+func (lx *lexer) quoted(q rune) (token, error) {
+	start := lx.pos
+	lx.pos++
+	var b strings.Builder
+	for {
+		if lx.pos >= len(lx.src) {
+			return token{}, &queryError{pos: start, msg: "незакрытая кавычка " + string(q)}
+		}
+		r := lx.src[lx.pos]
+		switch {
+		case r == '\\' && lx.pos+1 < len(lx.src):
+			lx.pos++
+			switch e := lx.src[lx.pos]; e {
+			case 'n':
+				b.WriteRune('\n')
+			case 't':
+				b.WriteRune('\t')
+			case 'r':
+				b.WriteRune('\r')
+			default:
+				b.WriteRune(e)
+			}
+			lx.pos++
+		case r == q && lx.peekRune(1) == q:
+			b.WriteRune(q)
+			lx.pos += 2
+		case r == q:
+			lx.pos++
+			return token{kind: tokString, text: b.String(), pos: start, end: lx.pos, quote: q}, nil
+		default:
+			b.WriteRune(r)
+			lx.pos++
+		}
+	}
+}
+
+// --- Парсер поверх лексера ---
+
+type parser struct {
+	lx      *lexer
+	tok     token // текущий токен
+	prevEnd int   // конец предыдущего токена
+	err     error // первая ошибка лексера
+}
+
+func newParser(src string) *parser {
+	p := &parser{lx: newLexer(src)}
+	p.advance()
+	return p
+}
+
+func (p *parser) advance() {
+	if p.err != nil {
+		return
+	}
+	p.prevEnd = p.tok.end
+	t, err := p.lx.next()
+	if err != nil {
+		p.err = err
+		p.tok = token{kind: tokEOF, pos: p.lx.pos, end: p.lx.pos}
+		return
+	}
+	p.tok = t
+}
+
+func (p *parser) errorf(t token, format string, args ...any) error {
+	if p.err != nil {
+		return p.err
+	}
+	return &queryError{pos: t.pos, msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) atEOF() bool {
+	return p.tok.kind == tokEOF || p.tok.kind == tokOp && p.tok.text == ";"
+}
+
+// текущий токен — ключевое слово kw (без учёта регистра, не в кавычках)
+func (p *parser) isKeyword(kw string) bool {
+	return p.tok.kind == tokWord && strings.EqualFold(p.tok.text, kw)
+}
+
+func (p *parser) acceptKeyword(kw string) bool {
+	if p.isKeyword(kw) {
+		p.advance()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectKeyword(kw string) error {
+	if !p.acceptKeyword(kw) {
+		return p.errorf(p.tok, "ожидалось %s, найдено %s", strings.ToUpper(kw), p.tok)
+	}
+	return nil
+}
+
+func (p *parser) isOp(op string) bool {
+	return p.tok.kind == tokOp && p.tok.text == op
+}
+
+func (p *parser) acceptOp(op string) bool {
+	if p.isOp(op) {
+		p.advance()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectOp(op string) error {
+	if !p.acceptOp(op) {
+		return p.errorf(p.tok, "ожидалось '%s', найдено %s", op, p.tok)
+	}
+	return nil
+}
+
+// имя (таблицы, колонки): слово или строка в кавычках
+func (p *parser) name(what string) (string, error) {
+	switch p.tok.kind {
+	case tokWord, tokNumber, tokString:
+		t := p.tok
+		p.advance()
+		return t.text, nil
+	}
+	return "", p.errorf(p.tok, "ожидалось %s, найдено %s", what, p.tok)
+}
+
+// конец оператора: допускается завершающая ';'
+func (p *parser) expectEnd() error {
+	p.acceptOp(";")
+	if p.tok.kind != tokEOF {
+		return p.errorf(p.tok, "лишний текст после команды: %s", p.tok)
+	}
+	return p.err
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"encoding/csv"
 	"errors"
 	"fmt"
@@ -9,42 +10,87 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 )
 
 // --- Работа с CSV-файлами и командами ---
 
+// имя файла таблицы с расширением .csv
+func tableFile(tableName string) string {
+	if strings.HasSuffix(tableName, ".csv") {
+		return tableName
+	}
+	return tableName + ".csv"
+}
+
 func tableExists(tableName string) bool {
 	_, err := os.Stat(tableName)
 	return !os.IsNotExist(err)
 }
 
+var errTableExists = errors.New("таблица уже существует")
+
+// файл назначения занят; errors.Is(err, errTableExists)
+type tableExistsError struct {
+	fileName string
+}
+
+func (e *tableExistsError) Error() string {
+	return fmt.Sprintf("таблица '%s' уже существует", e.fileName)
+}
+
+func (e *tableExistsError) Unwrap() error { return errTableExists }
+
+// колонки можно объявлять с типом: "age:int"
 func createTable(tableName string, columns []string) error {
-	fileName := tableName
-	if !strings.HasSuffix(fileName, ".csv") {
-		fileName += ".csv"
+	names, types, err := splitColumnTypes(columns)
+	if err != nil {
+		return err
 	}
-	if tableExists(fileName) {
-		return fmt.Errorf("таблица '%s' уже существует", tableName)
+	return createTableColumns(tableName, names, types)
+}
+
+// Таблица с колонками names как есть, без разбора "имя:тип" (импорт:
+// в именах из файла бывают двоеточия и пробелы). Если типы не
+// записались, файл таблицы удаляется.
+func createTableColumns(tableName string, names []string, types map[string]string) error {
+	fileName := tableFile(tableName)
+	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return &tableExistsError{fileName: fileName}
 	}
-	file, err := os.Create(fileName)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
 	w := csv.NewWriter(file)
-	header := append([]string{"id"}, columns...)
+	header := append([]string{"id"}, names...)
 	if err := w.Write(header); err != nil {
+		file.Close()
+		_ = os.Remove(fileName)
 		return err
 	}
 	w.Flush()
-	return w.Error()
+	err = w.Error()
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = setColumnTypes(fileName, types)
+	}
+	if err != nil {
+		_ = os.Remove(fileName)
+		_ = dropTableMeta(fileName)
+		return err
+	}
+	tableEvent(fileName, "create")
+	return recordChecksum(fileName)
 }
 
 func readHeader(tableName string) ([]string, error) {
-	f, err := os.Open(tableName)
+	f, err := openTableReader(tableName)
 	if err != nil {
 		return nil, err
 	}
@@ -54,7 +100,7 @@ func readHeader(tableName string) ([]string, error) {
 }
 
 func getNextID(tableName string) (int, error) {
-	f, err := os.Open(tableName)
+	f, err := openTableReader(tableName)
 	if err != nil {
 		return 0, err
 	}
@@ -103,11 +149,30 @@ func insertRecord(tableName string, fieldValues []string) error {
 	if len(header) > 0 && len(fieldValues) != len(header)-1 {
 		return fmt.Errorf("ошибка: неверное количество полей. Ожидалось %d, получено %d", len(header)-1, len(fieldValues))
 	}
+	if len(header) > 0 {
+		tm, err := getTableMeta(fileName)
+		if err != nil {
+			return err
+		}
+		if err := validateRow(tm.Types, header[1:], fieldValues); err != nil {
+			return err
+		}
+	}
 
 	id, err := getNextID(fileName)
 	if err != nil {
 		return err
 	}
+	row := append([]string{strconv.Itoa(id)}, fieldValues...)
+
+	// зашифрованный файл нельзя дописать в конец — переписываем целиком
+	if isEncryptedFile(fileName) {
+		data, err := readTableData(fileName)
+		if err != nil {
+			return err
+		}
+		return saveTableData(fileName, append(data, row))
+	}
 
 	f, err := os.OpenFile(fileName, os.O_APPEND|os.O_WRONLY, 0644)
 	if err != nil {
@@ -116,15 +181,44 @@ func insertRecord(tableName string, fieldValues []string) error {
 	defer f.Close()
 
 	w := csv.NewWriter(f)
-	if err := w.Write(append([]string{strconv.Itoa(id)}, fieldValues...)); err != nil {
+	if err := w.Write(row); err != nil {
 		return err
 	}
 	w.Flush()
-	return w.Error()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fireHooks(fileName, rowEvent("insert", header, nil, row))
+	return recordChecksum(fileName)
+}
+
+// Добавить несколько проверенных строк (значения без id) одной записью
+// таблицы: при ошибке не добавляется ни одна.
+func insertRecords(fileName string, rows [][]string) error {
+	data, err := readTableData(fileName)
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return errors.New("таблица без заголовка")
+	}
+	maxID := 0
+	for _, rec := range data[1:] {
+		if id, e := strconv.Atoi(cellAt(rec, 0)); e == nil && id > maxID {
+			maxID = id
+		}
+	}
+	for i, row := range rows {
+		data = append(data, append([]string{strconv.Itoa(maxID + 1 + i)}, row...))
+	}
+	return saveTableData(fileName, data)
 }
 
 func readTableData(tableName string) ([][]string, error) {
-	f, err := os.Open(tableName)
+	f, err := openTableReader(tableName)
 	if err != nil {
 		return nil, err
 	}
@@ -151,10 +245,38 @@ func atomicReplace(tempPath, finalPath string) error {
 
 // сохранить все данные таблицы целиком
 func saveTableData(tableName string, data [][]string) error {
-	fileName := tableName
-	if !strings.HasSuffix(fileName, ".csv") {
-		fileName += ".csv"
+	fileName := tableFile(tableName)
+	key, err := tableKeyFor(fileName)
+	if err != nil {
+		return err
+	}
+	// при повреждённых метаданных типы не проверить: таблица не меняется
+	if _, err := getTableMeta(fileName); err != nil {
+		return err
+	}
+	// для хуков строки сравниваются с прежними по id
+	hooks := hooksFor(fileName)
+	var old [][]string
+	if hooks.rowEvents() {
+		old, _ = readTableData(fileName)
 	}
+	if key != nil {
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		if err := w.WriteAll(data); err != nil {
+			return err
+		}
+		sealed, err := key.seal(buf.Bytes())
+		if err != nil {
+			return err
+		}
+		if err := writeFileAtomic(fileName, sealed); err != nil {
+			return err
+		}
+		hooks.fire(rowChanges(old, data)...)
+		return recordChecksum(fileName)
+	}
+
 	dir := filepath.Dir(fileName)
 	tmp, err := os.CreateTemp(dir, "csvdb_save_*.csv")
 	if err != nil {
@@ -189,13 +311,14 @@ func saveTableData(tableName string, data [][]string) error {
 		return err
 	}
 	_ = os.Remove(tmpPath)
-	return nil
+	hooks.fire(rowChanges(old, data)...)
+	return recordChecksum(fileName)
 }
 
 func deleteRecord(tableName string, id string) error {
-	fileName := tableName
-	if !strings.HasSuffix(fileName, ".csv") {
-		fileName += ".csv"
+	fileName := tableFile(tableName)
+	if isEncryptedFile(fileName) {
+		return deleteRecordInMemory(fileName, id)
 	}
 
 	in, err := os.Open(fileName)
@@ -225,7 +348,7 @@ func deleteRecord(tableName string, id string) error {
 		return err
 	}
 
-	found := false
+	var found []string
 	for {
 		rec, err := r.Read()
 		if err == io.EOF {
@@ -236,7 +359,7 @@ func deleteRecord(tableName string, id string) error {
 			return err
 		}
 		if len(rec) > 0 && rec[0] == id {
-			found = true
+			found = rec
 			continue
 		}
 		if err := w.Write(rec); err != nil {
@@ -257,30 +380,49 @@ func deleteRecord(tableName string, id string) error {
 		return err
 	}
 
-	if !found {
+	if found == nil {
 		return fmt.Errorf("запись с id=%s не найдена", id)
 	}
 	if err := atomicReplace(tmpPath, fileName); err != nil {
 		return err
 	}
 	_ = os.Remove(tmpPath)
-	return nil
+	fireHooks(fileName, rowEvent("delete", header, found, nil))
+	return recordChecksum(fileName)
 }
 
-func findRecord(tableName, columnName, value string) ([][]string, error) {
-	fileName := tableName
-	if !strings.HasSuffix(fileName, ".csv") {
-		fileName += ".csv"
-	}
-
-	f, err := os.Open(fileName)
+// удаление из зашифрованной таблицы: чтение, фильтрация и полная перезапись
+func deleteRecordInMemory(fileName, id string) error {
+	data, err := readTableData(fileName)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer f.Close()
+	if len(data) == 0 {
+		return errors.New("таблица пуста")
+	}
+	out := make([][]string, 0, len(data))
+	out = append(out, data[0])
+	for _, rec := range data[1:] {
+		if len(rec) > 0 && rec[0] == id {
+			continue
+		}
+		out = append(out, rec)
+	}
+	if len(out) == len(data) {
+		return fmt.Errorf("запись с id=%s не найдена", id)
+	}
+	return saveTableData(fileName, out)
+}
 
-	r := csv.NewReader(f)
+// Построчное чтение таблицы: заголовок читается при открытии
+type tableScanner struct {
+	c      io.Closer
+	r      *csv.Reader
+	header []string
+}
 
+func newTableScanner(in io.Reader) (*tableScanner, error) {
+	r := csv.NewReader(in)
 	header, err := r.Read()
 	if err == io.EOF {
 		return nil, errors.New("таблица пуста")
@@ -288,6 +430,57 @@ func findRecord(tableName, columnName, value string) ([][]string, error) {
 	if err != nil {
 		return nil, err
 	}
+	return &tableScanner{r: r, header: header}, nil
+}
+
+func openTableScanner(tableName string) (*tableScanner, error) {
+	f, err := openTableReader(tableFile(tableName))
+	if err != nil {
+		return nil, err
+	}
+	sc, err := newTableScanner(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	sc.c = f
+	return sc, nil
+}
+
+// следующая запись; io.EOF — конец таблицы
+func (s *tableScanner) next() ([]string, error) {
+	return s.r.Read()
+}
+
+func (s *tableScanner) Close() error {
+	if s.c != nil {
+		return s.c.Close()
+	}
+	return nil
+}
+
+func findRecord(tableName, columnName string, m *findMatcher) ([][]string, error) {
+	out, err := findRows(tableName, columnName, m)
+	if err != nil {
+		return nil, err
+	}
+	if len(out) == 1 {
+		return nil, m.notFound()
+	}
+	return out, nil
+}
+
+// заголовок и подходящие строки; пустой результат — не ошибка
+func findRows(tableName, columnName string, m *findMatcher) ([][]string, error) {
+	sc, err := openTableScanner(tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer sc.Close()
+	header, next, err := withComputed(tableFile(tableName), sc.header, sc.next)
+	if err != nil {
+		return nil, err
+	}
 
 	colIndex := -1
 	for i, col := range header {
@@ -303,29 +496,174 @@ func findRecord(tableName, columnName, value string) ([][]string, error) {
 	out := make([][]string, 0, 8)
 	out = append(out, header)
 	for {
-		rec, err := r.Read()
+		rec, err := next()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
 			return nil, err
 		}
-		if len(rec) > colIndex && rec[colIndex] == value {
+		if len(rec) > colIndex && m.match(rec[colIndex]) {
 			out = append(out, rec)
 		}
 	}
-	if len(out) == 1 {
-		return nil, fmt.Errorf("записи со значением '%s' не найдены", value)
+	if m.fuzzy != nil {
+		m.fuzzy.rank(out[1:], colIndex)
 	}
 	return out, nil
 }
 
 func deleteTable(name string) error {
-	filename := name
-	if !strings.HasSuffix(filename, ".csv") {
-		filename += ".csv"
+	filename := tableFile(name)
+	if err := os.Remove(filename); err != nil {
+		return err
+	}
+	forgetKey(filename)
+	tableEvent(filename, "drop")
+	return dropTableMeta(filename)
+}
+
+// dst существует и это не тот же файл (смена регистра имени на
+// нечувствительной к регистру ФС не считается перезаписью)
+func occupied(src, dst string) bool {
+	di, err := os.Stat(dst)
+	if err != nil {
+		return false
+	}
+	si, err := os.Stat(src)
+	return err != nil || !os.SameFile(si, di)
+}
+
+// копия таблицы вместе с типами колонок; без force существующая таблица не перезаписывается
+func copyTable(src, dst string, force bool) error {
+	src, dst = tableFile(src), tableFile(dst)
+	if src == dst {
+		return errors.New("нельзя скопировать таблицу в саму себя")
+	}
+	if !tableExists(src) {
+		return fmt.Errorf("таблица '%s' не найдена", src)
+	}
+	if occupied(src, dst) {
+		if !force {
+			return &tableExistsError{fileName: dst}
+		}
+		// копируем во временный файл и заменяем назначение одним переименованием
+		tmp, err := os.CreateTemp(filepath.Dir(dst), "csvdb_copy_*.csv")
+		if err != nil {
+			return err
+		}
+		tmpPath := tmp.Name()
+		tmp.Close()
+		_ = os.Remove(tmpPath)
+		if err := copyFile(src, tmpPath); err != nil {
+			_ = os.Remove(tmpPath)
+			return err
+		}
+		if err := atomicReplace(tmpPath, dst); err != nil {
+			return err
+		}
+	} else if err := copyFile(src, dst); err != nil {
+		return err
+	}
+	// копия зашифрована тем же ключом
+	if k := lookupKey(src); k != nil {
+		rememberKey(dst, k)
+	} else {
+		forgetKey(dst)
+	}
+	tableEvent(dst, "create")
+	return moveTableMeta(src, dst, true)
+}
+
+// переименование таблицы; без force существующая таблица не перезаписывается
+func renameTable(src, dst string, force bool) error {
+	src, dst = tableFile(src), tableFile(dst)
+	if src == dst {
+		return nil
+	}
+	if !tableExists(src) {
+		return fmt.Errorf("таблица '%s' не найдена", src)
+	}
+	replaced := occupied(src, dst)
+	if replaced && !force {
+		return &tableExistsError{fileName: dst}
+	}
+	if err := moveTableFile(src, dst, force); err != nil {
+		return err
+	}
+	if replaced {
+		// метаданные прежней таблицы удаляются только после замены файла
+		forgetKey(dst)
+		if err := dropTableMeta(dst); err != nil {
+			return err
+		}
 	}
-	return os.Remove(filename)
+	if k := lookupKey(src); k != nil {
+		forgetKey(src)
+		rememberKey(dst, k)
+	}
+	tableEvent(src, "drop")
+	tableEvent(dst, "create")
+	return moveTableMeta(src, dst, false)
+}
+
+// Перемещение файла таблицы. Без force — жёсткая ссылка и удаление
+// исходного файла: ссылка не создаётся, если dst появился после
+// проверки, а os.Rename в POSIX молча перезаписал бы его. Смена только
+// регистра имени и ФС без жёстких ссылок обходятся переименованием.
+func moveTableFile(src, dst string, force bool) error {
+	if force {
+		return os.Rename(src, dst)
+	}
+	if di, err := os.Stat(dst); err == nil {
+		if si, err := os.Stat(src); err == nil && os.SameFile(si, di) {
+			return os.Rename(src, dst)
+		}
+	}
+	err := os.Link(src, dst)
+	switch {
+	case errors.Is(err, os.ErrExist):
+		return &tableExistsError{fileName: dst}
+	case err != nil:
+		if occupied(src, dst) {
+			return &tableExistsError{fileName: dst}
+		}
+		return os.Rename(src, dst)
+	}
+	return os.Remove(src)
+}
+
+// удалить все строки, оставив заголовок; нумерация id начнётся заново
+func truncateTable(name string) (int, error) {
+	fileName := tableFile(name)
+	data, err := readTableData(fileName)
+	if err != nil {
+		return 0, err
+	}
+	if len(data) == 0 {
+		return 0, errors.New("таблица без заголовка")
+	}
+	return len(data) - 1, saveTableData(fileName, data[:1])
+}
+
+// имена CSV-таблиц в папке (скрытые файлы пропускаются)
+func listTables(dir string) []string {
+	var files []string
+	items, _ := os.ReadDir(dir)
+	for _, it := range items {
+		if it.IsDir() {
+			continue
+		}
+		n := it.Name()
+		if strings.HasPrefix(n, ".") {
+			continue
+		}
+		if strings.HasSuffix(strings.ToLower(n), ".csv") {
+			files = append(files, n)
+		}
+	}
+	sort.Strings(files)
+	return files
 }
 
 func copyFile(src, dst string) error {
@@ -335,7 +673,10 @@ func copyFile(src, dst string) error {
 	}
 	defer source.Close()
 
-	destination, err := os.Create(dst)
+	destination, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return &tableExistsError{fileName: dst}
+	}
 	if err != nil {
 		return err
 	}
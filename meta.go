@@ -0,0 +1,292 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Метаданные таблиц: контрольные суммы, типы и вычисляемые колонки ---
+//
+// Хранятся в скрытом файле .csvdb_meta.json рядом с таблицами,
+// ключ — имя файла таблицы без пути.
+
+const metaFileName = ".csvdb_meta.json"
+
+// Типы колонок. Пустое значение допустимо для любого типа.
+const (
+	typeText  = "text"
+	typeInt   = "int"
+	typeFloat = "float"
+	typeBool  = "bool"
+	typeDate  = "date"
+)
+
+var columnTypes = []string{typeText, typeInt, typeFloat, typeBool, typeDate}
+
+var dateLayouts = []string{"2006-01-02", "02.01.2006"}
+
+type tableMeta struct {
+	Checksum string            `json:"checksum,omitempty"`
+	Types    map[string]string `json:"types,omitempty"`
+	Computed []computedColumn  `json:"computed,omitempty"`
+}
+
+type dbMeta struct {
+	Tables map[string]*tableMeta `json:"tables"`
+}
+
+var metaMu sync.Mutex
+
+func metaPath(fileName string) string {
+	return filepath.Join(filepath.Dir(fileName), metaFileName)
+}
+
+func loadMeta(path string) (*dbMeta, error) {
+	m := &dbMeta{Tables: map[string]*tableMeta{}}
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, m); err != nil {
+		return nil, fmt.Errorf("повреждён файл метаданных %s: %w", path, err)
+	}
+	if m.Tables == nil {
+		m.Tables = map[string]*tableMeta{}
+	}
+	return m, nil
+}
+
+func saveMeta(path string, m *dbMeta) error {
+	raw, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(raw, '\n'))
+}
+
+// Метаданные одной таблицы (копия; nil-карты заменены пустыми).
+// Повреждённый файл метаданных — ошибка: без типов запись пропустила
+// бы проверку значений.
+func getTableMeta(fileName string) (tableMeta, error) {
+	metaMu.Lock()
+	defer metaMu.Unlock()
+	m, err := loadMeta(metaPath(fileName))
+	if err != nil {
+		return tableMeta{Types: map[string]string{}}, err
+	}
+	tm, ok := m.Tables[filepath.Base(fileName)]
+	if !ok {
+		return tableMeta{Types: map[string]string{}}, nil
+	}
+	out := *tm
+	out.Types = map[string]string{}
+	for k, v := range tm.Types {
+		out.Types[k] = v
+	}
+	out.Computed = append([]computedColumn(nil), tm.Computed...)
+	return out, nil
+}
+
+// изменить метаданные таблицы; fn может вернуть false, чтобы удалить запись
+func updateTableMeta(fileName string, fn func(tm *tableMeta) bool) error {
+	metaMu.Lock()
+	defer metaMu.Unlock()
+	path := metaPath(fileName)
+	m, err := loadMeta(path)
+	if err != nil {
+		return err
+	}
+	key := filepath.Base(fileName)
+	tm, ok := m.Tables[key]
+	if !ok {
+		tm = &tableMeta{}
+	}
+	if tm.Types == nil {
+		tm.Types = map[string]string{}
+	}
+	if fn(tm) {
+		m.Tables[key] = tm
+	} else {
+		delete(m.Tables, key)
+	}
+	return saveMeta(path, m)
+}
+
+func fileChecksum(fileName string) (string, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// запомнить контрольную сумму после записи таблицы приложением
+func recordChecksum(fileName string) error {
+	sum, err := fileChecksum(fileName)
+	if err != nil {
+		return err
+	}
+	return updateTableMeta(fileName, func(tm *tableMeta) bool {
+		tm.Checksum = sum
+		return true
+	})
+}
+
+func dropTableMeta(fileName string) error {
+	return updateTableMeta(fileName, func(*tableMeta) bool { return false })
+}
+
+// перенести метаданные на новое имя (переименование или копия)
+func moveTableMeta(src, dst string, keepSrc bool) error {
+	tm, err := getTableMeta(src)
+	if err != nil {
+		return err
+	}
+	if err := updateTableMeta(dst, func(t *tableMeta) bool {
+		t.Types = tm.Types
+		t.Computed = tm.Computed
+		return true
+	}); err != nil {
+		return err
+	}
+	if !keepSrc {
+		if err := dropTableMeta(src); err != nil {
+			return err
+		}
+	}
+	return recordChecksum(dst)
+}
+
+func setColumnTypes(fileName string, types map[string]string) error {
+	return updateTableMeta(fileName, func(tm *tableMeta) bool {
+		for col, typ := range types {
+			if typ == "" || typ == typeText {
+				delete(tm.Types, col)
+				continue
+			}
+			tm.Types[col] = typ
+		}
+		return true
+	})
+}
+
+func isColumnType(typ string) bool {
+	for _, t := range columnTypes {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// Разбор объявлений колонок вида "age:int"; тип по умолчанию — text
+func splitColumnTypes(cols []string) (names []string, types map[string]string, err error) {
+	types = map[string]string{}
+	for _, c := range cols {
+		name, typ, found := strings.Cut(c, ":")
+		name = strings.TrimSpace(name)
+		typ = strings.ToLower(strings.TrimSpace(typ))
+		if name == "" {
+			return nil, nil, fmt.Errorf("пустое имя колонки в '%s'", c)
+		}
+		if found {
+			if !isColumnType(typ) {
+				return nil, nil, fmt.Errorf("неизвестный тип '%s' у колонки %s (доступны: %s)", typ, name, strings.Join(columnTypes, ", "))
+			}
+			types[name] = typ
+		}
+		names = append(names, name)
+	}
+	return names, types, nil
+}
+
+// число с учётом десятичной запятой: "3,14" == "3.14"
+func parseNumber(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if strings.Count(s, ",") == 1 && !strings.Contains(s, ".") {
+		s = strings.Replace(s, ",", ".", 1)
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+func parseBool(s string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "true", "1", "yes", "да":
+		return true, nil
+	case "false", "0", "no", "нет":
+		return false, nil
+	}
+	return false, fmt.Errorf("'%s' не является логическим значением", s)
+}
+
+func parseDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("'%s' не является датой (ГГГГ-ММ-ДД или ДД.ММ.ГГГГ)", s)
+}
+
+func checkValueType(typ, v string) error {
+	if strings.TrimSpace(v) == "" {
+		return nil
+	}
+	switch typ {
+	case typeInt:
+		if _, err := strconv.Atoi(strings.TrimSpace(v)); err != nil {
+			return fmt.Errorf("'%s' не является целым числом", v)
+		}
+	case typeFloat:
+		if _, err := parseNumber(v); err != nil {
+			return fmt.Errorf("'%s' не является числом", v)
+		}
+	case typeBool:
+		_, err := parseBool(v)
+		return err
+	case typeDate:
+		_, err := parseDate(v)
+		return err
+	}
+	if vd, ok := validators[typ]; ok {
+		if err := vd.Check(strings.TrimSpace(v)); err != nil {
+			return fmt.Errorf("'%s': %w", v, err)
+		}
+	}
+	return nil
+}
+
+// проверка строки по объявленным типам колонок
+func validateRow(types map[string]string, header, row []string) error {
+	var errs []error
+	for i, col := range header {
+		if i >= len(row) {
+			break
+		}
+		if typ, ok := types[col]; ok {
+			if err := checkValueType(typ, row[i]); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", col, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
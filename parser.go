@@ -0,0 +1,235 @@
+package main
+
+import (
+	"strings"
+)
+
+/*************** Парсер команд ***************/
+
+// разобранная команда
+type statement interface {
+	statementNode()
+}
+
+// CREATE [IF NOT EXISTS] <table> <col1[:type], col2...>
+type createStmt struct {
+	table       string
+	columns     []string
+	ifNotExists bool
+}
+
+// FIND <table> <column> [~ ^ /re/ < > ...] <value> [NOCASE]
+type findStmt struct {
+	table, column string
+	match         *findMatcher
+}
+
+// VERIFY [table] [FIX]
+type verifyStmt struct {
+	table string
+	fix   bool
+}
+
+// ENCRYPT / DECRYPT / PASSWD / LOCK <table>
+type keyStmt struct {
+	cmd   string
+	table string
+}
+
+func (*createStmt) statementNode() {}
+func (*findStmt) statementNode()   {}
+func (*verifyStmt) statementNode() {}
+func (*keyStmt) statementNode()    {}
+
+func parseQuery(q string) (statement, error) {
+	p := newParser(q)
+	st, err := p.parseStatement()
+	if err != nil {
+		return nil, err
+	}
+	return st, p.expectEnd()
+}
+
+func (p *parser) parseStatement() (statement, error) {
+	if p.atEOF() {
+		if p.err != nil {
+			return nil, p.err
+		}
+		return nil, &queryError{pos: p.tok.pos, msg: "пустой запрос"}
+	}
+	cmdTok := p.tok
+	if cmdTok.kind != tokWord {
+		return nil, p.errorf(cmdTok, "ожидалась команда, найдено %s", cmdTok)
+	}
+	cmd := strings.ToLower(cmdTok.text)
+	p.advance()
+
+	switch cmd {
+	case "select":
+		return p.parseSelect()
+	case "insert":
+		return p.parseInsert()
+	case "update":
+		return p.parseUpdate()
+	case "delete":
+		return p.parseDelete()
+	case "alter":
+		return p.parseAlter()
+	case "drop", "open":
+		if p.acceptKeyword("view") {
+			return p.parseViewCmd(cmd)
+		}
+		if cmd == "drop" && p.acceptKeyword("hook") {
+			return p.parseDropHook()
+		}
+		if cmd == "open" {
+			return nil, p.errorf(p.tok, "ожидалось VIEW, найдено %s", p.tok)
+		}
+		return p.parseTableCmd(cmd)
+	case "truncate", "rename", "copy":
+		return p.parseTableCmd(cmd)
+	case "dry":
+		if err := p.expectKeyword("run"); err != nil {
+			return nil, err
+		}
+		inner := p.tok
+		st, err := p.parseStatement()
+		if err != nil {
+			return nil, err
+		}
+		switch st.(type) {
+		case *insertStmt, *updateStmt, *deleteStmt:
+			return &dryRunStmt{stmt: st}, nil
+		}
+		return nil, p.errorf(inner, "DRY RUN применим только к INSERT, UPDATE и DELETE")
+	case "set":
+		return p.parseSet()
+	case "source":
+		return p.parseSource()
+	case "script":
+		return p.parseStar()
+	case "hooks":
+		if p.acceptKeyword("trust") {
+			return &hookStmt{cmd: "trust"}, nil
+		}
+		return &hookStmt{cmd: "list"}, nil
+	case "verify":
+		st := &verifyStmt{}
+		if !p.atEOF() && !p.isKeyword("fix") {
+			name, err := p.name("имя таблицы")
+			if err != nil {
+				return nil, err
+			}
+			st.table = name
+		}
+		st.fix = p.acceptKeyword("fix")
+		return st, nil
+	case "create", "find", "encrypt", "decrypt", "passwd", "lock":
+	default:
+		if c, ok := pluginCommands[cmd]; ok {
+			return p.parsePluginCommand(c)
+		}
+		return nil, p.errorf(cmdTok, "неизвестная команда %s", cmdTok.text)
+	}
+
+	if cmd == "create" {
+		orReplace := false
+		if p.acceptKeyword("or") {
+			if err := p.expectKeyword("replace"); err != nil {
+				return nil, err
+			}
+			orReplace = true
+		}
+		if p.acceptKeyword("hook") {
+			return p.parseCreateHook(orReplace)
+		}
+		if orReplace || p.isKeyword("view") {
+			return p.parseCreateView(orReplace)
+		}
+	}
+	ifNotExists := false
+	if cmd == "create" {
+		var err error
+		if ifNotExists, err = p.acceptIfNotExists(); err != nil {
+			return nil, err
+		}
+	}
+	if p.atEOF() {
+		return nil, p.errorf(p.tok, "не указано имя таблицы")
+	}
+	table, err := p.name("имя таблицы")
+	if err != nil {
+		return nil, err
+	}
+
+	switch cmd {
+	case "create":
+		if p.atEOF() {
+			return nil, p.errorf(p.tok, "create требует список колонок")
+		}
+		cols, err := p.columnList()
+		if err != nil {
+			return nil, err
+		}
+		if len(cols) == 0 {
+			return nil, p.errorf(p.tok, "не найдены названия колонок")
+		}
+		return &createStmt{table: table, columns: cols, ifNotExists: ifNotExists}, nil
+	case "find":
+		col, err := p.name("имя колонки")
+		if err != nil {
+			return nil, err
+		}
+		if p.atEOF() {
+			return nil, p.errorf(p.tok, "find: укажите колонку и значение")
+		}
+		m, err := p.parseFindMatcher()
+		if err != nil {
+			return nil, err
+		}
+		return &findStmt{table: table, column: col, match: m}, nil
+	}
+	return &keyStmt{cmd: cmd, table: table}, nil
+}
+
+// Список колонок: "name, age:int, city" или "name age city".
+// Через запятую имя может состоять из нескольких слов.
+func (p *parser) columnList() ([]string, error) {
+	var groups [][]string
+	var cur []string
+	commas := false
+	for !p.atEOF() {
+		if p.acceptOp(",") {
+			commas = true
+			groups = append(groups, cur)
+			cur = nil
+			continue
+		}
+		if p.isOp(":") && len(cur) > 0 {
+			// тип после имени в кавычках: "first name":text
+			p.advance()
+			typ, err := p.name("тип колонки")
+			if err != nil {
+				return nil, err
+			}
+			cur[len(cur)-1] += ":" + typ
+			continue
+		}
+		n, err := p.name("имя колонки")
+		if err != nil {
+			return nil, err
+		}
+		cur = append(cur, n)
+	}
+	groups = append(groups, cur)
+	if !commas {
+		return cur, p.err
+	}
+	var cols []string
+	for _, g := range groups {
+		if len(g) > 0 {
+			cols = append(cols, strings.Join(g, " "))
+		}
+	}
+	return cols, p.err
+}
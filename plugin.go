@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// --- Расширения ---
+//
+// Свои проверки значений, команды и форматы файлов добавляются
+// отдельным файлом в этом пакете: функция init регистрирует их, и
+// после сборки они работают наравне со встроенными.
+//
+//	func init() {
+//		registerValidator(innValidator{}) // CREATE firms name, inn:inn
+//		registerCommand(reportCommand{})  // REPORT people 2024
+//		registerFormat(xlsxFormat{})      // меню «Импорт из XLSX…», «Экспорт в XLSX…»
+//	}
+//
+// Проверка становится типом колонки: её имя пишется после двоеточия
+// в CREATE и ALTER ... TYPE, значения проверяются при вставке, правке,
+// в диалоге новой записи и в VERIFY. Команда получает аргументы после
+// своего имени. Формат реализует импорт, экспорт или оба.
+// Регистрация имени, занятого встроенным типом, командой или другим
+// расширением, — ошибка: программа завершается при запуске.
+
+// проверка значений колонки; пустое значение допустимо всегда и
+// в Check не передаётся
+type columnValidator interface {
+	Name() string // имя типа: inn, snils
+	Check(value string) error
+}
+
+// команда поля ввода, строки csvdb query и скриптов
+type commandPlugin interface {
+	Name() string  // ключевое слово
+	Usage() string // строка справки: REPORT <table> <год> - отчёт
+	// аргументы после имени: слова, числа и знаки как написаны,
+	// строки в кавычках — без кавычек
+	Run(args []string) (*queryResult, error)
+}
+
+// формат файла: реализует tableImporter, tableExporter или оба
+type tableFormat interface {
+	Name() string   // название в меню: XLSX
+	Exts() []string // расширения файла с точкой, первое — для экспорта: .xlsx
+}
+
+type tableImporter interface {
+	tableFormat
+	// заголовок и строки без колонки id; types — типы колонок, если
+	// формат их знает (может быть nil)
+	Import(r io.Reader) (data [][]string, types map[string]string, err error)
+}
+
+type tableExporter interface {
+	tableFormat
+	// данные как в сетке: заголовок и строки, первая колонка — id;
+	// types — объявленные типы колонок (text не указывается)
+	Export(w io.Writer, data [][]string, types map[string]string) error
+}
+
+var (
+	validators     = map[string]columnValidator{}
+	pluginCommands = map[string]commandPlugin{}
+	tableFormats   []tableFormat
+)
+
+func registerValidator(v columnValidator) {
+	name := strings.ToLower(v.Name())
+	if name == "" || isColumnType(name) {
+		panic(fmt.Sprintf("csvdb: тип колонки '%s' уже существует", name))
+	}
+	validators[name] = v
+	columnTypes = append(columnTypes, name)
+}
+
+func registerCommand(c commandPlugin) {
+	name := strings.ToLower(c.Name())
+	if name == "" || slices.Contains(statementKeywords, name) {
+		panic(fmt.Sprintf("csvdb: команда '%s' уже существует", name))
+	}
+	pluginCommands[name] = c
+	statementKeywords = append(statementKeywords, name)
+}
+
+func registerFormat(f tableFormat) {
+	_, imp := f.(tableImporter)
+	_, exp := f.(tableExporter)
+	if !imp && !exp {
+		panic(fmt.Sprintf("csvdb: формат %s не умеет ни импорт, ни экспорт", f.Name()))
+	}
+	for _, g := range tableFormats {
+		if strings.EqualFold(g.Name(), f.Name()) {
+			panic(fmt.Sprintf("csvdb: формат %s уже существует", f.Name()))
+		}
+	}
+	tableFormats = append(tableFormats, f)
+}
+
+// --- Команды расширений ---
+
+type pluginStmt struct {
+	cmd  commandPlugin
+	args []string
+}
+
+func (*pluginStmt) statementNode() {}
+
+// имя команды уже прочитано; аргументы — все токены до конца команды
+func (p *parser) parsePluginCommand(c commandPlugin) (*pluginStmt, error) {
+	st := &pluginStmt{cmd: c}
+	for !p.atEOF() {
+		st.args = append(st.args, p.tok.text)
+		p.advance()
+	}
+	return st, p.err
+}
+
+func execPlugin(st *pluginStmt) (*queryResult, error) {
+	res, err := st.cmd.Run(st.args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", strings.ToUpper(st.cmd.Name()), err)
+	}
+	if res == nil {
+		res = &queryResult{}
+	}
+	return res, nil
+}
+
+// строки справки команд расширений по алфавиту
+func pluginUsage() []string {
+	var out []string
+	for _, c := range pluginCommands {
+		out = append(out, c.Usage())
+	}
+	sort.Strings(out)
+	return out
+}
+
+// --- Форматы расширений ---
+
+func importers() []tableImporter {
+	var out []tableImporter
+	for _, f := range tableFormats {
+		if imp, ok := f.(tableImporter); ok {
+			out = append(out, imp)
+		}
+	}
+	return out
+}
+
+func exporters() []tableExporter {
+	var out []tableExporter
+	for _, f := range tableFormats {
+		if exp, ok := f.(tableExporter); ok {
+			out = append(out, exp)
+		}
+	}
+	return out
+}
+
+// Чтение файла для импорта: данные как в таблице, с колонкой id.
+// Колонки id из файла (в любом месте, без учёта регистра) не переносятся:
+// строки нумеруются заново. Короткие строки дополняются пустыми
+// значениями, длинные — ошибка.
+func readImport(imp tableImporter, r io.Reader) ([][]string, map[string]string, error) {
+	data, types, err := imp.Import(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("импорт %s: %w", imp.Name(), err)
+	}
+	if len(data) == 0 || len(data[0]) == 0 {
+		return nil, nil, fmt.Errorf("импорт %s: в файле нет заголовка", imp.Name())
+	}
+	var header []string
+	var keep []int // номера переносимых колонок файла
+	skipped := map[string]bool{}
+	for i, col := range data[0] {
+		if strings.EqualFold(strings.TrimSpace(col), "id") {
+			skipped[col] = true
+			continue
+		}
+		if strings.TrimSpace(col) == "" || slices.Contains(header, col) {
+			return nil, nil, fmt.Errorf("импорт %s: пустое или повторяющееся имя колонки '%s'", imp.Name(), col)
+		}
+		header = append(header, col)
+		keep = append(keep, i)
+	}
+	if len(header) == 0 {
+		return nil, nil, fmt.Errorf("импорт %s: в файле нет колонок кроме id", imp.Name())
+	}
+	declared := types
+	types = map[string]string{}
+	for col, typ := range declared {
+		if skipped[col] {
+			continue // id нумеруется заново
+		}
+		if !slices.Contains(header, col) || !isColumnType(typ) {
+			return nil, nil, fmt.Errorf("импорт %s: неверный тип '%s' у колонки '%s'", imp.Name(), typ, col)
+		}
+		types[col] = typ
+	}
+	out := [][]string{append([]string{"id"}, header...)}
+	for i, rec := range data[1:] {
+		if len(rec) > len(data[0]) {
+			return nil, nil, fmt.Errorf("импорт %s: в строке %d значений %d, колонок %d", imp.Name(), i+1, len(rec), len(data[0]))
+		}
+		row := make([]string, len(header)+1)
+		row[0] = strconv.Itoa(i + 1)
+		for j, k := range keep {
+			row[j+1] = cellAt(rec, k)
+		}
+		if err := validateRow(types, header, row[1:]); err != nil {
+			return nil, nil, fmt.Errorf("импорт %s, строка %d: %w", imp.Name(), i+1, err)
+		}
+		out = append(out, row)
+	}
+	return out, types, nil
+}
+
+// новая таблица из прочитанных readImport данных
+func importTable(table, format string, data [][]string, types map[string]string) (*queryResult, error) {
+	fileName := tableFile(table)
+	if err := createTableColumns(table, data[0][1:], types); err != nil {
+		return nil, err
+	}
+	if len(data) > 1 {
+		if err := saveTableData(fileName, data); err != nil {
+			_ = deleteTable(fileName) // без строк таблица не остаётся
+			return nil, err
+		}
+	}
+	return &queryResult{
+		Table:    fileName,
+		Data:     data,
+		Affected: len(data) - 1,
+		Message:  fmt.Sprintf("Таблица %s импортирована из %s: строк %d", table, format, len(data)-1),
+	}, nil
+}
@@ -0,0 +1,540 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// --- SELECT ---
+//
+// SELECT <колонки | *> FROM <таблица> [AS t]
+//   [[INNER | LEFT [OUTER]] JOIN <таблица> [AS u] ON t.a = u.b [AND ...]]
+//   [WHERE <условие>] [GROUP BY <выражение>, ... [HAVING <условие>]]
+//   [ORDER BY <выражение> [ASC|DESC], ...]
+//   [LIMIT n] [OFFSET m]
+
+type selectItem struct {
+	expr  expr
+	title string // заголовок колонки результата
+	alias bool   // заголовок задан через AS
+	star  bool   // * или t.*
+	qual  string // псевдоним таблицы для t.*
+}
+
+type tableRef struct {
+	name  string
+	alias string
+	pos   int
+}
+
+// псевдоним для квалифицированных имён колонок: явный или имя файла без .csv
+func (t tableRef) qualifier() string {
+	if t.alias != "" {
+		return t.alias
+	}
+	return strings.TrimSuffix(filepath.Base(t.name), ".csv")
+}
+
+type orderItem struct {
+	expr expr
+	desc bool
+}
+
+type selectStmt struct {
+	items   []selectItem
+	from    tableRef
+	joins   []joinClause
+	where   expr
+	groupBy []expr
+	having  expr
+	orderBy []orderItem
+	limit   int // -1 — без ограничения
+	offset  int
+}
+
+func (*selectStmt) statementNode() {}
+
+func (p *parser) parseSelect() (*selectStmt, error) {
+	st := &selectStmt{limit: -1}
+	items, err := p.parseSelectItems()
+	if err != nil {
+		return nil, err
+	}
+	st.items = items
+
+	if err := p.expectKeyword("from"); err != nil {
+		return nil, err
+	}
+	if st.from, err = p.parseTableRef(); err != nil {
+		return nil, err
+	}
+	if st.joins, err = p.parseJoins(); err != nil {
+		return nil, err
+	}
+	if err := p.parseSelectClauses(st); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// WHERE, GROUP BY, HAVING, ORDER BY, LIMIT после FROM и JOIN
+func (p *parser) parseSelectClauses(st *selectStmt) (err error) {
+	if p.acceptKeyword("where") {
+		if st.where, err = p.parseExpr(); err != nil {
+			return err
+		}
+	}
+	if st.groupBy, err = p.parseGroupBy(); err != nil {
+		return err
+	}
+	if p.acceptKeyword("having") {
+		if st.having, err = p.parseExpr(); err != nil {
+			return err
+		}
+	}
+	if st.orderBy, err = p.parseOrderBy(); err != nil {
+		return err
+	}
+	st.limit, st.offset, err = p.parseLimit()
+	return err
+}
+
+func (p *parser) parseSelectItems() ([]selectItem, error) {
+	var items []selectItem
+	for {
+		start := p.tok
+		switch {
+		case p.acceptOp("*"):
+			items = append(items, selectItem{star: true})
+		case start.kind == tokWord && strings.HasSuffix(start.text, ".") && len(start.text) > 1:
+			// t.* — лексер отдаёт "t." и "*" отдельными токенами
+			p.advance()
+			if err := p.expectOp("*"); err != nil {
+				return nil, err
+			}
+			items = append(items, selectItem{star: true, qual: strings.TrimSuffix(start.text, ".")})
+		default:
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			it := selectItem{expr: e, title: p.sourceText(start.pos, p.prevEnd)}
+			if p.acceptKeyword("as") {
+				if it.title, err = p.name("псевдоним колонки"); err != nil {
+					return nil, err
+				}
+				it.alias = true
+			}
+			items = append(items, it)
+		}
+		if !p.acceptOp(",") {
+			return items, nil
+		}
+	}
+}
+
+func (p *parser) parseTableRef() (tableRef, error) {
+	ref := tableRef{pos: p.tok.pos}
+	name, err := p.name("имя таблицы")
+	if err != nil {
+		return ref, err
+	}
+	ref.name = name
+	if p.acceptKeyword("as") {
+		if ref.alias, err = p.name("псевдоним таблицы"); err != nil {
+			return ref, err
+		}
+	} else if p.tok.kind == tokWord && !isReserved(p.tok) {
+		ref.alias = p.tok.text
+		p.advance()
+	}
+	return ref, nil
+}
+
+func (p *parser) parseOrderBy() ([]orderItem, error) {
+	if !p.acceptKeyword("order") {
+		return nil, nil
+	}
+	if err := p.expectKeyword("by"); err != nil {
+		return nil, err
+	}
+	return p.parseOrderItems()
+}
+
+// выражения ORDER BY через запятую
+func (p *parser) parseOrderItems() ([]orderItem, error) {
+	var items []orderItem
+	for {
+		e, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		it := orderItem{expr: e}
+		if p.acceptKeyword("desc") {
+			it.desc = true
+		} else {
+			p.acceptKeyword("asc")
+		}
+		items = append(items, it)
+		if !p.acceptOp(",") {
+			return items, nil
+		}
+	}
+}
+
+// LIMIT и OFFSET в любом порядке
+func (p *parser) parseLimit() (limit, offset int, err error) {
+	limit = -1
+	for {
+		switch {
+		case p.acceptKeyword("limit"):
+			if limit, err = p.count("LIMIT"); err != nil {
+				return
+			}
+		case p.acceptKeyword("offset"):
+			if offset, err = p.count("OFFSET"); err != nil {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// неотрицательное целое число
+func (p *parser) count(what string) (int, error) {
+	t := p.tok
+	n, err := strconv.Atoi(t.text)
+	if t.kind != tokNumber || err != nil || n < 0 {
+		return 0, p.errorf(t, "%s: ожидалось неотрицательное целое число, найдено %s", what, t)
+	}
+	p.advance()
+	return n, nil
+}
+
+// --- Выполнение ---
+
+// привязать колонки запроса к области видимости;
+// ORDER BY может ссылаться на псевдоним или номер колонки результата
+func (st *selectStmt) bind(scope *columnScope) error {
+	if err := bindExpr(st.where, scope); err != nil {
+		return err
+	}
+	if hasAggregate(st.where) {
+		return errors.New("агрегатные функции в WHERE недопустимы, используйте HAVING")
+	}
+	for _, e := range st.groupBy {
+		if err := bindExpr(e, scope); err != nil {
+			return err
+		}
+	}
+	if err := bindExpr(st.having, scope); err != nil {
+		return err
+	}
+	for _, it := range st.items {
+		if it.star && it.qual != "" && !scopeHasQualifier(scope, it.qual) {
+			return fmt.Errorf("таблица '%s' не найдена в запросе", it.qual)
+		}
+		if err := bindExpr(it.expr, scope); err != nil {
+			return err
+		}
+	}
+	for i := range st.orderBy {
+		e, err := st.outputRef(st.orderBy[i].expr, scope)
+		if err != nil {
+			return err
+		}
+		if e != nil {
+			st.orderBy[i].expr = e
+		}
+		if err := bindExpr(st.orderBy[i].expr, scope); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// выражение колонки результата, на которую ссылается ORDER BY (по псевдониму или номеру)
+func (st *selectStmt) outputRef(e expr, scope *columnScope) (expr, error) {
+	switch e := e.(type) {
+	case *colRef:
+		if _, err := scope.resolve(e.qual, e.name); err == nil {
+			return nil, nil
+		}
+		for _, it := range st.items {
+			if it.alias && strings.EqualFold(it.title, e.raw) {
+				return it.expr, nil
+			}
+		}
+	case *literalExpr:
+		if e.v.kind == valNumber {
+			k := int(e.v.n)
+			if float64(k) != e.v.n {
+				return nil, nil
+			}
+			cols := st.outputExprs(scope)
+			if k < 1 || k > len(cols) {
+				return nil, fmt.Errorf("ORDER BY %d: нет такой колонки", k)
+			}
+			return cols[k-1], nil
+		}
+	}
+	return nil, nil
+}
+
+// выражения колонок результата; * раскрывается в колонки таблиц
+func (st *selectStmt) outputExprs(scope *columnScope) []expr {
+	var out []expr
+	for _, it := range st.items {
+		if !it.star {
+			out = append(out, it.expr)
+			continue
+		}
+		for i, name := range scope.names {
+			if it.qual == "" || strings.EqualFold(scope.quals[i], it.qual) {
+				out = append(out, &colRef{qual: scope.quals[i], name: name, raw: name, scope: scope, idx: i})
+			}
+		}
+	}
+	return out
+}
+
+func scopeHasQualifier(scope *columnScope, qual string) bool {
+	for _, q := range scope.quals {
+		if strings.EqualFold(q, qual) {
+			return true
+		}
+	}
+	return false
+}
+
+// заголовок результата
+func (st *selectStmt) header(scope *columnScope) []string {
+	var out []string
+	for _, it := range st.items {
+		switch {
+		case it.star:
+			for i := range scope.names {
+				if it.qual == "" || strings.EqualFold(scope.quals[i], it.qual) {
+					out = append(out, scope.title(i))
+				}
+			}
+		case it.alias:
+			out = append(out, it.title)
+		default:
+			if c, ok := it.expr.(*colRef); ok && c.scope == scope {
+				out = append(out, scope.title(c.idx))
+			} else {
+				out = append(out, it.title)
+			}
+		}
+	}
+	return out
+}
+
+// строка результата; колонки выводятся как есть, выражения — вычисленными
+func (st *selectStmt) project(env *rowEnv) ([]string, error) {
+	var out []string
+	for _, it := range st.items {
+		switch {
+		case it.star:
+			for i := range env.scope.names {
+				if it.qual == "" || strings.EqualFold(env.scope.quals[i], it.qual) {
+					out = append(out, cellAt(env.row, i))
+				}
+			}
+		default:
+			if c, ok := it.expr.(*colRef); ok && c.scope == env.scope {
+				out = append(out, cellAt(env.row, c.idx))
+				continue
+			}
+			v, err := it.expr.eval(env)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v.String())
+		}
+	}
+	return out, nil
+}
+
+func cellAt(row []string, i int) string {
+	if i < len(row) {
+		return row[i]
+	}
+	return ""
+}
+
+// Выполнение SELECT над потоком строк: без ORDER BY строки
+// передаются в emit по мере чтения, иначе — после сортировки.
+func runSelect(st *selectStmt, scope *columnScope, next func() ([]string, error), emit func([]string) error) error {
+	if err := st.bind(scope); err != nil {
+		return err
+	}
+	if st.grouped() {
+		return st.runGrouped(scope, next, emit)
+	}
+	env := &rowEnv{scope: scope}
+	skip, left := st.offset, st.limit
+	out := func(row []string) (bool, error) {
+		if skip > 0 {
+			skip--
+			return true, nil
+		}
+		if left == 0 {
+			return false, nil
+		}
+		env.row = row
+		projected, err := st.project(env)
+		if err != nil {
+			return false, err
+		}
+		if left > 0 {
+			left--
+		}
+		return left != 0, emit(projected)
+	}
+
+	var buffered [][]string
+	for {
+		row, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if st.where != nil {
+			env.row = row
+			v, err := st.where.eval(env)
+			if err != nil {
+				return err
+			}
+			if !v.truthy() {
+				continue
+			}
+		}
+		if len(st.orderBy) > 0 {
+			buffered = append(buffered, row)
+			continue
+		}
+		more, err := out(row)
+		if err != nil || !more {
+			return err
+		}
+	}
+
+	if err := sortRows(buffered, scope, st.orderBy); err != nil {
+		return err
+	}
+	for _, row := range buffered {
+		more, err := out(row)
+		if err != nil || !more {
+			return err
+		}
+	}
+	return nil
+}
+
+// стабильная сортировка по ключам ORDER BY
+func sortRows(rows [][]string, scope *columnScope, order []orderItem) error {
+	env := &rowEnv{scope: scope}
+	idx, err := sortOrder(len(rows), func(i int) *rowEnv {
+		env.row = rows[i]
+		return env
+	}, order)
+	if err != nil || idx == nil {
+		return err
+	}
+	sorted := make([][]string, len(rows))
+	for i, k := range idx {
+		sorted[i] = rows[k]
+	}
+	copy(rows, sorted)
+	return nil
+}
+
+// Перестановка n элементов по ключам ORDER BY; ключи вычисляются
+// один раз. nil — сортировать нечего.
+func sortOrder(n int, envAt func(i int) *rowEnv, order []orderItem) ([]int, error) {
+	if len(order) == 0 || n < 2 {
+		return nil, nil
+	}
+	keys := make([][]value, n)
+	for i := range keys {
+		env := envAt(i)
+		keys[i] = make([]value, len(order))
+		for j, o := range order {
+			v, err := o.expr.eval(env)
+			if err != nil {
+				return nil, err
+			}
+			keys[i][j] = v
+		}
+	}
+	idx := make([]int, n)
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool {
+		ka, kb := keys[idx[a]], keys[idx[b]]
+		for j, o := range order {
+			c := compareOrder(ka[j], kb[j])
+			if c == 0 {
+				continue
+			}
+			if o.desc {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+	return idx, nil
+}
+
+// порядок сортировки: NULL раньше любых значений
+func compareOrder(a, b value) int {
+	switch {
+	case a.isNull() && b.isNull():
+		return 0
+	case a.isNull():
+		return -1
+	case b.isNull():
+		return 1
+	}
+	return compareValues(a, b)
+}
+
+func execSelect(st *selectStmt) (*queryResult, error) {
+	src, err := openSource(st)
+	if err != nil {
+		return nil, err
+	}
+	defer src.close()
+
+	var rows [][]string
+	err = runSelect(st, src.scope, src.next, func(row []string) error {
+		rows = append(rows, row)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	data := append([][]string{st.header(src.scope)}, rows...)
+	msg := fmt.Sprintf("Выбрано строк %d из таблицы %s", len(rows), src.tables[0])
+	if len(src.tables) > 1 {
+		msg = fmt.Sprintf("Выбрано строк %d из таблиц %s", len(rows), strings.Join(src.tables, ", "))
+	}
+	return &queryResult{
+		Table:    src.tables[0],
+		Data:     data,
+		ReadOnly: true,
+		Message:  msg,
+	}, nil
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// --- Интерактивный режим в терминале ---
+//
+// csvdb repl [-dir папка] [-format table|csv|tsv|json]
+//
+// Команды те же, что в поле ввода окна. Команда выполняется по Enter,
+// если она полная или завершена ';'. Незаконченная (открытая кавычка,
+// оборванное выражение) или завершённая '\' продолжается на следующей
+// строке, пустая строка выполняет набранное как есть. ↑/↓ — история
+// (общая с окном), Tab — дополнение, Ctrl+C — сбросить ввод, Ctrl+D
+// или \q — выход. Если stdin не терминал, строки читаются без
+// редактирования, а код выхода — 1, если хотя бы одна команда не
+// выполнилась.
+
+const replHelp = `Команды — как в поле ввода окна: SELECT, FIND, INSERT, UPDATE, ALTER, SOURCE ...
+Команда выполняется по Enter, если она полная; ; завершает команду явно,
+\ в конце строки переносит её на следующую.
+  \q, exit        выход
+  \format <вид>   вывод: table, csv, tsv или json
+  \tables         список таблиц
+  \?              эта справка
+↑/↓ — история, Tab — дополнение, Ctrl+C — сбросить ввод, Ctrl+D — выход.
+`
+
+var errInterrupted = errors.New("ввод прерван")
+
+func runREPL(stdout, stderr io.Writer, opt cliOptions) int {
+	history := loadHistory(historyFile)
+	fd := int(os.Stdin.Fd())
+	interactive := isTerminal(fd)
+	in := bufio.NewReader(os.Stdin)
+	ed := &lineEditor{in: in, out: stdout, history: history}
+
+	read := func(prompt, before string) (string, error) {
+		if interactive {
+			if restore, err := makeRaw(fd); err == nil {
+				defer restore()
+				return ed.readLine(prompt, before)
+			}
+			fmt.Fprint(stdout, prompt)
+		}
+		line, err := in.ReadString('\n')
+		if err == io.EOF && line != "" {
+			err = nil // последняя строка без перевода строки
+		}
+		return strings.TrimRight(line, "\r\n"), err
+	}
+
+	if interactive {
+		fmt.Fprintln(stdout, `csvdb: введите команду, \? — справка, \q — выход`)
+	}
+	format := opt.format
+	code := exitOK
+	var pending []string
+	for {
+		prompt := "csvdb> "
+		before := ""
+		if len(pending) > 0 {
+			prompt = "  ...> "
+			before = strings.Join(pending, "\n") + "\n"
+		}
+		line, err := read(prompt, before)
+		switch {
+		case errors.Is(err, errInterrupted):
+			pending = nil
+			continue
+		case err == io.EOF:
+			if len(pending) > 0 && !replRun(strings.Join(pending, "\n"), format, stdout, stderr) {
+				code = exitFailed
+			}
+			return code
+		case err != nil:
+			fmt.Fprintln(stderr, "csvdb:", err)
+			return exitFailed
+		}
+
+		if len(pending) == 0 {
+			switch cmd := strings.Fields(line); {
+			case len(cmd) == 0:
+				continue
+			case cmd[0] == `\q` || len(cmd) == 1 && (strings.EqualFold(cmd[0], "exit") || strings.EqualFold(cmd[0], "quit")):
+				return code
+			case cmd[0] == `\?` || cmd[0] == `\h` || len(cmd) == 1 && strings.EqualFold(cmd[0], "help"):
+				fmt.Fprint(stdout, replHelp)
+				continue
+			case cmd[0] == `\tables`:
+				for _, t := range tableNames() {
+					fmt.Fprintln(stdout, t)
+				}
+				continue
+			case cmd[0] == `\format`:
+				if len(cmd) == 2 && (cmd[1] == "table" || cmd[1] == "csv" || cmd[1] == "tsv" || cmd[1] == "json") {
+					format = cmd[1]
+				} else {
+					fmt.Fprintln(stderr, `csvdb: \format table|csv|tsv|json`)
+				}
+				continue
+			}
+		}
+
+		cont := strings.HasSuffix(strings.TrimRight(line, " \t"), `\`)
+		if cont {
+			line = strings.TrimSuffix(strings.TrimRight(line, " \t"), `\`)
+		}
+		blank := strings.TrimSpace(line) == ""
+		if !blank {
+			pending = append(pending, line)
+		}
+		text := strings.Join(pending, "\n")
+		if cont || !blank && !statementComplete(text) {
+			continue
+		}
+		pending = nil
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		_ = history.add(text)
+		if !replRun(text, format, stdout, stderr) {
+			code = exitFailed
+		}
+	}
+}
+
+// Команда полная: завершена ';' или разбирается без ошибки; ошибка не
+// в конце текста тоже считается полной командой — её покажет выполнение.
+func statementComplete(text string) bool {
+	toks, ok := lexUntil(text)
+	if !ok {
+		return false // открытая кавычка или комментарий
+	}
+	if len(toks) == 0 {
+		return true
+	}
+	last := toks[len(toks)-1]
+	if last.kind == tokOp && last.text == ";" {
+		return true
+	}
+	_, err := parseQuery(text)
+	var qe *queryError
+	if errors.As(err, &qe) && qe.pos >= last.end {
+		return false
+	}
+	return true
+}
+
+// выполнение введённого текста (одной или нескольких команд через ;)
+func replRun(text, format string, stdout, stderr io.Writer) bool {
+	for _, c := range splitScript(text) {
+		st, err := parseQuery(c.text)
+		if err == nil {
+			var res *queryResult
+			res, err = execCLI(st)
+			var se *scriptError
+			if errors.As(err, &se) {
+				res = se.res
+			}
+			if res != nil {
+				if perr := printResult(stdout, stderr, res, format); perr != nil {
+					err = perr
+				}
+			}
+		}
+		if err != nil {
+			fmt.Fprintln(stderr, "Ошибка:", err)
+			var qe *queryError
+			if errors.As(err, &qe) {
+				fmt.Fprintln(stderr, qe.caret(c.text))
+			}
+			return false
+		}
+	}
+	return true
+}
+
+// --- Редактор строки ---
+
+type lineEditor struct {
+	in      *bufio.Reader
+	out     io.Writer
+	history *cmdHistory
+}
+
+// Строка с редактированием в сыром режиме терминала. before — уже
+// введённые строки команды: по ним дополнение понимает контекст.
+// io.EOF — Ctrl+D на пустой строке, errInterrupted — Ctrl+C.
+func (ed *lineEditor) readLine(prompt, before string) (string, error) {
+	var buf []rune
+	pos := 0
+	redraw := func() {
+		fmt.Fprintf(ed.out, "\r%s%s\x1b[K", prompt, string(buf))
+		if back := len(buf) - pos; back > 0 {
+			fmt.Fprintf(ed.out, "\x1b[%dD", back)
+		}
+	}
+	set := func(s string) {
+		buf = []rune(s)
+		pos = len(buf)
+	}
+	redraw()
+	for {
+		r, _, err := ed.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(ed.out, "\r\n")
+			return string(buf), nil
+		case 3: // Ctrl+C
+			fmt.Fprint(ed.out, "^C\r\n")
+			return "", errInterrupted
+		case 4: // Ctrl+D
+			if len(buf) == 0 {
+				fmt.Fprint(ed.out, "\r\n")
+				return "", io.EOF
+			}
+			if pos < len(buf) {
+				buf = append(buf[:pos], buf[pos+1:]...)
+			}
+		case 127, 8: // Backspace
+			if pos > 0 {
+				buf = append(buf[:pos-1], buf[pos:]...)
+				pos--
+			}
+		case 1: // Ctrl+A
+			pos = 0
+		case 5: // Ctrl+E
+			pos = len(buf)
+		case 11: // Ctrl+K
+			buf = buf[:pos]
+		case 21: // Ctrl+U
+			buf = append([]rune(nil), buf[pos:]...)
+			pos = 0
+		case '\t':
+			buf, pos = ed.complete(before, buf, pos)
+		case 27:
+			switch ed.escape() {
+			case "A":
+				if s, ok := ed.history.prev(string(buf)); ok {
+					set(s)
+				}
+			case "B":
+				if s, ok := ed.history.next(); ok {
+					set(s)
+				}
+			case "C":
+				pos = min(pos+1, len(buf))
+			case "D":
+				pos = max(pos-1, 0)
+			case "H", "1~", "7~":
+				pos = 0
+			case "F", "4~", "8~":
+				pos = len(buf)
+			case "3~":
+				if pos < len(buf) {
+					buf = append(buf[:pos], buf[pos+1:]...)
+				}
+			}
+		default:
+			if r >= ' ' {
+				buf = append(buf[:pos], append([]rune{r}, buf[pos:]...)...)
+				pos++
+			}
+		}
+		redraw()
+	}
+}
+
+// управляющая последовательность после ESC: "A" для ESC [ A, "3~" для ESC [ 3 ~
+func (ed *lineEditor) escape() string {
+	r, _, err := ed.in.ReadRune()
+	if err != nil || r != '[' && r != 'O' {
+		return ""
+	}
+	var seq []rune
+	for {
+		r, _, err := ed.in.ReadRune()
+		if err != nil {
+			return ""
+		}
+		seq = append(seq, r)
+		if r < '0' || r > '9' {
+			return string(seq)
+		}
+	}
+}
+
+// Tab: единственный вариант вставляется, при нескольких дописывается
+// общее начало, а варианты печатаются под строкой
+func (ed *lineEditor) complete(before string, buf []rune, pos int) ([]rune, int) {
+	offset := len([]rune(before))
+	c := complete(before+string(buf), offset+pos)
+	start := c.start - offset
+	if start < 0 || len(c.items) == 0 {
+		return buf, pos
+	}
+	insert := c.items[0]
+	if len(c.items) > 1 {
+		insert = commonPrefix(c.items)
+		if len([]rune(insert)) <= pos-start {
+			fmt.Fprintf(ed.out, "\r\n%s\r\n", strings.Join(c.items, "  "))
+			return buf, pos
+		}
+	}
+	out := append(append(append([]rune(nil), buf[:start]...), []rune(insert)...), buf[pos:]...)
+	return out, start + len([]rune(insert))
+}
+
+func commonPrefix(items []string) string {
+	p := []rune(items[0])
+	for _, it := range items[1:] {
+		rs := []rune(it)
+		n := 0
+		for n < len(p) && n < len(rs) && p[n] == rs[n] {
+			n++
+		}
+		p = p[:n]
+	}
+	return string(p)
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// --- Скрипты ---
+//
+// SOURCE <файл> [CONTINUE]
+//
+// Скрипт .csvql — команды, разделённые ';' (перевод строки команду не
+// завершает), с комментариями -- и /* */. Команды выполняются по порядку
+// тем же разбором, что и командная строка. По умолчанию выполнение
+// останавливается на первой ошибке, с CONTINUE — продолжается. Результат
+// — журнал: строка скрипта, команда и итог каждой команды. Путь с / или
+// пробелами берите в кавычки; расширение .csvql можно не указывать.
+
+const (
+	scriptExt      = ".csvql"
+	maxScriptDepth = 8
+)
+
+type sourceStmt struct {
+	file  string
+	cont  bool // CONTINUE: не останавливаться на ошибках
+	depth int  // вложенность SOURCE внутри скриптов
+}
+
+func (*sourceStmt) statementNode() {}
+
+// команда скрипта
+type scriptCmd struct {
+	line int // строка начала (с 1)
+	pos  int // позиция начала в тексте скрипта (в рунах)
+	text string
+}
+
+type scriptStep struct {
+	line    int
+	text    string
+	message string
+	err     error
+}
+
+// Выполнение скрипта остановлено на ошибке. Журнал выполненного до
+// ошибки доступен в res. Ошибка команды не разворачивается: повтор
+// после, например, ввода пароля выполнил бы скрипт сначала.
+type scriptError struct {
+	file string
+	line int
+	err  error
+	res  *queryResult
+}
+
+func (e *scriptError) Error() string {
+	return fmt.Sprintf("скрипт %s, строка %d: %v", e.file, e.line, e.err)
+}
+
+// SOURCE уже прочитан
+func (p *parser) parseSource() (*sourceStmt, error) {
+	if p.atEOF() {
+		return nil, p.errorf(p.tok, "не указан файл скрипта")
+	}
+	file, err := p.name("файл скрипта")
+	if err != nil {
+		return nil, err
+	}
+	return &sourceStmt{file: file, cont: p.acceptKeyword("continue")}, nil
+}
+
+func scriptFile(name string) string {
+	if filepath.Ext(name) == "" {
+		if _, err := os.Stat(name); err != nil {
+			return name + scriptExt
+		}
+	}
+	return name
+}
+
+// Разбиение текста скрипта на команды. После ошибки лексера
+// (незакрытая кавычка или комментарий, неизвестный символ) разбор
+// продолжается со следующей ';': текст до неё становится командой,
+// и её выполнение сообщит ту же ошибку.
+func splitScript(src string) []scriptCmd {
+	rs := []rune(src)
+	lx := newLexer(src)
+	var out []scriptCmd
+	start, end := -1, -1
+	flush := func() {
+		if start >= 0 {
+			out = append(out, scriptCmd{line: lineOf(rs, start), pos: start, text: string(rs[start:end])})
+		}
+		start = -1
+	}
+	for {
+		t, err := lx.next()
+		if err != nil {
+			var qe *queryError
+			if !errors.As(err, &qe) {
+				qe = &queryError{pos: lx.pos}
+			}
+			if start < 0 {
+				start = qe.pos
+			}
+			end = len(rs)
+			for i := qe.pos; i < len(rs); i++ {
+				if rs[i] == ';' {
+					end = i
+					break
+				}
+			}
+			flush()
+			lx.pos = min(end+1, len(rs))
+			continue
+		}
+		if t.kind == tokEOF {
+			flush()
+			return out
+		}
+		if t.kind == tokOp && t.text == ";" {
+			flush()
+			continue
+		}
+		if start < 0 {
+			start = t.pos
+		}
+		end = t.end
+	}
+}
+
+func lineOf(rs []rune, pos int) int {
+	line := 1
+	for _, r := range rs[:min(pos, len(rs))] {
+		if r == '\n' {
+			line++
+		}
+	}
+	return line
+}
+
+func execSource(st *sourceStmt) (*queryResult, error) {
+	if st.depth >= maxScriptDepth {
+		return nil, fmt.Errorf("вложенность SOURCE больше %d: скрипт вызывает сам себя?", maxScriptDepth)
+	}
+	fileName := scriptFile(st.file)
+	src, err := os.ReadFile(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("скрипт '%s' не найден", st.file)
+	}
+	if err != nil {
+		return nil, err
+	}
+	rs := []rune(string(src))
+	cmds := splitScript(string(src))
+
+	var steps []scriptStep
+	var failed *scriptStep
+	affected, errCount := 0, 0
+	for _, c := range cmds {
+		step := scriptStep{line: c.line, text: c.text}
+		res, err := runScriptCmd(c, st.depth)
+		if err != nil {
+			step.err = scriptCmdError(rs, c, err, &step.line)
+			errCount++
+		} else {
+			step.message = res.Message
+			affected += res.Affected
+		}
+		steps = append(steps, step)
+		if err != nil && !st.cont {
+			failed = &steps[len(steps)-1]
+			break
+		}
+	}
+
+	res := &queryResult{
+		Data:     scriptLog(steps),
+		ReadOnly: true,
+		Affected: affected,
+		Message:  fmt.Sprintf("Скрипт %s: выполнено команд %d из %d, ошибок %d", fileName, len(steps)-errCount, len(cmds), errCount),
+	}
+	if failed != nil {
+		res.Message += fmt.Sprintf(", остановлен на строке %d", failed.line)
+		return nil, &scriptError{file: fileName, line: failed.line, err: failed.err, res: res}
+	}
+	return res, nil
+}
+
+func runScriptCmd(c scriptCmd, depth int) (*queryResult, error) {
+	st, err := parseQuery(c.text)
+	if err != nil {
+		return nil, err
+	}
+	if src, ok := st.(*sourceStmt); ok {
+		src.depth = depth + 1
+	}
+	return execStatement(st)
+}
+
+// ошибка команды с позицией, пересчитанной в строку скрипта
+func scriptCmdError(rs []rune, c scriptCmd, err error, line *int) error {
+	var qe *queryError
+	if errors.As(err, &qe) {
+		*line = lineOf(rs, c.pos+qe.pos)
+		return errors.New(qe.msg)
+	}
+	var se *scriptError
+	if errors.As(err, &se) {
+		// вложенный скрипт сообщает свой файл и строку; цепочка
+		// SOURCE видна по журналам, в сообщении — только исходная ошибка
+		for {
+			inner, ok := se.err.(*scriptError)
+			if !ok {
+				return se
+			}
+			se = inner
+		}
+	}
+	return err
+}
+
+// журнал выполнения: по строке на команду
+func scriptLog(steps []scriptStep) [][]string {
+	data := [][]string{{"№", "строка", "команда", "результат"}}
+	for i, s := range steps {
+		result := s.message
+		if s.err != nil {
+			result = "Ошибка: " + s.err.Error()
+		}
+		text := strings.Join(strings.Fields(s.text), " ")
+		data = append(data, []string{strconv.Itoa(i + 1), strconv.Itoa(s.line), text, result})
+	}
+	return data
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+	"unicode"
+)
+
+// --- Глобальный поиск ---
+//
+// Подстрока ищется во всех таблицах папки без учёта регистра, в
+// нечётком режиме — похожие значения (см. fuzzy.go). Таблицы читаются
+// параллельно пулом обработчиков, совпадения отдаются по мере
+// нахождения. Колонка id не просматривается; зашифрованные таблицы
+// без ключа и повреждённые файлы пропускаются с пометкой.
+
+const (
+	snippetRadius = 24  // символов контекста вокруг совпадения
+	searchLimit   = 500 // совпадений в панели результатов
+)
+
+type searchHit struct {
+	Table  string
+	Row    int // номер строки в таблице, 1 — первая запись
+	Col    int
+	ID     string
+	Column string
+	Score  float64 // сходство: 1 — точное вхождение
+	// фрагмент значения: совпадение и контекст вокруг него
+	Before, Match, After string
+}
+
+func (h searchHit) String() string {
+	return fmt.Sprintf("%s, id %s, %s: %s%s%s", h.Table, h.ID, h.Column, h.Before, h.Match, h.After)
+}
+
+// сравнение значения ячейки с запросом
+type cellMatcher func(cell string) (searchHit, bool)
+
+func newCellMatcher(text string, fuzzy bool) cellMatcher {
+	if fuzzy {
+		f := newFuzzyQuery(text, currentFuzzy())
+		return func(cell string) (searchHit, bool) {
+			score, at, end := f.match(cell)
+			if score < f.opt.threshold {
+				return searchHit{}, false
+			}
+			h := snippet([]rune(cell), at, end)
+			h.Score = score
+			return h, true
+		}
+	}
+	needle := foldRunes([]rune(text))
+	return func(cell string) (searchHit, bool) {
+		rs := []rune(cell)
+		at := runeIndex(foldRunes(rs), needle)
+		if at < 0 {
+			return searchHit{}, false
+		}
+		h := snippet(rs, at, at+len(needle))
+		h.Score = 1
+		return h, true
+	}
+}
+
+// Поиск в таблицах; emit вызывается из одной горутины. При limit > 0
+// поиск останавливается после limit совпадений (truncated = true).
+func searchTables(ctx context.Context, tables []string, match cellMatcher, limit int, emit func(searchHit)) (truncated bool, skipped []error) {
+	if len(tables) == 0 {
+		return false, nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	workers := runtime.NumCPU()
+	if workers > len(tables) {
+		workers = len(tables)
+	}
+	jobs := make(chan string)
+	out := make(chan searchHit, 64)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range jobs {
+				if err := searchTable(ctx, t, match, out); err != nil && ctx.Err() == nil {
+					mu.Lock()
+					skipped = append(skipped, fmt.Errorf("%s: %w", t, err))
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for _, t := range tables {
+			select {
+			case jobs <- t:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	n := 0
+	for h := range out {
+		if limit > 0 && n >= limit {
+			// лимит исчерпан: останавливаем обработчики и дочитываем канал
+			truncated = true
+			cancel()
+			continue
+		}
+		emit(h)
+		n++
+	}
+	return truncated, skipped
+}
+
+func searchTable(ctx context.Context, table string, match cellMatcher, out chan<- searchHit) error {
+	sc, err := openTableScanner(table)
+	if err != nil {
+		return err
+	}
+	defer sc.Close()
+	for r := 1; ; r++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		row, err := sc.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for c := 1; c < len(row); c++ {
+			h, ok := match(row[c])
+			if !ok {
+				continue
+			}
+			h.Table, h.Row, h.Col, h.ID = table, r, c, row[0]
+			if c < len(sc.header) {
+				h.Column = sc.header[c]
+			}
+			select {
+			case out <- h:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// совпадение rs[at:end] с контекстом вокруг
+func snippet(rs []rune, at, end int) searchHit {
+	from, to := max(0, at-snippetRadius), min(len(rs), end+snippetRadius)
+	h := searchHit{Before: string(rs[from:at]), Match: string(rs[at:end]), After: string(rs[end:to])}
+	if from > 0 {
+		h.Before = "…" + h.Before
+	}
+	if to < len(rs) {
+		h.After += "…"
+	}
+	return h
+}
+
+// нижний регистр по символам: позиции совпадают с исходной строкой
+func foldRunes(rs []rune) []rune {
+	out := make([]rune, len(rs))
+	for i, r := range rs {
+		out[i] = unicode.ToLower(r)
+	}
+	return out
+}
+
+func runeIndex(s, sub []rune) int {
+	for i := 0; i+len(sub) <= len(s); i++ {
+		j := 0
+		for j < len(sub) && s[i+j] == sub[j] {
+			j++
+		}
+		if j == len(sub) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,488 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- HTTP API ---
+//
+// csvdb serve [-dir папка] [-addr 127.0.0.1:8484] [-token токен]
+// или меню «База данных → HTTP API…» в окне.
+//
+// GET    /api/tables                      таблицы и их колонки
+// GET    /api/tables/{table}              схема: колонки, типы, вычисляемые, число строк
+// GET    /api/tables/{table}/rows         строки: ?where=<условие>&order=<col [desc]>&limit=&offset=
+// GET    /api/tables/{table}/rows/{id}    одна строка
+// POST   /api/tables/{table}/rows         добавить: {"колонка": значение, ...} → строка с id
+// PATCH  /api/tables/{table}/rows/{id}    изменить указанные колонки (PUT — так же)
+// DELETE /api/tables/{table}/rows/{id}    удалить
+//
+// Каждый запрос несёт заголовок Authorization: Bearer <токен>. Токен
+// берётся из -token, CSVDB_TOKEN или создаётся при запуске и печатается.
+// Строки — объекты с ключами в порядке колонок, значения — строки, как
+// в CSV. Записи идут через те же INSERT, UPDATE и DELETE, что и команды:
+// типы, вычисляемые колонки, шифрование и контрольные суммы работают
+// так же. Ошибки — {"error": "..."} с кодом 400, 401, 404, 423
+// (таблица зашифрована) или 500.
+
+const (
+	apiAddr         = "127.0.0.1:8484"
+	tokenEnv        = "CSVDB_TOKEN"
+	apiDefaultLimit = 100
+	apiMaxLimit     = 1000
+	apiMaxBody      = 1 << 20
+)
+
+type apiServer struct {
+	token string
+	// выполнение операции с таблицами: в окне — в потоке интерфейса,
+	// чтобы запросы не пересекались с правками пользователя
+	run func(fn func())
+	// таблица изменена через API
+	onChange func(fileName string)
+}
+
+func newAPIServer(token string) *apiServer {
+	var mu sync.Mutex
+	return &apiServer{
+		token: token,
+		run: func(fn func()) {
+			mu.Lock()
+			defer mu.Unlock()
+			fn()
+		},
+		onChange: func(string) {},
+	}
+}
+
+func newAPIToken() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (s *apiServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/tables", s.listTables)
+	mux.HandleFunc("GET /api/tables/{table}", s.schema)
+	mux.HandleFunc("GET /api/tables/{table}/rows", s.rows)
+	mux.HandleFunc("GET /api/tables/{table}/rows/{id}", s.row)
+	mux.HandleFunc("POST /api/tables/{table}/rows", s.insert)
+	mux.HandleFunc("PATCH /api/tables/{table}/rows/{id}", s.update)
+	mux.HandleFunc("PUT /api/tables/{table}/rows/{id}", s.update)
+	mux.HandleFunc("DELETE /api/tables/{table}/rows/{id}", s.delete)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(auth), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="csvdb"`)
+			apiFail(w, http.StatusUnauthorized, errors.New("нужен заголовок Authorization: Bearer <токен>"))
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// Запуск в фоне; адрес — фактический (для порта 0). Остановка —
+// Shutdown у возвращённого сервера.
+func (s *apiServer) start(addr string) (*http.Server, string, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, "", err
+	}
+	srv := &http.Server{Handler: s.handler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() { _ = srv.Serve(ln) }()
+	return srv, ln.Addr().String(), nil
+}
+
+// csvdb serve: до Ctrl+C
+func runServeCLI(stdout, stderr io.Writer, opt cliOptions) int {
+	token := opt.token
+	if token == "" {
+		token = os.Getenv(tokenEnv)
+	}
+	generated := token == ""
+	if generated {
+		token = newAPIToken()
+	}
+	srv, addr, err := newAPIServer(token).start(opt.addr)
+	if err != nil {
+		fmt.Fprintln(stderr, "csvdb:", err)
+		return exitFailed
+	}
+	fmt.Fprintf(stdout, "HTTP API: http://%s/api/tables\n", addr)
+	if generated {
+		fmt.Fprintf(stdout, "Токен: %s\n", token)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	<-ctx.Done()
+	shut, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = srv.Shutdown(shut)
+	return exitOK
+}
+
+// --- Обработчики ---
+
+func (s *apiServer) listTables(w http.ResponseWriter, r *http.Request) {
+	type tableInfo struct {
+		Name    string   `json:"name"`
+		Columns []string `json:"columns"`
+		Locked  bool     `json:"locked,omitempty"`
+	}
+	out := []tableInfo{}
+	s.run(func() {
+		for _, f := range listTables(".") {
+			ti := tableInfo{Name: strings.TrimSuffix(f, ".csv"), Columns: []string{}}
+			cols, err := tableColumns(f)
+			if errors.Is(err, errTableLocked) {
+				ti.Locked = true
+			} else if err == nil {
+				ti.Columns = cols
+			}
+			out = append(out, ti)
+		}
+	})
+	apiJSON(w, http.StatusOK, out)
+}
+
+func (s *apiServer) schema(w http.ResponseWriter, r *http.Request) {
+	type column struct {
+		Name     string `json:"name"`
+		Type     string `json:"type,omitempty"`
+		Computed string `json:"computed,omitempty"`
+	}
+	table, ok := apiTable(w, r)
+	if !ok {
+		return
+	}
+	var res *queryResult
+	var err error
+	var meta tableMeta
+	fileName := tableFile(table)
+	s.run(func() {
+		if res, err = apiSelect(table, nil, nil); err == nil {
+			meta, err = getTableMeta(fileName)
+		}
+	})
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	cols := []column{}
+	for _, h := range res.Data[0] {
+		c := column{Name: h, Type: meta.Types[h]}
+		if i := computedIndex(meta.Computed, h); i >= 0 {
+			c.Computed = meta.Computed[i].Expr
+		}
+		cols = append(cols, c)
+	}
+	apiJSON(w, http.StatusOK, map[string]any{
+		"name":    strings.TrimSuffix(fileName, ".csv"),
+		"columns": cols,
+		"rows":    len(res.Data) - 1,
+	})
+}
+
+func (s *apiServer) rows(w http.ResponseWriter, r *http.Request) {
+	table, ok := apiTable(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	limit, offset := apiDefaultLimit, 0
+	var err error
+	if v := q.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 0 {
+			apiFail(w, http.StatusBadRequest, fmt.Errorf("limit: ожидалось неотрицательное целое, получено '%s'", v))
+			return
+		}
+		limit = min(limit, apiMaxLimit)
+	}
+	if v := q.Get("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			apiFail(w, http.StatusBadRequest, fmt.Errorf("offset: ожидалось неотрицательное целое, получено '%s'", v))
+			return
+		}
+	}
+	where, err := apiParse(q.Get("where"), "where", (*parser).parseExpr)
+	if err != nil {
+		apiFail(w, http.StatusBadRequest, err)
+		return
+	}
+	order, err := apiParse(q.Get("order"), "order", (*parser).parseOrderItems)
+	if err != nil {
+		apiFail(w, http.StatusBadRequest, err)
+		return
+	}
+	var res *queryResult
+	s.run(func() { res, err = apiSelect(table, where, order) })
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	total := len(res.Data) - 1
+	from := min(offset, total)
+	to := min(from+limit, total)
+	apiJSON(w, http.StatusOK, map[string]any{
+		"columns": res.Data[0],
+		"rows":    apiRows(res.Data[0], res.Data[1+from:1+to]),
+		"total":   total,
+		"offset":  offset,
+		"limit":   limit,
+	})
+}
+
+func (s *apiServer) row(w http.ResponseWriter, r *http.Request) {
+	table, ok := apiTable(w, r)
+	if !ok {
+		return
+	}
+	var res *queryResult
+	var err error
+	s.run(func() { res, err = apiSelect(table, idEquals(r.PathValue("id")), nil) })
+	s.respondRow(w, http.StatusOK, r.PathValue("id"), res, err)
+}
+
+func (s *apiServer) insert(w http.ResponseWriter, r *http.Request) {
+	table, ok := apiTable(w, r)
+	if !ok {
+		return
+	}
+	values, err := apiBody(r)
+	if err != nil {
+		apiFail(w, http.StatusBadRequest, err)
+		return
+	}
+	fileName := tableFile(table)
+	st := &insertStmt{table: table, rows: [][]expr{nil}}
+	for _, col := range sortedKeys(values) {
+		st.columns = append(st.columns, col)
+		st.colPos = append(st.colPos, -1)
+		st.rows[0] = append(st.rows[0], &literalExpr{v: textValue(values[col])})
+	}
+	var res *queryResult
+	var id string
+	s.run(func() {
+		var next int
+		if next, err = getNextID(fileName); err != nil {
+			return
+		}
+		if len(st.columns) == 0 {
+			// пустой объект: строка из одних пустых значений
+			var header []string
+			if header, err = readHeader(fileName); err != nil {
+				return
+			}
+			st.rows[0] = make([]expr, len(header)-1)
+			for i := range st.rows[0] {
+				st.rows[0][i] = &literalExpr{v: textValue("")}
+			}
+		}
+		if _, err = execStatement(st); err != nil {
+			return
+		}
+		s.onChange(fileName)
+		id = strconv.Itoa(next)
+		res, err = apiSelect(table, idEquals(id), nil)
+	})
+	s.respondRow(w, http.StatusCreated, id, res, err)
+}
+
+func (s *apiServer) update(w http.ResponseWriter, r *http.Request) {
+	table, ok := apiTable(w, r)
+	if !ok {
+		return
+	}
+	values, err := apiBody(r)
+	if err != nil {
+		apiFail(w, http.StatusBadRequest, err)
+		return
+	}
+	id := r.PathValue("id")
+	st := &updateStmt{table: table, where: idEquals(id)}
+	for _, col := range sortedKeys(values) {
+		st.sets = append(st.sets, setClause{column: col, pos: -1, expr: &literalExpr{v: textValue(values[col])}})
+	}
+	var res *queryResult
+	s.run(func() {
+		if len(st.sets) > 0 {
+			var upd *queryResult
+			if upd, err = execStatement(st); err != nil {
+				return
+			}
+			if upd.Affected > 0 {
+				s.onChange(tableFile(table))
+			}
+		}
+		res, err = apiSelect(table, idEquals(id), nil)
+	})
+	s.respondRow(w, http.StatusOK, id, res, err)
+}
+
+func (s *apiServer) delete(w http.ResponseWriter, r *http.Request) {
+	table, ok := apiTable(w, r)
+	if !ok {
+		return
+	}
+	id := r.PathValue("id")
+	var res *queryResult
+	var err error
+	s.run(func() {
+		if res, err = execStatement(&deleteStmt{table: table, where: idEquals(id)}); err == nil && res.Affected > 0 {
+			s.onChange(tableFile(table))
+		}
+	})
+	switch {
+	case err != nil:
+		apiError(w, err)
+	case res.Affected == 0:
+		apiFail(w, http.StatusNotFound, fmt.Errorf("запись с id=%s не найдена", id))
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *apiServer) respondRow(w http.ResponseWriter, code int, id string, res *queryResult, err error) {
+	switch {
+	case err != nil:
+		apiError(w, err)
+	case len(res.Data) < 2:
+		apiFail(w, http.StatusNotFound, fmt.Errorf("запись с id=%s не найдена", id))
+	default:
+		apiJSON(w, code, apiRows(res.Data[0], res.Data[1:2])[0])
+	}
+}
+
+// --- Вспомогательное ---
+
+// Таблица из пути; нет такой — 404. Имя сверяется со списком таблиц
+// папки: значение пути раскодировано, и ..%2F вывело бы за её пределы.
+func apiTable(w http.ResponseWriter, r *http.Request) (string, bool) {
+	table := r.PathValue("table")
+	if !slices.Contains(listTables("."), tableFile(table)) {
+		apiFail(w, http.StatusNotFound, fmt.Errorf("таблица '%s' не найдена", table))
+		return "", false
+	}
+	return table, true
+}
+
+// SELECT * с вычисляемыми колонками, условием и порядком
+func apiSelect(table string, where expr, order []orderItem) (*queryResult, error) {
+	st := &selectStmt{
+		items:   []selectItem{{star: true}},
+		from:    tableRef{name: table},
+		where:   where,
+		orderBy: order,
+		limit:   -1,
+	}
+	return execSelect(st)
+}
+
+// разбор параметра запроса; пустой — нулевое значение
+func apiParse[T any](src, param string, parse func(p *parser) (T, error)) (T, error) {
+	var zero T
+	if strings.TrimSpace(src) == "" {
+		return zero, nil
+	}
+	p := newParser(src)
+	v, err := parse(p)
+	if err == nil {
+		err = p.expectEnd()
+	}
+	if err != nil {
+		return zero, fmt.Errorf("%s: %w", param, err)
+	}
+	return v, nil
+}
+
+// тело запроса: объект колонка → значение; числа, логические и null
+// записываются как текст
+func apiBody(r *http.Request) (map[string]string, error) {
+	dec := json.NewDecoder(io.LimitReader(r.Body, apiMaxBody))
+	dec.UseNumber()
+	var raw map[string]any
+	if err := dec.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("ожидался JSON-объект {\"колонка\": значение}: %v", err)
+	}
+	out := make(map[string]string, len(raw))
+	for k, v := range raw {
+		switch v := v.(type) {
+		case nil:
+			out[k] = ""
+		case string:
+			out[k] = v
+		case json.Number:
+			out[k] = v.String()
+		case bool:
+			out[k] = strconv.FormatBool(v)
+		default:
+			return nil, fmt.Errorf("колонка '%s': ожидалось строка, число, логическое или null", k)
+		}
+	}
+	return out, nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func apiRows(cols []string, data [][]string) []jsonRow {
+	out := make([]jsonRow, len(data))
+	for i, row := range data {
+		out[i] = jsonRow{cols: cols, cells: row}
+	}
+	return out
+}
+
+func apiJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(v)
+}
+
+func apiFail(w http.ResponseWriter, code int, err error) {
+	apiJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+// Код ответа по ошибке команды: сбой файловой системы — 500, иначе
+// ошибка в данных запроса (колонка, тип значения, выражение) — 400
+func apiError(w http.ResponseWriter, err error) {
+	var pe *fs.PathError
+	var qe *queryError
+	code := http.StatusBadRequest
+	switch {
+	case errors.Is(err, errTableLocked):
+		code = http.StatusLocked
+	case errors.As(err, &pe):
+		code = http.StatusInternalServerError
+	case errors.As(err, &qe) && qe.pos < 0:
+		err = errors.New(qe.msg) // колонка из тела запроса, позиции в тексте нет
+	}
+	apiFail(w, code, err)
+}
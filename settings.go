@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// --- Настройки сеанса ---
+//
+// SET                  — показать текущие значения
+// SET FUZZY <0..1>     — порог сходства для нечёткого поиска (FIND ... % и глобальный поиск)
+// SET TRANSLIT ON|OFF  — сравнивать кириллицу и латиницу в транслитерации
+
+type setStmt struct {
+	name  string // пусто — показать все настройки
+	value string
+}
+
+func (*setStmt) statementNode() {}
+
+var settings = struct {
+	sync.Mutex
+	fuzzy fuzzyOptions
+}{fuzzy: fuzzyOptions{threshold: 0.7}}
+
+func currentFuzzy() fuzzyOptions {
+	settings.Lock()
+	defer settings.Unlock()
+	return settings.fuzzy
+}
+
+func setTranslit(on bool) {
+	settings.Lock()
+	defer settings.Unlock()
+	settings.fuzzy.translit = on
+}
+
+func (p *parser) parseSet() (*setStmt, error) {
+	st := &setStmt{}
+	if p.atEOF() {
+		return st, nil
+	}
+	name, err := p.name("имя настройки")
+	if err != nil {
+		return nil, err
+	}
+	st.name = strings.ToLower(name)
+	p.acceptOp("=")
+	if p.atEOF() {
+		return nil, p.errorf(p.tok, "укажите значение настройки %s", name)
+	}
+	st.value = p.tok.text
+	p.advance()
+	return st, nil
+}
+
+func execSet(st *setStmt) (*queryResult, error) {
+	switch st.name {
+	case "":
+	case "fuzzy":
+		n, err := parseNumber(st.value)
+		if err != nil || n <= 0 || n > 1 {
+			return nil, fmt.Errorf("порог FUZZY должен быть числом от 0 до 1, получено '%s'", st.value)
+		}
+		settings.Lock()
+		settings.fuzzy.threshold = n
+		settings.Unlock()
+	case "translit":
+		on, err := parseSwitch(st.value)
+		if err != nil {
+			return nil, err
+		}
+		setTranslit(on)
+	default:
+		return nil, fmt.Errorf("неизвестная настройка '%s'; доступны FUZZY и TRANSLIT", st.name)
+	}
+	return &queryResult{Message: settingsSummary()}, nil
+}
+
+func parseSwitch(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "on", "вкл":
+		return true, nil
+	case "off", "выкл":
+		return false, nil
+	}
+	return parseBool(s)
+}
+
+func settingsSummary() string {
+	f := currentFuzzy()
+	tr := "OFF"
+	if f.translit {
+		tr = "ON"
+	}
+	return fmt.Sprintf("Настройки: FUZZY %g, TRANSLIT %s", f.threshold, tr)
+}
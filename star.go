@@ -0,0 +1,633 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// --- Сценарии Starlark ---
+//
+// SCRIPT '<код>'
+// SCRIPT FILE <файл[.star]>
+//
+// Разовые правки данных без пересборки: код на Starlark (диалект Python)
+// обходит строки, меняет значения и создаёт таблицы. Сценарию доступны
+// только таблицы текущей папки через функции ниже — ни файлов, ни сети,
+// ни load. Строка таблицы — словарь {"id": ..., колонка: значение},
+// значения — строки; записать можно строку, число, bool или None.
+//
+//	tables()                     имена таблиц
+//	columns(t)                   колонки без id
+//	rows(t)                      список строк
+//	transform(t, fn)             fn(row) меняет row или возвращает новую
+//	                             строку, False — удалить строку; таблица
+//	                             записывается один раз, число изменённых
+//	insert(t, row или кол=...)   добавить строку, вернуть id
+//	update(t, id, кол=...)       изменить строку по id
+//	delete(t, id)                удалить строку по id
+//	create_table(t, ["a", "b:int"]), drop_table(t)
+//	query("select ...")          SELECT, FIND, INSERT, UPDATE или DELETE:
+//	                             строки или сообщение
+//	num("3,14")                  число с учётом десятичной запятой
+//	print(...), fail(...)        вывод и остановка с ошибкой
+//
+// Типы колонок проверяются при каждой записи, хуки изменений срабатывают.
+// Транзакций нет: при ошибке записанное до неё остаётся.
+// Число шагов ограничено, чтобы бесконечный цикл не повесил программу.
+
+const (
+	starExt      = ".star"
+	starMaxSteps = 100_000_000
+)
+
+type starStmt struct {
+	code string // текст сценария или пусто, если задан file
+	file string
+}
+
+func (*starStmt) statementNode() {}
+
+// SCRIPT уже прочитан
+func (p *parser) parseStar() (*starStmt, error) {
+	if p.acceptKeyword("file") {
+		if p.atEOF() {
+			return nil, p.errorf(p.tok, "не указан файл сценария")
+		}
+		file, err := p.name("файл сценария")
+		if err != nil {
+			return nil, err
+		}
+		return &starStmt{file: file}, nil
+	}
+	if p.tok.kind != tokString {
+		return nil, p.errorf(p.tok, "ожидался код сценария в кавычках или FILE <файл>, найдено %s", p.tok)
+	}
+	st := &starStmt{code: p.tok.text}
+	p.advance()
+	return st, nil
+}
+
+func starFile(name string) string {
+	if filepath.Ext(name) == "" {
+		if _, err := os.Stat(name); err != nil {
+			return name + starExt
+		}
+	}
+	return name
+}
+
+func execStar(st *starStmt) (*queryResult, error) {
+	name, src := "сценарий", st.code
+	if st.file != "" {
+		name = starFile(st.file)
+		raw, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		src = string(raw)
+	}
+	var out []string
+	env := &starEnv{print: func(s string) { out = append(out, s) }}
+	if err := env.exec(name, src); err != nil {
+		return nil, err
+	}
+	res := &queryResult{
+		ReadOnly: true,
+		Affected: env.affected,
+		Message:  fmt.Sprintf("Сценарий выполнен: изменено строк %d", env.affected),
+	}
+	if len(out) > 0 {
+		res.Data = [][]string{{"вывод"}}
+		for _, s := range out {
+			res.Data = append(res.Data, []string{s})
+		}
+	}
+	return res, nil
+}
+
+// Окружение выполнения. run выполняет обращения к хранилищу (в окне —
+// в потоке интерфейса, как HTTP API); nil — в текущем потоке. Сам
+// код и функции transform выполняются вне run, чтобы окно не замирало.
+type starEnv struct {
+	run      func(func())
+	print    func(string)
+	stop     <-chan struct{} // закрытие прерывает сценарий
+	affected int
+}
+
+func (e *starEnv) storage(fn func() error) error {
+	if e.run == nil {
+		return fn()
+	}
+	var err error
+	e.run(func() { err = fn() })
+	return err
+}
+
+func (e *starEnv) exec(name, src string) error {
+	thread := &starlark.Thread{
+		Name:  name,
+		Print: func(_ *starlark.Thread, msg string) { e.print(msg) },
+		Load: func(*starlark.Thread, string) (starlark.StringDict, error) {
+			return nil, errors.New("load в сценариях недоступен")
+		},
+	}
+	thread.SetMaxExecutionSteps(starMaxSteps)
+	if e.stop != nil {
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			select {
+			case <-e.stop:
+				thread.Cancel("остановлено")
+			case <-done:
+			}
+		}()
+	}
+	opts := &syntax.FileOptions{Set: true, While: true, TopLevelControl: true, GlobalReassign: true}
+	_, err := starlark.ExecFileOptions(opts, thread, name, src, e.builtins())
+	var ee *starlark.EvalError
+	if errors.As(err, &ee) {
+		for i := len(ee.CallStack) - 1; i >= 0; i-- {
+			if pos := ee.CallStack[i].Pos; pos.Line > 0 {
+				return fmt.Errorf("%s, строка %d: %s", name, pos.Line, ee.Msg)
+			}
+		}
+		return fmt.Errorf("%s: %s", name, ee.Msg)
+	}
+	var se syntax.Error
+	if errors.As(err, &se) {
+		return fmt.Errorf("%s, строка %d: %s", name, se.Pos.Line, se.Msg)
+	}
+	return err
+}
+
+func (e *starEnv) builtins() starlark.StringDict {
+	fns := map[string]func(*starlark.Thread, *starlark.Builtin, starlark.Tuple, []starlark.Tuple) (starlark.Value, error){
+		"tables":       e.tables,
+		"columns":      e.columns,
+		"rows":         e.rows,
+		"transform":    e.transform,
+		"insert":       e.insert,
+		"update":       e.update,
+		"delete":       e.delete,
+		"create_table": e.createTable,
+		"drop_table":   e.dropTable,
+		"query":        e.query,
+		"num":          starNum,
+	}
+	out := starlark.StringDict{}
+	for name, fn := range fns {
+		out[name] = starlark.NewBuiltin(name, fn)
+	}
+	return out
+}
+
+// --- Функции сценария ---
+
+func (e *starEnv) tables(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 0); err != nil {
+		return nil, err
+	}
+	var names []starlark.Value
+	err := e.storage(func() error {
+		for _, t := range tableNames() {
+			names = append(names, starlark.String(t))
+		}
+		return nil
+	})
+	return starlark.NewList(names), err
+}
+
+func (e *starEnv) columns(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var table string
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &table); err != nil {
+		return nil, err
+	}
+	var header []string
+	err := e.storage(func() error {
+		fileName, err := starTable(table)
+		if err == nil {
+			header, err = readHeader(fileName)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	var cols []starlark.Value
+	for _, h := range header[min(1, len(header)):] {
+		cols = append(cols, starlark.String(h))
+	}
+	return starlark.NewList(cols), nil
+}
+
+func (e *starEnv) rows(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var table string
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &table); err != nil {
+		return nil, err
+	}
+	data, err := e.read(table)
+	if err != nil {
+		return nil, err
+	}
+	var rows []starlark.Value
+	for _, rec := range data[1:] {
+		rows = append(rows, starRow(data[0], rec))
+	}
+	return starlark.NewList(rows), nil
+}
+
+func (e *starEnv) transform(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var table string
+	var fn starlark.Callable
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 2, &table, &fn); err != nil {
+		return nil, err
+	}
+	// функция вызывается без блокировки хранилища: по контрольной сумме
+	// запись обнаруживает изменения таблицы за время обхода
+	var data [][]string
+	var fileName, sum string
+	err := e.storage(func() (err error) {
+		if fileName, err = starTable(table); err != nil {
+			return err
+		}
+		if data, err = readTableData(fileName); err != nil {
+			return err
+		}
+		sum, err = fileChecksum(fileName)
+		return err
+	})
+	if err == nil && len(data) == 0 {
+		err = fmt.Errorf("таблица '%s' без заголовка", table)
+	}
+	if err != nil {
+		return nil, err
+	}
+	tm, err := getTableMeta(fileName)
+	if err != nil {
+		return nil, err
+	}
+	types := tm.Types
+	header := data[0]
+	out := [][]string{header}
+	changed := 0
+	for _, rec := range data[1:] {
+		d := starRow(header, rec)
+		res, err := starlark.Call(thread, fn, starlark.Tuple{d}, nil)
+		if err != nil {
+			return nil, err
+		}
+		switch res := res.(type) {
+		case *starlark.Dict:
+			d = res
+		case starlark.NoneType:
+		case starlark.Bool:
+			if !res {
+				changed++
+				continue
+			}
+		default:
+			return nil, fmt.Errorf("%s: функция вернула %s, ожидалась строка, None или False", b.Name(), res.Type())
+		}
+		row, err := rowFromStar(header, d, rec)
+		if err != nil {
+			return nil, err
+		}
+		if err := validateRow(types, header[1:], row[1:]); err != nil {
+			return nil, fmt.Errorf("строка id=%s: %w", rec[0], err)
+		}
+		if !slices.Equal(row, rec) {
+			changed++
+		}
+		out = append(out, row)
+	}
+	if changed > 0 {
+		err := e.storage(func() error {
+			now, err := fileChecksum(fileName)
+			if err != nil {
+				return err
+			}
+			if now != sum {
+				return fmt.Errorf("%s: таблица '%s' изменилась во время обхода, изменения не сохранены", b.Name(), table)
+			}
+			return saveTableData(fileName, out)
+		})
+		if err != nil {
+			return nil, err
+		}
+		e.affected += changed
+	}
+	return starlark.MakeInt(changed), nil
+}
+
+func (e *starEnv) insert(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var table string
+	var row *starlark.Dict
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, nil, 1, &table, &row); err != nil {
+		return nil, err
+	}
+	values := starlark.NewDict(len(kwargs))
+	if row != nil {
+		for _, kv := range row.Items() {
+			_ = values.SetKey(kv[0], kv[1])
+		}
+	}
+	for _, kv := range kwargs {
+		_ = values.SetKey(kv[0], kv[1])
+	}
+	var id int
+	err := e.storage(func() error {
+		fileName, err := starTable(table)
+		if err != nil {
+			return err
+		}
+		header, err := readHeader(fileName)
+		if err != nil {
+			return err
+		}
+		rec, err := rowFromStar(header, values, make([]string, len(header)))
+		if err != nil {
+			return err
+		}
+		if id, err = getNextID(fileName); err != nil {
+			return err
+		}
+		return insertRecord(fileName, rec[1:])
+	})
+	if err != nil {
+		return nil, err
+	}
+	e.affected++
+	return starlark.String(fmt.Sprint(id)), nil
+}
+
+func (e *starEnv) update(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var table string
+	var idv starlark.Value
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, nil, 2, &table, &idv); err != nil {
+		return nil, err
+	}
+	id, err := starString(idv)
+	if err != nil {
+		return nil, err
+	}
+	values := starlark.NewDict(len(kwargs))
+	for _, kv := range kwargs {
+		_ = values.SetKey(kv[0], kv[1])
+	}
+	err = e.storage(func() error {
+		fileName, err := starTable(table)
+		if err != nil {
+			return err
+		}
+		data, err := readTableData(fileName)
+		if err != nil {
+			return err
+		}
+		for r := 1; r < len(data); r++ {
+			if data[r][0] != id {
+				continue
+			}
+			row, err := rowFromStar(data[0], values, data[r])
+			if err != nil {
+				return err
+			}
+			tm, err := getTableMeta(fileName)
+			if err != nil {
+				return err
+			}
+			if err := validateRow(tm.Types, data[0][1:], row[1:]); err != nil {
+				return err
+			}
+			data[r] = row
+			return saveTableData(fileName, data)
+		}
+		return fmt.Errorf("запись с id=%s не найдена", id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	e.affected++
+	return starlark.None, nil
+}
+
+func (e *starEnv) delete(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var table string
+	var idv starlark.Value
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 2, &table, &idv); err != nil {
+		return nil, err
+	}
+	id, err := starString(idv)
+	if err != nil {
+		return nil, err
+	}
+	err = e.storage(func() error {
+		fileName, err := starTable(table)
+		if err != nil {
+			return err
+		}
+		return deleteRecord(fileName, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	e.affected++
+	return starlark.None, nil
+}
+
+func (e *starEnv) createTable(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var table string
+	var cols *starlark.List
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 2, &table, &cols); err != nil {
+		return nil, err
+	}
+	if err := checkStarName(table); err != nil {
+		return nil, err
+	}
+	var columns []string
+	for i := 0; i < cols.Len(); i++ {
+		s, ok := starlark.AsString(cols.Index(i))
+		if !ok {
+			return nil, fmt.Errorf("%s: имя колонки должно быть строкой, получено %s", b.Name(), cols.Index(i).Type())
+		}
+		columns = append(columns, s)
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("%s: не указаны колонки", b.Name())
+	}
+	return starlark.None, e.storage(func() error { return createTable(table, columns) })
+}
+
+func (e *starEnv) dropTable(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var table string
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &table); err != nil {
+		return nil, err
+	}
+	return starlark.None, e.storage(func() error {
+		if _, err := starTable(table); err != nil {
+			return err
+		}
+		return deleteTable(table)
+	})
+}
+
+// Команда поля ввода: только выборка и правка строк таблиц папки.
+// Хуки, скрипты, шифрование и операции с файлами таблиц сценарию
+// недоступны — они выполняют команды или выходят за пределы папки.
+func (e *starEnv) query(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var text string
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &text); err != nil {
+		return nil, err
+	}
+	st, err := parseQuery(text)
+	if err != nil {
+		return nil, err
+	}
+	var tables []string
+	switch st := st.(type) {
+	case *selectStmt:
+		tables = append(tables, st.from.name)
+		for _, j := range st.joins {
+			tables = append(tables, j.table.name)
+		}
+	case *findStmt:
+		tables = append(tables, st.table)
+	case *insertStmt:
+		tables = append(tables, st.table)
+	case *updateStmt:
+		tables = append(tables, st.table)
+	case *deleteStmt:
+		tables = append(tables, st.table)
+	default:
+		return nil, errors.New("в query() допустимы только SELECT, FIND, INSERT, UPDATE и DELETE")
+	}
+	for _, t := range tables {
+		if err := checkStarName(t); err != nil {
+			return nil, err
+		}
+	}
+	var res *queryResult
+	if err := e.storage(func() error {
+		res, err = execStatement(st)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	e.affected += res.Affected
+	if res.Data == nil || res.Affected > 0 {
+		return starlark.String(res.Message), nil
+	}
+	var rows []starlark.Value
+	for _, rec := range res.Data[1:] {
+		rows = append(rows, starRow(res.Data[0], rec))
+	}
+	return starlark.NewList(rows), nil
+}
+
+func starNum(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var s string
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &s); err != nil {
+		return nil, err
+	}
+	f, err := parseNumber(s)
+	if err != nil {
+		return nil, fmt.Errorf("%s: '%s' не является числом", b.Name(), s)
+	}
+	if f == float64(int64(f)) && !strings.ContainsAny(s, ".,eE") {
+		return starlark.MakeInt64(int64(f)), nil
+	}
+	return starlark.Float(f), nil
+}
+
+// --- Преобразования ---
+
+func (e *starEnv) read(table string) ([][]string, error) {
+	var data [][]string
+	err := e.storage(func() error {
+		fileName, err := starTable(table)
+		if err == nil {
+			data, err = readTableData(fileName)
+		}
+		return err
+	})
+	if err == nil && len(data) == 0 {
+		err = fmt.Errorf("таблица '%s' без заголовка", table)
+	}
+	return data, err
+}
+
+// имя таблицы без путей: сценарий не выходит из папки с таблицами
+func checkStarName(table string) error {
+	if table == "" || strings.ContainsAny(table, `/\`) || strings.HasPrefix(table, ".") {
+		return fmt.Errorf("недопустимое имя таблицы '%s'", table)
+	}
+	return nil
+}
+
+func starTable(table string) (string, error) {
+	if err := checkStarName(table); err != nil {
+		return "", err
+	}
+	fileName := tableFile(table)
+	if !tableExists(fileName) {
+		return "", fmt.Errorf("таблица '%s' не найдена", table)
+	}
+	return fileName, nil
+}
+
+func starRow(header, rec []string) *starlark.Dict {
+	d := starlark.NewDict(len(header))
+	for i, h := range header {
+		_ = d.SetKey(starlark.String(h), starlark.String(cellAt(rec, i)))
+	}
+	return d
+}
+
+// строка из словаря поверх base; id менять нельзя
+func rowFromStar(header []string, d *starlark.Dict, base []string) ([]string, error) {
+	row := append([]string(nil), base...)
+	for _, kv := range d.Items() {
+		col, ok := starlark.AsString(kv[0])
+		if !ok {
+			return nil, fmt.Errorf("имя колонки должно быть строкой, получено %s", kv[0].Type())
+		}
+		i := slices.Index(header, col)
+		if i < 0 {
+			return nil, fmt.Errorf("колонка '%s' не найдена", col)
+		}
+		v, err := starString(kv[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", col, err)
+		}
+		if i == 0 && v != base[0] {
+			return nil, errors.New("id строки менять нельзя")
+		}
+		row[i] = v
+	}
+	return row, nil
+}
+
+func starString(v starlark.Value) (string, error) {
+	switch v := v.(type) {
+	case starlark.String:
+		return string(v), nil
+	case starlark.NoneType:
+		return "", nil
+	case starlark.Bool:
+		if v {
+			return "true", nil
+		}
+		return "false", nil
+	case starlark.Int, starlark.Float:
+		return v.String(), nil
+	}
+	return "", fmt.Errorf("значение типа %s нельзя записать в таблицу", v.Type())
+}
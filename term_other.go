@@ -0,0 +1,14 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package main
+
+import "errors"
+
+// Посимвольный ввод не поддерживается: REPL читает строки целиком,
+// без истории по стрелкам и дополнения.
+
+func isTerminal(fd int) bool { return false }
+
+func makeRaw(fd int) (restore func(), err error) {
+	return nil, errors.New("посимвольный ввод в терминале не поддерживается")
+}
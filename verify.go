@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// --- Проверка целостности таблиц ---
+
+type verifyIssue struct {
+	Table   string // имя файла таблицы
+	Row     int    // индекс строки данных (0 — заголовок), -1 — файл целиком
+	Col     int    // индекс колонки, -1 — строка целиком
+	Msg     string
+	Fixable bool
+}
+
+func (v verifyIssue) String() string {
+	switch {
+	case v.Row < 0:
+		return fmt.Sprintf("%s: %s", v.Table, v.Msg)
+	case v.Row == 0:
+		return fmt.Sprintf("%s: заголовок: %s", v.Table, v.Msg)
+	default:
+		return fmt.Sprintf("%s: строка %d: %s", v.Table, v.Row, v.Msg)
+	}
+}
+
+// чтение без требования одинаковой длины строк — чтобы увидеть «рваные» строки
+func readTableLenient(fileName string) ([][]string, error) {
+	f, err := openTableReader(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	return r.ReadAll()
+}
+
+func verifyTable(fileName string) []verifyIssue {
+	table := filepath.Base(fileName)
+	var issues []verifyIssue
+	add := func(row, col int, fixable bool, format string, args ...any) {
+		issues = append(issues, verifyIssue{Table: table, Row: row, Col: col, Msg: fmt.Sprintf(format, args...), Fixable: fixable})
+	}
+
+	tm, err := getTableMeta(fileName)
+	if err != nil {
+		add(-1, -1, false, "%v", err)
+		return issues
+	}
+	sum, err := fileChecksum(fileName)
+	if err != nil {
+		add(-1, -1, false, "не удалось прочитать файл: %v", err)
+		return issues
+	}
+	switch {
+	case tm.Checksum == "":
+		add(-1, -1, true, "контрольная сумма не записана")
+	case tm.Checksum != sum:
+		add(-1, -1, true, "контрольная сумма не совпадает: файл изменён вне приложения")
+	}
+
+	data, err := readTableLenient(fileName)
+	if errors.Is(err, errTableLocked) {
+		add(-1, -1, false, "таблица зашифрована и не разблокирована, содержимое не проверено")
+		return issues
+	}
+	var pe *csv.ParseError
+	if errors.As(err, &pe) {
+		add(-1, -1, false, "ошибка разбора CSV в строке файла %d: %v", pe.Line, pe.Err)
+		return issues
+	}
+	if err != nil {
+		add(-1, -1, false, "%v", err)
+		return issues
+	}
+	if len(data) == 0 {
+		add(0, -1, false, "отсутствует заголовок")
+		return issues
+	}
+
+	header := data[0]
+	if len(header) == 0 || !strings.EqualFold(header[0], "id") {
+		add(0, 0, false, "первая колонка должна называться id")
+	}
+	seenCol := map[string]bool{}
+	for i, col := range header {
+		key := strings.ToLower(strings.TrimSpace(col))
+		if key == "" {
+			add(0, i, false, "колонка %d без имени", i+1)
+		} else if seenCol[key] {
+			add(0, i, false, "повторяющееся имя колонки '%s'", col)
+		}
+		seenCol[key] = true
+	}
+	for col, typ := range tm.Types {
+		if !containsString(header, col) {
+			add(0, -1, true, "тип '%s' объявлен для отсутствующей колонки '%s'", typ, col)
+		}
+	}
+
+	seenID := map[int]int{}
+	for r := 1; r < len(data); r++ {
+		rec := data[r]
+		if len(rec) < len(header) {
+			add(r, -1, true, "полей %d, ожидалось %d", len(rec), len(header))
+		} else if len(rec) > len(header) {
+			add(r, -1, extraCellsEmpty(rec, len(header)), "полей %d, ожидалось %d", len(rec), len(header))
+		}
+		if len(rec) == 0 {
+			continue
+		}
+		id, err := strconv.Atoi(strings.TrimSpace(rec[0]))
+		switch {
+		case err != nil:
+			add(r, 0, true, "нечисловой id '%s'", rec[0])
+		case seenID[id] > 0:
+			add(r, 0, true, "id %d повторяет строку %d", id, seenID[id])
+		default:
+			seenID[id] = r
+		}
+		for c := 1; c < len(header) && c < len(rec); c++ {
+			if typ, ok := tm.Types[header[c]]; ok {
+				if err := checkValueType(typ, rec[c]); err != nil {
+					add(r, c, false, "%s: %v", header[c], err)
+				}
+			}
+		}
+	}
+	return issues
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func extraCellsEmpty(rec []string, n int) bool {
+	for _, v := range rec[n:] {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// проверка всех таблиц папки
+func verifyDatabase(dir string) []verifyIssue {
+	var issues []verifyIssue
+	for _, name := range listTables(dir) {
+		issues = append(issues, verifyTable(filepath.Join(dir, name))...)
+	}
+	return issues
+}
+
+// Автоисправление: выравнивание длины строк, новые id вместо
+// нечисловых и повторяющихся, удаление устаревших типов и
+// пересчёт контрольной суммы. Возвращает число исправлений.
+func fixTable(fileName string) (int, error) {
+	fixed := 0
+	tm, err := getTableMeta(fileName)
+	if err != nil {
+		return 0, err
+	}
+	data, err := readTableLenient(fileName)
+	if err != nil {
+		return 0, err
+	}
+	if len(data) == 0 {
+		return 0, errors.New("таблица без заголовка не может быть исправлена")
+	}
+	header := data[0]
+
+	stale := map[string]bool{}
+	for col := range tm.Types {
+		if !containsString(header, col) {
+			stale[col] = true
+			fixed++
+		}
+	}
+	if len(stale) > 0 {
+		if err := updateTableMeta(fileName, func(t *tableMeta) bool {
+			for col := range stale {
+				delete(t.Types, col)
+			}
+			return true
+		}); err != nil {
+			return fixed, err
+		}
+	}
+
+	maxID := 0
+	for _, rec := range data[1:] {
+		if len(rec) > 0 {
+			if id, err := strconv.Atoi(strings.TrimSpace(rec[0])); err == nil && id > maxID {
+				maxID = id
+			}
+		}
+	}
+	changed := false
+	seen := map[int]bool{}
+	for r := 1; r < len(data); r++ {
+		rec := data[r]
+		switch {
+		case len(rec) < len(header):
+			rec = append(rec, make([]string, len(header)-len(rec))...)
+			fixed++
+			changed = true
+		case len(rec) > len(header) && extraCellsEmpty(rec, len(header)):
+			rec = rec[:len(header)]
+			fixed++
+			changed = true
+		}
+		id, err := strconv.Atoi(strings.TrimSpace(rec[0]))
+		if err != nil || seen[id] {
+			maxID++
+			id = maxID
+			rec[0] = strconv.Itoa(id)
+			fixed++
+			changed = true
+		}
+		seen[id] = true
+		data[r] = rec
+	}
+
+	if changed {
+		return fixed, saveTableData(fileName, data)
+	}
+	if sum, err := fileChecksum(fileName); err == nil && sum != tm.Checksum {
+		fixed++
+	}
+	return fixed, recordChecksum(fileName)
+}
+
+// Исправить таблицы с исправимыми проблемами и вернуть то, что осталось.
+// В проблеме — имя файла без пути, dir — проверенная папка.
+func fixIssues(dir string, issues []verifyIssue) []verifyIssue {
+	var tables []string
+	for _, is := range issues {
+		if is.Fixable && !containsString(tables, is.Table) {
+			tables = append(tables, is.Table)
+		}
+	}
+	var left []verifyIssue
+	for _, is := range issues {
+		if !containsString(tables, is.Table) {
+			left = append(left, is)
+		}
+	}
+	for _, t := range tables {
+		fileName := filepath.Join(dir, t)
+		if _, err := fixTable(fileName); err != nil {
+			left = append(left, verifyIssue{Table: t, Row: -1, Col: -1, Msg: "автоисправление не удалось: " + err.Error()})
+			continue
+		}
+		left = append(left, verifyTable(fileName)...)
+	}
+	return left
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// --- Представления ---
+//
+// CREATE [OR REPLACE] VIEW [IF NOT EXISTS] <name> AS <SELECT ... | FIND ...>
+// DROP VIEW [IF EXISTS] <name>
+// OPEN VIEW <name>
+//
+// Представление — файл <name>.view рядом с таблицами с текстом запроса.
+// Оно открывается как таблица и пересчитывается при изменении исходных
+// CSV. Если каждая строка результата — строка одной таблицы (FIND или
+// SELECT из одной таблицы без JOIN, группировки и выражений), правки
+// ячеек и удаление строк переносятся в эту таблицу по id.
+
+const viewExt = ".view"
+
+type viewStmt struct {
+	cmd         string // create, drop, open
+	name        string
+	query       string
+	stmt        statement // разобранный запрос CREATE VIEW
+	orReplace   bool
+	ifExists    bool
+	ifNotExists bool
+}
+
+func (*viewStmt) statementNode() {}
+
+// открытое представление
+type viewInfo struct {
+	name    string   // файл представления
+	base    string   // таблица для правок; пусто — только чтение
+	columns []string // колонки base для колонок результата
+	sources []string // файлы, при изменении которых представление обновляется
+}
+
+func viewFile(name string) string {
+	if strings.HasSuffix(strings.ToLower(name), viewExt) {
+		return name
+	}
+	return name + viewExt
+}
+
+// имена файлов представлений в папке
+func listViews(dir string) []string {
+	var files []string
+	items, _ := os.ReadDir(dir)
+	for _, it := range items {
+		n := it.Name()
+		if it.IsDir() || strings.HasPrefix(n, ".") {
+			continue
+		}
+		if strings.HasSuffix(strings.ToLower(n), viewExt) {
+			files = append(files, n)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// CREATE [OR REPLACE] уже прочитан
+func (p *parser) parseCreateView(orReplace bool) (*viewStmt, error) {
+	st := &viewStmt{cmd: "create", orReplace: orReplace}
+	if err := p.expectKeyword("view"); err != nil {
+		return nil, err
+	}
+	var err error
+	ifTok := p.tok
+	if st.ifNotExists, err = p.acceptIfNotExists(); err != nil {
+		return nil, err
+	}
+	if st.ifNotExists && st.orReplace {
+		return nil, p.errorf(ifTok, "OR REPLACE нельзя сочетать с IF NOT EXISTS")
+	}
+	if st.name, err = p.name("имя представления"); err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("as"); err != nil {
+		return nil, err
+	}
+	start := p.tok
+	inner, err := p.parseStatement()
+	if err != nil {
+		return nil, err
+	}
+	switch inner.(type) {
+	case *selectStmt, *findStmt:
+	default:
+		return nil, p.errorf(start, "представление может хранить только SELECT или FIND")
+	}
+	st.query = p.sourceText(start.pos, p.prevEnd)
+	st.stmt = inner
+	return st, nil
+}
+
+// DROP VIEW и OPEN VIEW; команда и VIEW уже прочитаны
+func (p *parser) parseViewCmd(cmd string) (*viewStmt, error) {
+	st := &viewStmt{cmd: cmd}
+	var err error
+	if cmd == "drop" {
+		if st.ifExists, err = p.acceptIfExists(); err != nil {
+			return nil, err
+		}
+	}
+	if st.name, err = p.name("имя представления"); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+func execView(st *viewStmt) (*queryResult, error) {
+	fileName := viewFile(st.name)
+	_, statErr := os.Stat(fileName)
+	exists := statErr == nil
+	switch st.cmd {
+	case "drop":
+		if !exists {
+			if st.ifExists {
+				return &queryResult{Message: fmt.Sprintf("Представление %s не найдено, команда пропущена", fileName)}, nil
+			}
+			return nil, fmt.Errorf("представление '%s' не найдено", st.name)
+		}
+		if err := os.Remove(fileName); err != nil {
+			return nil, err
+		}
+		return &queryResult{Message: fmt.Sprintf("Представление %s удалено", fileName)}, nil
+	case "open":
+		res, err := openView(fileName)
+		if err != nil {
+			return nil, err
+		}
+		return res, nil
+	}
+
+	if exists && !st.orReplace {
+		if st.ifNotExists {
+			return &queryResult{Message: fmt.Sprintf("Представление %s уже существует, команда пропущена", fileName)}, nil
+		}
+		return nil, fmt.Errorf("представление %s уже существует, используйте CREATE OR REPLACE VIEW", fileName)
+	}
+	// запрос проверяется выполнением до записи файла
+	stmt := st.stmt
+	if stmt == nil {
+		var err error
+		if stmt, err = parseQuery(st.query); err != nil {
+			return nil, err
+		}
+	}
+	res, info, err := runView(stmt)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(fileName, []byte(st.query+"\n"), 0644); err != nil {
+		return nil, err
+	}
+	info.name = fileName
+	info.sources = append(info.sources, fileName)
+	res.View = info
+	res.Message = fmt.Sprintf("Представление %s сохранено, строк %d", fileName, len(res.Data)-1)
+	return res, nil
+}
+
+func openView(fileName string) (*queryResult, error) {
+	src, err := os.ReadFile(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("представление '%s' не найдено", strings.TrimSuffix(fileName, viewExt))
+	}
+	if err != nil {
+		return nil, err
+	}
+	stmt, err := parseQuery(strings.TrimSpace(string(src)))
+	if err != nil {
+		return nil, viewError(fileName, err)
+	}
+	res, info, err := runView(stmt)
+	if err != nil {
+		return nil, viewError(fileName, err)
+	}
+	info.name = fileName
+	info.sources = append(info.sources, fileName)
+	res.View = info
+	mode := "только чтение"
+	if info.base != "" {
+		mode = "правки сохраняются в " + info.base
+	}
+	res.Message = fmt.Sprintf("Представление %s: строк %d (%s)", fileName, len(res.Data)-1, mode)
+	return res, nil
+}
+
+// Позиция ошибки разбора относится к тексту представления, а не к
+// введённой команде, поэтому queryError не разворачивается.
+func viewError(fileName string, err error) error {
+	var qe *queryError
+	if errors.As(err, &qe) {
+		return fmt.Errorf("представление %s: %v", fileName, err)
+	}
+	return fmt.Errorf("представление %s: %w", fileName, err)
+}
+
+// выполнение запроса представления
+func runView(stmt statement) (*queryResult, *viewInfo, error) {
+	info := &viewInfo{}
+	switch st := stmt.(type) {
+	case *findStmt:
+		fileName := tableFile(st.table)
+		data, err := findRows(fileName, st.column, st.match)
+		if err != nil {
+			return nil, nil, err
+		}
+		info.base, info.columns, info.sources = fileName, data[0], []string{fileName}
+		return &queryResult{Table: fileName, Data: data}, info, nil
+	case *selectStmt:
+		editable := st.updatable()
+		if editable {
+			st.ensureID()
+		}
+		res, err := execSelect(st)
+		if err != nil {
+			return nil, nil, err
+		}
+		info.sources = append(info.sources, tableFile(st.from.name))
+		for _, j := range st.joins {
+			info.sources = append(info.sources, tableFile(j.table.name))
+		}
+		if editable {
+			if info.columns, err = st.sourceColumns(); err != nil {
+				return nil, nil, err
+			}
+			info.base = res.Table
+			res.ReadOnly = false
+		}
+		return res, info, nil
+	}
+	return nil, nil, errors.New("представление может хранить только SELECT или FIND")
+}
+
+// каждая строка результата — строка одной таблицы, а колонки — её колонки
+func (st *selectStmt) updatable() bool {
+	if len(st.joins) > 0 || st.grouped() {
+		return false
+	}
+	for _, it := range st.items {
+		if it.star {
+			continue
+		}
+		if _, ok := it.expr.(*colRef); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// id первой колонкой: по нему правки находят строку таблицы. Колонка id
+// или * из запроса переносится в начало, иначе id добавляется.
+func (st *selectStmt) ensureID() {
+	for i, it := range st.items {
+		c, ok := it.expr.(*colRef)
+		if it.star || ok && strings.EqualFold(c.name, "id") {
+			st.items = slices.Insert(slices.Delete(st.items, i, i+1), 0, it)
+			return
+		}
+	}
+	id := selectItem{expr: &colRef{name: "id", raw: "id"}, title: "id"}
+	st.items = append([]selectItem{id}, st.items...)
+}
+
+// имена колонок таблицы для колонок результата (после выполнения запроса)
+func (st *selectStmt) sourceColumns() ([]string, error) {
+	var out []string
+	for _, it := range st.items {
+		if it.star {
+			header, err := tableColumns(tableFile(st.from.name))
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, header...)
+			continue
+		}
+		c := it.expr.(*colRef)
+		out = append(out, c.scope.names[c.idx])
+	}
+	return out, nil
+}
+
+// правка ячейки представления в исходной таблице
+func (v *viewInfo) updateCell(id string, col int, val string) (*queryResult, error) {
+	if v.base == "" || col >= len(v.columns) {
+		return nil, errors.New("представление только для чтения")
+	}
+	tm, err := getTableMeta(v.base)
+	if err != nil {
+		return nil, err
+	}
+	if computedIndex(tm.Computed, v.columns[col]) >= 0 {
+		return nil, fmt.Errorf("колонка '%s' вычисляемая, её значение задаёт выражение", v.columns[col])
+	}
+	return execStatement(&updateStmt{
+		table: v.base,
+		sets:  []setClause{{column: v.columns[col], pos: -1, expr: &literalExpr{v: textValue(val)}}},
+		where: idEquals(id),
+	})
+}
+
+func (v *viewInfo) deleteRow(id string) (*queryResult, error) {
+	if v.base == "" {
+		return nil, errors.New("представление только для чтения")
+	}
+	return execStatement(&deleteStmt{table: v.base, where: idEquals(id)})
+}
+
+func idEquals(id string) expr {
+	return &binaryExpr{op: "=", l: &colRef{name: "id", raw: "id"}, r: &literalExpr{v: textValue(id)}}
+}
+
+// Опрос времени изменения и размера файлов: onChange вызывается из
+// горутины наблюдателя, когда файл изменился, появился или пропал.
+func watchFiles(ctx context.Context, files []string, interval time.Duration, onChange func()) {
+	stamp := func() []int64 {
+		out := make([]int64, 0, 2*len(files))
+		for _, f := range files {
+			var mod, size int64 = 0, -1
+			if fi, err := os.Stat(f); err == nil {
+				mod, size = fi.ModTime().UnixNano(), fi.Size()
+			}
+			out = append(out, mod, size)
+		}
+		return out
+	}
+	last := stamp()
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				now := stamp()
+				if !slices.Equal(now, last) {
+					last = now
+					onChange()
+				}
+			}
+		}
+	}()
+}